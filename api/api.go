@@ -17,6 +17,8 @@ const (
 	OptLabel = OptionKey("Label")
 	// OptConfig query parameter used to lookup volume by set of labels
 	OptConfigLabel = OptionKey("ConfigLabel")
+	// OptRecursive query parameter used to delete a volume with its children
+	OptRecursive = OptionKey("Recursive")
 )
 
 // VolumeCreateRequest is the body of create REST request
@@ -55,6 +57,8 @@ type VolumeStateAction struct {
 	Mount VolumeActionParam `json:"mount"`
 	// MountPath
 	MountPath string `json:"mount_path"`
+	// MountOptions used when Mount is on, defaults if nil.
+	MountOptions *MountOptions `json:"mount_options,omitempty"`
 	// DevicePath returned in Attach
 	DevicePath string `json:"device_path"`
 }
@@ -72,6 +76,12 @@ type VolumeResponse struct {
 	Error string `json:"error"`
 }
 
+// DriverModeRequest request body to change the driver mode.
+type DriverModeRequest struct {
+	// ReadOnly rejects operations that modify volumes when set.
+	ReadOnly bool `json:"read_only"`
+}
+
 // SnapCreateRequest request body to create a snap.
 type SnapCreateRequest struct {
 	ID     VolumeID `json:"id"`
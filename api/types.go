@@ -81,6 +81,37 @@ type CreateOptions struct {
 	FailIfExists bool
 	// CreateFromSnap will create a volume with specified SnapID
 	CreateFromSnap SnapID
+	// Idempotent return the existing volume if one with the same name and
+	// labels exists instead of creating a duplicate.
+	Idempotent bool
+}
+
+// MountPropagation controls how mounts under a volume's mount point are
+// shared with other mount namespaces.
+type MountPropagation string
+
+const (
+	PropagationPrivate  = MountPropagation("private")
+	PropagationRPrivate = MountPropagation("rprivate")
+	PropagationShared   = MountPropagation("shared")
+	PropagationRShared  = MountPropagation("rshared")
+	PropagationSlave    = MountPropagation("slave")
+	PropagationRSlave   = MountPropagation("rslave")
+)
+
+// MountOptions are passed in with a Mount request.
+type MountOptions struct {
+	// ReadOnly mount the volume read-only.
+	ReadOnly bool
+	// Propagation of the mount point, the host default if empty.
+	Propagation MountPropagation
+	// Options comma separated mount options, e.g. "noatime,nosuid". Options
+	// that are not generic mount flags are passed to the filesystem.
+	Options string
+	// SubPath directory within the volume to mount instead of its root.
+	SubPath string
+	// CreateSubPath create SubPath if it does not exist.
+	CreateSubPath bool
 }
 
 // Filesystem supported filesystems
@@ -95,10 +126,21 @@ const (
 	FsZfs = Filesystem("zfs")
 	// FsBtrfs the Btrfs filesystem
 	FsBtrfs = Filesystem("btrfs")
+	// FsNfs the NFS filesystem, for volumes backed by an NFS export.
+	FsNfs = Filesystem("nfs")
 	// FsNone no file system, applicable for raw block devices.
 	FsNone = Filesystem("none")
 )
 
+// Valid returns true if fs is one of the recognized filesystems.
+func (fs Filesystem) Valid() bool {
+	switch fs {
+	case FsXfs, FsExt4, FsZfs, FsBtrfs, FsNfs, FsNone:
+		return true
+	}
+	return false
+}
+
 // VolumeSpec has the properties needed to create a volume.
 type VolumeSpec struct {
 	// Ephemeral storage
@@ -122,12 +164,16 @@ type VolumeSpec struct {
 	SnapshotInterval int
 	// Volume configuration labels
 	ConfigLabels Labels
+	// Tags billing tags the volume is created with, see Volume.Tags.
+	Tags Labels `json:",omitempty"`
 }
 
 type MachineID string
 
 // Volume represents a live, created volume.
 type Volume struct {
+	// SchemaVersion of the stored record, see volume.SchemaVersion.
+	SchemaVersion int `json:",omitempty"`
 	// ID Self referential VolumeID
 	ID VolumeID
 	// Locator User specified locator
@@ -138,6 +184,9 @@ type Volume struct {
 	Spec *VolumeSpec
 	// Usage Volume usage
 	Usage uint64
+	// ExclusiveUsage bytes used by this volume only, not shared with its
+	// snapshots or clones. Zero if the driver does not account for it.
+	ExclusiveUsage uint64 `json:",omitempty"`
 	// LastScan time when an integrity check for run
 	LastScan time.Time
 	// Format Filesystem type if any
@@ -152,10 +201,16 @@ type Volume struct {
 	DevicePath string
 	// AttachPath
 	AttachPath string
+	// SubPathMounts paths subdirectories of the volume are mounted at, see
+	// MountOptions.SubPath.
+	SubPathMounts []string `json:",omitempty"`
 	// ReplicaSet Set of nodes no which this Volume is erasure coded - for clustered storage arrays
 	ReplicaSet []MachineID
 	// Error Last recorded error
 	Error string
+	// Tags billing tags, e.g. cost-center or project. Unlike labels, their
+	// keys are restricted to an allowed list, see volume.TagKeys.
+	Tags Labels `json:",omitempty"`
 }
 
 // VolumeSnap identifies a volume snapshot.
@@ -172,12 +227,165 @@ type VolumeSnap struct {
 	Usage uint64
 }
 
+// BlockChange a region of a file that differs between two snapshots.
+type BlockChange struct {
+	// Path of the file relative to the volume root.
+	Path string
+	// Offset of the changed region in bytes.
+	Offset uint64
+	// Length of the changed region in bytes, 0 up to the end of the file.
+	Length uint64
+	// Deleted true if Path was removed, Offset and Length are unused.
+	Deleted bool `json:",omitempty"`
+}
+
+// DriverVersion identifies the on-disk and stream formats a driver uses.
+type DriverVersion struct {
+	// Driver name, e.g. "btrfs".
+	Driver string
+	// Version semantic version, drivers with another major version cannot
+	// read each other's data.
+	Version string
+	// Features optional formats the driver uses, e.g. "send-stream-v1".
+	Features []string `json:",omitempty"`
+}
+
+// String returns the driver and its version, e.g. "btrfs 1.0.0".
+func (v DriverVersion) String() string {
+	return v.Driver + " " + v.Version
+}
+
+// UsageSummary aggregates the volumes sharing a tag value.
+type UsageSummary struct {
+	// Volumes number of volumes.
+	Volumes int
+	// Capacity provisioned size of the volumes in bytes.
+	Capacity uint64
+	// Usage bytes used by the volumes.
+	Usage uint64
+}
+
+// DriverInfo describes a loaded driver instance.
+type DriverInfo struct {
+	// Name of the instance, e.g. "btrfs" or "nfs-backup".
+	Name string
+	// Type "FileDriver", "BlockDriver" or "ObjectDriver".
+	Type string
+	// Version of the driver, if it reports one.
+	Version *DriverVersion `json:",omitempty"`
+	// Capabilities advertised by the driver, e.g. "snapshot".
+	Capabilities []string
+	// Status of the driver, only set when a single driver is requested.
+	Status [][2]string `json:",omitempty"`
+}
+
+// FsckResult is the outcome of a filesystem check.
+type FsckResult struct {
+	// ErrorsFound true if the check found errors.
+	ErrorsFound bool
+	// Repaired true if the errors found were fixed, only in repair mode.
+	Repaired bool
+	// Output of the check tool.
+	Output string
+}
+
 // VolumeStats
 type VolumeStats struct {
-	// TODO
+	// LogicalBytes referenced by the volume's files.
+	LogicalBytes uint64
+	// PhysicalBytes used on disk after compression and deduplication,
+	// LogicalBytes / PhysicalBytes is the space saving ratio.
+	PhysicalBytes uint64
+}
+
+const (
+	// AlertCapacityUsage raised when a volume crosses its usage threshold.
+	AlertCapacityUsage = "CapacityUsage"
+	// AlertMountFailure raised when a volume fails to mount.
+	AlertMountFailure = "MountFailure"
+	// AlertScrubErrors raised when a scrub finds uncorrectable errors.
+	AlertScrubErrors = "ScrubErrors"
+	// AlertNfsVersionMismatch raised when an NFS export was mounted with
+	// another protocol version than the one requested.
+	AlertNfsVersionMismatch = "NfsVersionMismatch"
+)
+
+// Alert raised on a volume.
+type Alert struct {
+	// Type of alert, e.g. AlertCapacityUsage.
+	Type string
+	// VolumeID the alert was raised on.
+	VolumeID VolumeID
+	// Time the alert was raised.
+	Time time.Time
+	// Message human readable description.
+	Message string
 }
 
 // VolumeAlerts
 type VolumeAlerts struct {
-	// TODO
+	// Alerts currently raised.
+	Alerts []Alert
+}
+
+// AuditEntry records one mutating operation on a volume.
+type AuditEntry struct {
+	// Time the operation completed.
+	Time time.Time
+	// Actor who requested the operation, empty if unknown.
+	Actor string
+	// Operation name, e.g. "create".
+	Operation string
+	// VolumeID the operation acted on.
+	VolumeID VolumeID
+	// SnapID created or deleted by a snapshot operation.
+	SnapID SnapID `json:",omitempty"`
+	// Error empty if the operation succeeded.
+	Error string `json:",omitempty"`
+}
+
+// ScrubStatus result of the last scrub of a driver's backing storage.
+type ScrubStatus struct {
+	// Running true while a scrub is in progress.
+	Running bool
+	// BytesScrubbed data and metadata bytes verified.
+	BytesScrubbed uint64
+	// CorrectedErrors errors found and repaired.
+	CorrectedErrors uint64
+	// UncorrectableErrors errors found that could not be repaired.
+	UncorrectableErrors uint64
+}
+
+// VolumeDescription a volume together with its snapshots and stats.
+type VolumeDescription struct {
+	// Volume see Volume, AttachPath is where it is currently mounted.
+	Volume Volume
+	// Snapshots of this volume.
+	Snapshots []VolumeSnap
+	// Stats nil if the driver does not report stats.
+	Stats *VolumeStats `json:",omitempty"`
+}
+
+// MetricType describes how the value of a Metric is interpreted.
+type MetricType string
+
+const (
+	// MetricCounter monotonically increasing value.
+	MetricCounter = MetricType("counter")
+	// MetricGauge value that can go up and down.
+	MetricGauge = MetricType("gauge")
+)
+
+// Metric is a single driver measurement.
+type Metric struct {
+	// Name of the metric, without the driver prefix.
+	Name string
+	// Help one line description of the metric.
+	Help string
+	// Type see MetricType
+	Type MetricType
+	// Labels that qualify this sample, e.g. the operation.
+	Labels Labels
+	// Value of the sample.
+	Value float64
 }
@@ -0,0 +1,41 @@
+package apiserver
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// ActorHeader names the HTTP header that identifies the caller in audit
+// entries. The remote address is recorded if it is not set.
+const ActorHeader = "X-Openstorage-Actor"
+
+var (
+	auditLock   sync.Mutex
+	auditLogger volume.AuditLogger
+)
+
+// SetAuditLogger logs the mutating volume operations of all requests to l.
+// A nil l turns auditing off.
+func SetAuditLogger(l volume.AuditLogger) {
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	auditLogger = l
+}
+
+// audited returns d wrapped to audit operations on behalf of r, or d
+// itself if auditing is off.
+func audited(r *http.Request, d volume.VolumeDriver) volume.VolumeDriver {
+	auditLock.Lock()
+	l := auditLogger
+	auditLock.Unlock()
+	if l == nil {
+		return d
+	}
+	actor := r.Header.Get(ActorHeader)
+	if actor == "" {
+		actor = r.RemoteAddr
+	}
+	return volume.WithAudit(volume.ContextWithActor(r.Context(), actor), d, l)
+}
@@ -30,7 +30,9 @@ type volumeRequest struct {
 }
 
 type volumeResponse struct {
-	Err string
+	Err  string
+	Code int    `json:",omitempty"`
+	Kind string `json:",omitempty"`
 }
 type volumePathResponse struct {
 	Mountpoint string
@@ -56,12 +58,17 @@ func volDriverPath(method string) string {
 
 func (d *driver) Routes() []*Route {
 	return []*Route{
-		&Route{verb: "POST", path: volDriverPath("Create"), fn: d.create},
-		&Route{verb: "POST", path: volDriverPath("Remove"), fn: d.remove},
-		&Route{verb: "POST", path: volDriverPath("Mount"), fn: d.mount},
-		&Route{verb: "POST", path: volDriverPath("Path"), fn: d.path},
-		&Route{verb: "POST", path: volDriverPath("Unmount"), fn: d.unmount},
-		&Route{verb: "POST", path: "/Plugin.Activate", fn: d.handshake},
+		&Route{verb: "POST", path: volDriverPath("Create"), fn: d.create,
+			req: volumeRequest{}, resp: volumeResponse{}},
+		&Route{verb: "POST", path: volDriverPath("Remove"), fn: d.remove,
+			req: volumeRequest{}, resp: volumeResponse{}},
+		&Route{verb: "POST", path: volDriverPath("Mount"), fn: d.mount,
+			req: volumeRequest{}, resp: volumePathResponse{}},
+		&Route{verb: "POST", path: volDriverPath("Path"), fn: d.path,
+			req: volumeRequest{}, resp: volumePathResponse{}},
+		&Route{verb: "POST", path: volDriverPath("Unmount"), fn: d.unmount,
+			req: volumeRequest{}, resp: volumeResponse{}},
+		&Route{verb: "POST", path: "/Plugin.Activate", fn: d.handshake, resp: handshakeResp{}},
 		&Route{verb: "GET", path: "/status", fn: d.status},
 	}
 }
@@ -70,6 +77,12 @@ func (d *driver) emptyResponse(w http.ResponseWriter) {
 	json.NewEncoder(w).Encode(&volumeResponse{})
 }
 
+// errResponse responds with err, its kind and the matching status.
+func (d *driver) errResponse(w http.ResponseWriter, err error) {
+	k := classify(err)
+	writeError(w, &volumeResponse{Err: err.Error(), Code: k.Code, Kind: k.Kind}, k.Code)
+}
+
 func (d *driver) volFromName(name string) (*volumeInfo, error) {
 	s := strings.Split(name, ":")
 	if len(s) != 2 {
@@ -127,7 +140,7 @@ func (d *driver) create(w http.ResponseWriter, r *http.Request) {
 	_, err = d.volFromName(request.Name)
 	if err != nil {
 		e := d.volNotFound(method, request.Name, err, w)
-		json.NewEncoder(w).Encode(&volumeResponse{Err: e.Error()})
+		d.errResponse(w, e)
 		return
 	}
 	json.NewEncoder(w).Encode(&volumeResponse{})
@@ -143,7 +156,7 @@ func (d *driver) remove(w http.ResponseWriter, r *http.Request) {
 	_, err = d.volFromName(request.Name)
 	if err != nil {
 		e := d.volNotFound(method, request.Name, err, w)
-		json.NewEncoder(w).Encode(&volumeResponse{Err: e.Error()})
+		d.errResponse(w, e)
 		return
 	}
 	json.NewEncoder(w).Encode(&volumeResponse{})
@@ -159,7 +172,7 @@ func (d *driver) mount(w http.ResponseWriter, r *http.Request) {
 	volInfo, err := d.volFromName(request.Name)
 	if err != nil {
 		e := d.volNotFound(method, request.Name, err, w)
-		json.NewEncoder(w).Encode(&volumePathResponse{Err: e.Error()})
+		d.errResponse(w, e)
 		return
 	}
 	response.Mountpoint = fmt.Sprintf("/mnt/%s", request.Name)
@@ -167,12 +180,13 @@ func (d *driver) mount(w http.ResponseWriter, r *http.Request) {
 
 	v, err := volume.Get(d.name)
 	if err != nil {
-		json.NewEncoder(w).Encode(&volumePathResponse{Err: err.Error()})
+		d.errResponse(w, err)
 		return
 	}
+	v = audited(r, v)
 	path, err := v.Attach(volInfo.vol.ID)
 	if err != nil {
-		json.NewEncoder(w).Encode(&volumePathResponse{Err: err.Error()})
+		d.errResponse(w, err)
 		return
 	}
 	response.Mountpoint = path
@@ -191,7 +205,7 @@ func (d *driver) path(w http.ResponseWriter, r *http.Request) {
 	volInfo, err := d.volFromName(request.Name)
 	if err != nil {
 		e := d.volNotFound(method, request.Name, err, w)
-		json.NewEncoder(w).Encode(&volumePathResponse{Err: e.Error()})
+		d.errResponse(w, e)
 		return
 	}
 	response.Mountpoint = volInfo.vol.AttachPath
@@ -208,18 +222,19 @@ func (d *driver) unmount(w http.ResponseWriter, r *http.Request) {
 	volInfo, err := d.volFromName(request.Name)
 	if err != nil {
 		e := d.volNotFound(method, request.Name, err, w)
-		json.NewEncoder(w).Encode(&volumeResponse{Err: e.Error()})
+		d.errResponse(w, e)
 		return
 	}
 	v, err := volume.Get(d.name)
 	if err != nil {
-		json.NewEncoder(w).Encode(&volumeResponse{Err: err.Error()})
+		d.errResponse(w, err)
 		return
 	}
+	v = audited(r, v)
 	err = v.Detach(volInfo.vol.ID)
 	if err != nil {
 		d.logReq(request.Name, method).Warnf("%s", err.Error())
-		json.NewEncoder(w).Encode(&volumeResponse{Err: err.Error()})
+		d.errResponse(w, err)
 		return
 	}
 
@@ -0,0 +1,72 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// errorResponse is the body of an error response. Err is kept as the
+// message for clients that predate Code and Kind.
+type errorResponse struct {
+	Err  string
+	Code int    `json:",omitempty"`
+	Kind string `json:",omitempty"`
+}
+
+// errorKind identifies an error for clients and the HTTP status it maps to.
+type errorKind struct {
+	Kind string
+	Code int
+}
+
+// kindCodes are the HTTP statuses of the kinds of volume.ErrorKinds.
+var kindCodes = map[string]int{
+	"VolumeNotFound":          http.StatusNotFound,
+	"SnapshotNotFound":        http.StatusNotFound,
+	"DriverNotFound":          http.StatusNotFound,
+	"Exists":                  http.StatusConflict,
+	"VolumeAttached":          http.StatusConflict,
+	"VolumeDetached":          http.StatusConflict,
+	"VolumeHasSnapshots":      http.StatusConflict,
+	"NotSupported":            http.StatusNotImplemented,
+	"FilesystemNotSupported":  http.StatusBadRequest,
+	"ReadOnlyMode":            http.StatusServiceUnavailable,
+	"VolumeBackingGone":       http.StatusGone,
+	"VolumeAttachedElsewhere": http.StatusConflict,
+	"QuotaExceeded":           http.StatusForbidden,
+	"VolumeBusy":              http.StatusConflict,
+}
+
+// kindError keeps the message of an error while classifying it as a known
+// kind.
+type kindError struct {
+	error
+	errorKind
+}
+
+// classify returns the kind of err. Errors that are not known are internal
+// errors.
+func classify(err error) errorKind {
+	if k, ok := err.(*kindError); ok {
+		return k.errorKind
+	}
+	if kind := volume.ErrorKind(err); kind != "" {
+		return errorKind{kind, kindCodes[kind]}
+	}
+	return errorKind{"Internal", http.StatusInternalServerError}
+}
+
+// kindFromCode names the kind of an error that only has a status, for
+// example "BadRequest".
+func kindFromCode(code int) string {
+	return strings.Replace(http.StatusText(code), " ", "", -1)
+}
+
+func writeError(w http.ResponseWriter, resp interface{}, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,28 @@
+package apiserver
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+func TestClassify(t *testing.T) {
+	for kind, err := range volume.ErrorKinds {
+		k := classify(err)
+		if k.Kind != kind || k.Code == 0 {
+			t.Errorf("%v classified as %+v, want kind %v with a status", err, k, kind)
+		}
+	}
+	if k := classify(volume.ErrEnoEnt); k.Code != http.StatusNotFound {
+		t.Errorf("Missing volume classified as %+v", k)
+	}
+	err := volume.KindErrorf(volume.ErrFsNotSupported, "xfs is not supported")
+	if k := classify(err); k.Kind != "FilesystemNotSupported" || k.Code != http.StatusBadRequest {
+		t.Errorf("Wrapped error classified as %+v", k)
+	}
+	if k := classify(errors.New("other")); k.Kind != "Internal" || k.Code != http.StatusInternalServerError {
+		t.Errorf("Unknown error classified as %+v", k)
+	}
+}
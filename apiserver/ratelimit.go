@@ -0,0 +1,139 @@
+package apiserver
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit allows Rate requests per second on average with bursts of up to
+// Burst requests.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+	// PerClient gives every client its own bucket instead of one shared by
+	// all clients of the route. See clientKey.
+	PerClient bool
+}
+
+// maxBuckets kept before full buckets, which behave like new ones, are
+// dropped.
+const maxBuckets = 1024
+
+var (
+	rateLimitsLock sync.Mutex
+	rateLimits     = make(map[string]RateLimit)
+	buckets        = make(map[string]*tokenBucket)
+)
+
+func routeKey(verb, path string) string {
+	return verb + " " + path
+}
+
+// SetRateLimit limits requests to the route registered for verb and path,
+// e.g. "POST", "/VolumeDriver.Mount". A zero Rate removes the limit. Routes
+// are not limited by default. Limits apply to running servers at once and
+// start with full buckets.
+func SetRateLimit(verb, path string, limit RateLimit) {
+	rateLimitsLock.Lock()
+	defer rateLimitsLock.Unlock()
+	key := routeKey(verb, path)
+	for k, b := range buckets {
+		if b.route == key {
+			delete(buckets, k)
+		}
+	}
+	if limit.Rate <= 0 {
+		delete(rateLimits, key)
+		return
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	rateLimits[key] = limit
+}
+
+// clientKey identifies the client of r by its remote host. Clients on the
+// unix socket have no address and are told apart by their User-Agent.
+func clientKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if host == "" || host == "@" {
+		return "agent " + r.UserAgent()
+	}
+	return host
+}
+
+// tokenBucket is refilled at limit.Rate tokens per second up to limit.Burst.
+type tokenBucket struct {
+	route  string
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Burst),
+		b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+}
+
+// take a token, or return how long until one is available.
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / b.limit.Rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// allow takes a token from the bucket of r on the route of verb and path.
+// The caller must hold rateLimitsLock.
+func allow(verb, path string, r *http.Request, now time.Time) (bool, time.Duration) {
+	route := routeKey(verb, path)
+	limit, ok := rateLimits[route]
+	if !ok {
+		return true, 0
+	}
+	key := route
+	if limit.PerClient {
+		key += "\x00" + clientKey(r)
+	}
+	b := buckets[key]
+	if b == nil {
+		if len(buckets) >= maxBuckets {
+			for k, old := range buckets {
+				if old.refill(now); old.tokens >= float64(old.limit.Burst) {
+					delete(buckets, k)
+				}
+			}
+		}
+		b = &tokenBucket{route: route, limit: limit, tokens: float64(limit.Burst), last: now}
+		buckets[key] = b
+	}
+	return b.take(now)
+}
+
+// rateLimited rejects requests to fn above the limit set for verb and path
+// with 429 Too Many Requests.
+func rateLimited(verb, path string, fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rateLimitsLock.Lock()
+		ok, wait := allow(verb, path, r, time.Now())
+		rateLimitsLock.Unlock()
+		if !ok {
+			secs := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		fn(w, r)
+	}
+}
@@ -0,0 +1,62 @@
+package apiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {}
+
+func request(h http.HandlerFunc, remote string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("POST", "/VolumeDriver.Mount", nil)
+	r.RemoteAddr = remote
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+func TestRateLimitRunning(t *testing.T) {
+	h := rateLimited("POST", "/VolumeDriver.Mount", okHandler)
+	if w := request(h, "10.0.0.1:1"); w.Code != http.StatusOK {
+		t.Fatalf("Unlimited route returned %v", w.Code)
+	}
+
+	// The limit applies to handlers created before it was set.
+	SetRateLimit("POST", "/VolumeDriver.Mount", RateLimit{Rate: 0.001, Burst: 2})
+	defer SetRateLimit("POST", "/VolumeDriver.Mount", RateLimit{})
+	for i := 0; i < 2; i++ {
+		if w := request(h, "10.0.0.1:1"); w.Code != http.StatusOK {
+			t.Fatalf("Request %d within the burst returned %v", i, w.Code)
+		}
+	}
+	w := request(h, "10.0.0.2:1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Request above the burst returned %v", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Errorf("Retry-After not set")
+	}
+
+	SetRateLimit("POST", "/VolumeDriver.Mount", RateLimit{})
+	if w := request(h, "10.0.0.1:1"); w.Code != http.StatusOK {
+		t.Errorf("Removed limit still applied: %v", w.Code)
+	}
+}
+
+func TestRateLimitPerClient(t *testing.T) {
+	h := rateLimited("POST", "/VolumeDriver.Mount", okHandler)
+	SetRateLimit("POST", "/VolumeDriver.Mount",
+		RateLimit{Rate: 0.001, Burst: 1, PerClient: true})
+	defer SetRateLimit("POST", "/VolumeDriver.Mount", RateLimit{})
+
+	if w := request(h, "10.0.0.1:1"); w.Code != http.StatusOK {
+		t.Fatalf("First request returned %v", w.Code)
+	}
+	if w := request(h, "10.0.0.1:2"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Second request of the same host returned %v", w.Code)
+	}
+	if w := request(h, "10.0.0.2:1"); w.Code != http.StatusOK {
+		t.Errorf("Other client was limited: %v", w.Code)
+	}
+}
@@ -1,20 +1,40 @@
 package apiserver
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"path"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
+
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// ShutdownTimeout is the default time in-flight requests are given to
+// complete on Shutdown.
+const ShutdownTimeout = 30 * time.Second
+
+var (
+	serversLock sync.Mutex
+	servers     []*http.Server
+	draining    int32
 )
 
 type Route struct {
 	verb string
 	path string
 	fn   func(http.ResponseWriter, *http.Request)
+	// req and resp are samples of the JSON request and response bodies,
+	// used to describe the route in /swagger.json.
+	req  interface{}
+	resp interface{}
 }
 
 type restServer interface {
@@ -41,7 +61,14 @@ func (rest *restBase) logReq(request string, id string) *log.Entry {
 }
 func (rest *restBase) sendError(request string, id string, w http.ResponseWriter, msg string, code int) {
 	rest.logReq(request, id).Warn(code, " ", msg)
-	http.Error(w, msg, code)
+	writeError(w, &errorResponse{Err: msg, Code: code, Kind: kindFromCode(code)}, code)
+}
+
+// sendErr responds with the status and kind err is classified as.
+func (rest *restBase) sendErr(request string, id string, w http.ResponseWriter, err error) {
+	k := classify(err)
+	rest.logReq(request, id).Warn(k.Code, " ", err.Error())
+	writeError(w, &errorResponse{Err: err.Error(), Code: k.Code, Kind: k.Kind}, k.Code)
 }
 
 func (rest *restBase) notFound(w http.ResponseWriter, r *http.Request) {
@@ -50,23 +77,33 @@ func (rest *restBase) notFound(w http.ResponseWriter, r *http.Request) {
 }
 
 func (rest *restBase) volNotFound(request string, id string, e error, w http.ResponseWriter) error {
-	err := fmt.Errorf("Failed to locate volume:" + e.Error())
+	err := &kindError{
+		fmt.Errorf("Failed to locate volume:" + e.Error()),
+		classify(volume.ErrEnoEnt),
+	}
 	rest.logReq(request, id).Warn(http.StatusNotFound, " ", err.Error())
 	return err
 }
 
-func startServer(name string, sockBase string, rest restServer) error {
-	var (
-		listener net.Listener
-		err      error
-	)
+// newRouter routes the requests of rest. Routes are matched in order.
+func newRouter(name string, rest restServer) *mux.Router {
 	router := mux.NewRouter()
 	router.NotFoundHandler = http.HandlerFunc(rest.notFound)
 	routes := rest.Routes()
 
 	for _, v := range routes {
-		router.Methods(v.verb).Path(v.path).HandlerFunc(v.fn)
+		router.Methods(v.verb).Path(v.path).HandlerFunc(rateLimited(v.verb, v.path, v.fn))
 	}
+	router.Methods("GET").Path("/swagger.json").HandlerFunc(swaggerHandler(name, routes))
+	return router
+}
+
+func startServer(name string, sockBase string, rest restServer) error {
+	var (
+		listener net.Listener
+		err      error
+	)
+	srv := &http.Server{Handler: drainHandler(newRouter(name, rest))}
 	socket := path.Join(sockBase, name)
 	os.Remove(socket)
 	os.MkdirAll(path.Dir(socket), 0755)
@@ -76,7 +113,42 @@ func startServer(name string, sockBase string, rest restServer) error {
 	if err != nil {
 		return err
 	}
-	go http.Serve(listener, router)
+	serversLock.Lock()
+	servers = append(servers, srv)
+	serversLock.Unlock()
+	go srv.Serve(listener)
+	return err
+}
+
+// drainHandler rejects new requests once Shutdown has been called.
+func drainHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&draining) != 0 {
+			w.Header().Set("Connection", "close")
+			http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Shutdown stops all REST servers. Requests received after this call are
+// rejected with 503, requests in flight are given until timeout to complete
+// before their listeners are closed.
+func Shutdown(timeout time.Duration) error {
+	atomic.StoreInt32(&draining, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	serversLock.Lock()
+	defer serversLock.Unlock()
+	var err error
+	for _, s := range servers {
+		if e := s.Shutdown(ctx); e != nil && err == nil {
+			err = e
+		}
+	}
+	servers = nil
 	return err
 }
 
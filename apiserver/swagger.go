@@ -0,0 +1,165 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var pathParam = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+type swaggerInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type swaggerParam struct {
+	Name     string      `json:"name"`
+	In       string      `json:"in"`
+	Required bool        `json:"required"`
+	Type     string      `json:"type,omitempty"`
+	Schema   interface{} `json:"schema,omitempty"`
+}
+
+type swaggerResponse struct {
+	Description string      `json:"description"`
+	Schema      interface{} `json:"schema,omitempty"`
+}
+
+type swaggerOp struct {
+	Parameters []swaggerParam              `json:"parameters,omitempty"`
+	Responses  map[string]*swaggerResponse `json:"responses"`
+}
+
+// swaggerSpec is an OpenAPI 2.0 document.
+type swaggerSpec struct {
+	Swagger     string                           `json:"swagger"`
+	Info        swaggerInfo                      `json:"info"`
+	Paths       map[string]map[string]*swaggerOp `json:"paths"`
+	Definitions map[string]interface{}           `json:"definitions,omitempty"`
+}
+
+// newSwaggerSpec describes routes. Request and response bodies are derived
+// from the req and resp samples of each Route.
+func newSwaggerSpec(title string, routes []*Route) *swaggerSpec {
+	s := &swaggerSpec{
+		Swagger:     "2.0",
+		Info:        swaggerInfo{Title: title, Version: apiVersion},
+		Paths:       make(map[string]map[string]*swaggerOp),
+		Definitions: make(map[string]interface{}),
+	}
+	for _, r := range routes {
+		p := pathParam.ReplaceAllString(r.path, "{$1}")
+		op := &swaggerOp{Responses: map[string]*swaggerResponse{
+			"200": {Description: "OK"},
+		}}
+		for _, m := range pathParam.FindAllStringSubmatch(r.path, -1) {
+			op.Parameters = append(op.Parameters,
+				swaggerParam{Name: m[1], In: "path", Required: true, Type: "string"})
+		}
+		if r.req != nil {
+			op.Parameters = append(op.Parameters, swaggerParam{
+				Name:     "body",
+				In:       "body",
+				Required: true,
+				Schema:   s.schema(reflect.TypeOf(r.req)),
+			})
+		}
+		if r.resp != nil {
+			op.Responses["200"].Schema = s.schema(reflect.TypeOf(r.resp))
+		}
+		if s.Paths[p] == nil {
+			s.Paths[p] = make(map[string]*swaggerOp)
+		}
+		s.Paths[p][strings.ToLower(r.verb)] = op
+	}
+	return s
+}
+
+// schema returns the JSON schema of t as encoding/json would encode it.
+// Named structs are added to the definitions and referenced.
+func (s *swaggerSpec) schema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": s.schema(t.Elem()),
+		}
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		if _, ok := s.Definitions[t.Name()]; !ok {
+			// Reserve the name first, structs may refer to themselves.
+			s.Definitions[t.Name()] = nil
+			s.Definitions[t.Name()] = s.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+func (s *swaggerSpec) object(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	s.properties(t, props)
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+func (s *swaggerSpec) properties(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		// Untagged embedded structs are flattened like encoding/json does.
+		if f.Anonymous && f.Tag.Get("json") == "" && ft.Kind() == reflect.Struct {
+			s.properties(ft, props)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		props[name] = s.schema(f.Type)
+	}
+}
+
+// swaggerHandler serves the OpenAPI spec of routes.
+func swaggerHandler(title string, routes []*Route) http.HandlerFunc {
+	spec := newSwaggerSpec(title, routes)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(spec)
+	}
+}
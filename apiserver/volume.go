@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 
@@ -19,13 +20,6 @@ type volDriver struct {
 	restBase
 }
 
-func responseStatus(err error) string {
-	if err == nil {
-		return ""
-	}
-	return err.Error()
-}
-
 func newVolumeDriver(name string) restServer {
 	return &volDriver{restBase{version: apiVersion, name: name}}
 }
@@ -64,8 +58,12 @@ func (vd *volDriver) create(w http.ResponseWriter, r *http.Request) {
 		vd.notFound(w, r)
 		return
 	}
+	d = audited(r, d)
 	ID, err := d.Create(dcReq.Locator, dcReq.Options, dcReq.Spec)
-	dcRes.VolumeResponse = api.VolumeResponse{Error: responseStatus(err)}
+	if err != nil {
+		vd.sendErr(vd.name, method, w, err)
+		return
+	}
 	dcRes.ID = ID
 	json.NewEncoder(w).Encode(&dcRes)
 }
@@ -95,11 +93,12 @@ func (vd *volDriver) volumeState(w http.ResponseWriter, r *http.Request) {
 		vd.notFound(w, r)
 		return
 	}
+	d = audited(r, d)
 	for {
 		if req.Format != api.ParamIgnore {
 			if req.Format == api.ParamOff {
-				err = fmt.Errorf("Invalid request to un-format")
-				break
+				vd.sendError(vd.name, method, w, "Invalid request to un-format", http.StatusBadRequest)
+				return
 			}
 			err = d.Format(volumeID)
 			if err != nil {
@@ -121,10 +120,10 @@ func (vd *volDriver) volumeState(w http.ResponseWriter, r *http.Request) {
 		if req.Mount != api.ParamIgnore {
 			if req.Mount == api.ParamOn {
 				if req.MountPath == "" {
-					err = fmt.Errorf("Invalid mount path")
-					break
+					vd.sendError(vd.name, method, w, "Invalid mount path", http.StatusBadRequest)
+					return
 				}
-				err = d.Mount(volumeID, req.MountPath)
+				err = d.Mount(volumeID, req.MountPath, req.MountOptions)
 			} else {
 				err = d.Unmount(volumeID, req.MountPath)
 			}
@@ -138,7 +137,8 @@ func (vd *volDriver) volumeState(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err != nil {
-		resp.Error = err.Error()
+		vd.sendErr(vd.name, method, w, err)
+		return
 	}
 	json.NewEncoder(w).Encode(resp)
 }
@@ -160,7 +160,7 @@ func (vd *volDriver) inspect(w http.ResponseWriter, r *http.Request) {
 	}
 	dk, err := d.Inspect([]api.VolumeID{volumeID})
 	if err != nil {
-		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
+		vd.sendErr(vd.name, method, w, err)
 		return
 	}
 
@@ -183,10 +183,26 @@ func (vd *volDriver) delete(w http.ResponseWriter, r *http.Request) {
 		vd.notFound(w, r)
 		return
 	}
+	d = audited(r, d)
 
-	err = d.Delete(volumeID)
-	res := api.ResponseStatusNew(err)
-	json.NewEncoder(w).Encode(res)
+	recursive := false
+	if v := r.URL.Query().Get(string(api.OptRecursive)); v != "" {
+		if recursive, err = strconv.ParseBool(v); err != nil {
+			e := fmt.Errorf("Failed to parse %s: %s", api.OptRecursive, err.Error())
+			vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if recursive {
+		err = volume.DeleteRecursive(d, volumeID)
+	} else {
+		err = d.Delete(volumeID)
+	}
+	if err != nil {
+		vd.sendErr(vd.name, method, w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(nil))
 }
 
 func (vd *volDriver) enumerate(w http.ResponseWriter, r *http.Request) {
@@ -212,6 +228,7 @@ func (vd *volDriver) enumerate(w http.ResponseWriter, r *http.Request) {
 		if err = json.Unmarshal([]byte(v[0]), &locator.VolumeLabels); err != nil {
 			e := fmt.Errorf("Failed to parse parse VolumeLabels: %s", err.Error())
 			vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+			return
 		}
 	}
 	v = params[string(api.OptConfigLabel)]
@@ -219,6 +236,7 @@ func (vd *volDriver) enumerate(w http.ResponseWriter, r *http.Request) {
 		if err = json.Unmarshal([]byte(v[0]), &configLabels); err != nil {
 			e := fmt.Errorf("Failed to parse parse configLabels: %s", err.Error())
 			vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+			return
 		}
 	}
 	v = params[string(api.OptVolumeID)]
@@ -228,13 +246,12 @@ func (vd *volDriver) enumerate(w http.ResponseWriter, r *http.Request) {
 			ids[i] = api.VolumeID(s)
 		}
 		vols, err = d.Inspect(ids)
-		if err != nil {
-			e := fmt.Errorf("Failed to inspect volumeID: %s", err.Error())
-			vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
-			return
-		}
 	} else {
-		vols, _ = d.Enumerate(locator, configLabels)
+		vols, err = d.Enumerate(locator, configLabels)
+	}
+	if err != nil {
+		vd.sendErr(vd.name, method, w, err)
+		return
 	}
 	json.NewEncoder(w).Encode(vols)
 }
@@ -253,8 +270,12 @@ func (vd *volDriver) snap(w http.ResponseWriter, r *http.Request) {
 		vd.notFound(w, r)
 		return
 	}
-	ID, err := d.Snapshot(snapReq.ID, snapReq.Labels)
-	snapRes.VolumeResponse = api.VolumeResponse{Error: responseStatus(err)}
+	d = audited(r, d)
+	ID, err := volume.Snapshot(d, snapReq.ID, snapReq.Labels)
+	if err != nil {
+		vd.sendErr(vd.name, method, w, err)
+		return
+	}
 	snapRes.ID = ID
 	json.NewEncoder(w).Encode(&snapRes)
 }
@@ -269,18 +290,42 @@ func (vd *volDriver) snapDelete(w http.ResponseWriter, r *http.Request) {
 		vd.notFound(w, r)
 		return
 	}
+	d = audited(r, d)
 	if snapID, err = vd.parseSnapID(r); err != nil {
 		e := fmt.Errorf("Failed to parse SnapID: %s", err.Error())
 		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
 		return
 	}
-	err = d.SnapDelete(snapID)
+	err = volume.SnapDelete(d, snapID)
 	if err != nil {
-		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
+		vd.sendErr(vd.name, method, w, err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(api.VolumeResponse{Error: responseStatus(err)})
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(nil))
+}
+
+func (vd *volDriver) snapPromote(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var snapID api.SnapID
+	var promoteRes api.VolumeCreateResponse
+
+	method := "snapPromote"
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if snapID, err = vd.parseSnapID(r); err != nil {
+		e := fmt.Errorf("Failed to parse SnapID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	if promoteRes.ID, err = volume.PromoteSnapshot(d, snapID); err != nil {
+		vd.sendErr(vd.name, method, w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(&promoteRes)
 }
 
 func (vd *volDriver) snapInspect(w http.ResponseWriter, r *http.Request) {
@@ -300,7 +345,7 @@ func (vd *volDriver) snapInspect(w http.ResponseWriter, r *http.Request) {
 	}
 	dk, err := d.SnapInspect([]api.SnapID{snapID})
 	if err != nil {
-		vd.sendError(vd.name, method, w, err.Error(), http.StatusNotFound)
+		vd.sendErr(vd.name, method, w, err)
 		return
 	}
 
@@ -325,6 +370,7 @@ func (vd *volDriver) snapEnumerate(w http.ResponseWriter, r *http.Request) {
 		if err = json.Unmarshal([]byte(v[0]), &labels); err != nil {
 			e := fmt.Errorf("Failed to parse parse VolumeLabels: %s", err.Error())
 			vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+			return
 		}
 	}
 
@@ -336,8 +382,7 @@ func (vd *volDriver) snapEnumerate(w http.ResponseWriter, r *http.Request) {
 		}
 		snaps, err = d.SnapInspect(sids)
 		if err != nil {
-			e := fmt.Errorf("Failed to inspect snaps: %s", err.Error())
-			vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+			vd.sendErr(vd.name, method, w, err)
 			return
 		}
 	} else {
@@ -351,8 +396,7 @@ func (vd *volDriver) snapEnumerate(w http.ResponseWriter, r *http.Request) {
 
 		snaps, err = d.SnapEnumerate(ids, labels)
 		if err != nil {
-			e := fmt.Errorf("Failed to enumerate snaps: %s", err.Error())
-			vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+			vd.sendErr(vd.name, method, w, err)
 			return
 		}
 	}
@@ -360,10 +404,112 @@ func (vd *volDriver) snapEnumerate(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(snaps)
 }
 
+func (vd *volDriver) reconfigure(w http.ResponseWriter, r *http.Request) {
+	var params volume.DriverParams
+	method := "reconfigure"
+
+	name := mux.Vars(r)["name"]
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d, err := volume.Get(name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if err = volume.Reconfigure(d, params); err != nil {
+		vd.sendErr(vd.name, method, w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(nil))
+}
+
+func (vd *volDriver) setMode(w http.ResponseWriter, r *http.Request) {
+	var req api.DriverModeRequest
+	method := "setMode"
+
+	name := mux.Vars(r)["name"]
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		vd.sendError(vd.name, method, w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d, err := volume.Get(name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if err = volume.SetReadOnly(d, req.ReadOnly); err != nil {
+		vd.sendErr(vd.name, method, w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(api.ResponseStatusNew(nil))
+}
+
+func (vd *volDriver) driverEnumerate(w http.ResponseWriter, r *http.Request) {
+	infos := []api.DriverInfo{}
+	for _, name := range volume.Instances() {
+		// Skip drivers shut down since they were listed.
+		if info, err := volume.Info(name, false); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	json.NewEncoder(w).Encode(infos)
+}
+
+func (vd *volDriver) driverInspect(w http.ResponseWriter, r *http.Request) {
+	info, err := volume.Info(mux.Vars(r)["name"], true)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(info)
+}
+
 func (vd *volDriver) stats(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var err error
+
+	method := "stats"
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	stats, err := d.Stats(volumeID)
+	if err != nil {
+		vd.sendErr(vd.name, method, w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(stats)
 }
 
 func (vd *volDriver) alerts(w http.ResponseWriter, r *http.Request) {
+	var volumeID api.VolumeID
+	var err error
+
+	method := "alerts"
+	d, err := volume.Get(vd.name)
+	if err != nil {
+		vd.notFound(w, r)
+		return
+	}
+	if volumeID, err = vd.parseVolumeID(r); err != nil {
+		e := fmt.Errorf("Failed to parse volumeID: %s", err.Error())
+		vd.sendError(vd.name, method, w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	alerts, err := d.Alerts(volumeID)
+	if err != nil {
+		vd.sendErr(vd.name, method, w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(alerts)
 }
 
 func version(route string) string {
@@ -380,18 +526,31 @@ func snapPath(route string) string {
 
 func (vd *volDriver) Routes() []*Route {
 	return []*Route{
-		&Route{verb: "POST", path: volPath(""), fn: vd.create},
-		&Route{verb: "PUT", path: volPath("/{id}"), fn: vd.volumeState},
-		&Route{verb: "GET", path: volPath(""), fn: vd.enumerate},
-		&Route{verb: "GET", path: volPath("/{id}"), fn: vd.inspect},
-		&Route{verb: "DELETE", path: volPath("/{id}"), fn: vd.delete},
+		&Route{verb: "POST", path: volPath(""), fn: vd.create,
+			req: api.VolumeCreateRequest{}, resp: api.VolumeCreateResponse{}},
+		&Route{verb: "PUT", path: volPath("/{id}"), fn: vd.volumeState,
+			req: api.VolumeStateAction{}, resp: api.VolumeStateResponse{}},
+		&Route{verb: "GET", path: volPath(""), fn: vd.enumerate, resp: []api.Volume{}},
+		// Ahead of "/{id}", which would match them first.
 		&Route{verb: "GET", path: volPath("/stats"), fn: vd.stats},
-		&Route{verb: "GET", path: volPath("/stats/{id}"), fn: vd.stats},
+		&Route{verb: "GET", path: volPath("/stats/{id}"), fn: vd.stats, resp: api.VolumeStats{}},
 		&Route{verb: "GET", path: volPath("/alerts"), fn: vd.alerts},
-		&Route{verb: "GET", path: volPath("/alerts/{id}"), fn: vd.alerts},
-		&Route{verb: "POST", path: snapPath(""), fn: vd.snap},
-		&Route{verb: "GET", path: snapPath(""), fn: vd.snapEnumerate},
-		&Route{verb: "GET", path: snapPath("/{id}"), fn: vd.snapInspect},
-		&Route{verb: "DELETE", path: snapPath("/{id}"), fn: vd.snapDelete},
+		&Route{verb: "GET", path: volPath("/alerts/{id}"), fn: vd.alerts, resp: api.VolumeAlerts{}},
+		&Route{verb: "GET", path: volPath("/{id}"), fn: vd.inspect, resp: []api.Volume{}},
+		&Route{verb: "DELETE", path: volPath("/{id}"), fn: vd.delete, resp: api.VolumeResponse{}},
+		&Route{verb: "POST", path: snapPath(""), fn: vd.snap,
+			req: api.SnapCreateRequest{}, resp: api.SnapCreateResponse{}},
+		&Route{verb: "GET", path: snapPath(""), fn: vd.snapEnumerate, resp: []api.VolumeSnap{}},
+		&Route{verb: "GET", path: snapPath("/{id}"), fn: vd.snapInspect, resp: []api.VolumeSnap{}},
+		&Route{verb: "DELETE", path: snapPath("/{id}"), fn: vd.snapDelete, resp: api.VolumeResponse{}},
+		&Route{verb: "POST", path: snapPath("/promote/{id}"), fn: vd.snapPromote,
+			resp: api.VolumeCreateResponse{}},
+		&Route{verb: "GET", path: version("drivers"), fn: vd.driverEnumerate, resp: []api.DriverInfo{}},
+		&Route{verb: "GET", path: version("drivers/{name}"), fn: vd.driverInspect, resp: api.DriverInfo{}},
+		&Route{verb: "POST", path: version("drivers/{name}/config"), fn: vd.reconfigure,
+			req: volume.DriverParams{}, resp: api.VolumeResponse{}},
+		&Route{verb: "PUT", path: version("drivers/{name}/mode"), fn: vd.setMode,
+			req: api.DriverModeRequest{}, resp: api.VolumeResponse{}},
+		&Route{verb: "GET", path: "/metrics", fn: volume.MetricsHandler},
 	}
 }
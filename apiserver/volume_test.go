@@ -0,0 +1,73 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const testDriver = "apiserver_test"
+
+// fakeDriver implements only what the tests call.
+type fakeDriver struct {
+	volume.VolumeDriver
+}
+
+func (d *fakeDriver) String() string {
+	return testDriver
+}
+
+func (d *fakeDriver) SupportedFilesystems() []api.Filesystem {
+	return []api.Filesystem{api.FsExt4}
+}
+
+func (d *fakeDriver) Create(locator api.VolumeLocator, opt *api.CreateOptions, spec *api.VolumeSpec) (api.VolumeID, error) {
+	if err := volume.ValidateFormat(d, spec.Format); err != nil {
+		return api.BadVolumeID, err
+	}
+	return "fake", nil
+}
+
+func init() {
+	volume.Register(testDriver, volume.File, func(volume.DriverParams) (volume.VolumeDriver, error) {
+		return &fakeDriver{}, nil
+	})
+	if _, err := volume.New(testDriver, nil); err != nil {
+		panic(err)
+	}
+}
+
+func serve(method, url string, body io.Reader) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest(method, url, body)
+	w := httptest.NewRecorder()
+	newRouter(testDriver, newVolumeDriver(testDriver)).ServeHTTP(w, r)
+	return w
+}
+
+func TestStatsWithoutID(t *testing.T) {
+	for _, url := range []string{volPath("/stats"), volPath("/alerts")} {
+		if w := serve("GET", url, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %v without a volume ID returned %v", url, w.Code)
+		}
+	}
+}
+
+func TestCreateUnsupportedFormat(t *testing.T) {
+	for _, format := range []api.Filesystem{api.FsXfs, "unknown"} {
+		body, _ := json.Marshal(&api.VolumeCreateRequest{Spec: &api.VolumeSpec{Format: format}})
+		w := serve("POST", volPath(""), bytes.NewReader(body))
+		var e errorResponse
+		if err := json.NewDecoder(w.Body).Decode(&e); err != nil {
+			t.Fatalf("Failed to decode the error of format %v: %v", format, err)
+		}
+		if w.Code != http.StatusBadRequest || e.Kind != "FilesystemNotSupported" {
+			t.Errorf("Create with format %v returned %v %+v", format, w.Code, e)
+		}
+	}
+}
@@ -75,14 +75,25 @@ func (v *VolDriver) volumeCreate(c *cli.Context) {
 		Name:         c.Args()[0],
 		VolumeLabels: labels,
 	}
+	fs := api.Filesystem(c.String("fs"))
+	if !fs.Valid() {
+		badParameter(c, fn, "fs", "Unknown filesystem format "+string(fs))
+		return
+	}
 	spec := &api.VolumeSpec{
 		Size:             uint64(VolumeSzUnits(c.Int("s")) * MB),
-		Format:           api.Filesystem(c.String("fs")),
+		Format:           fs,
 		BlockSize:        c.Int("b") * 1024,
 		HALevel:          c.Int("r"),
 		Cos:              api.VolumeCos(c.Int("cos")),
 		SnapshotInterval: c.Int("si"),
 	}
+	if t := c.String("tags"); t != "" {
+		if spec.Tags, err = processLabels(t); err != nil {
+			cmdError(c, fn, err)
+			return
+		}
+	}
 	if id, err = v.volDriver.Create(locator, nil, spec); err != nil {
 		cmdError(c, fn, err)
 		return
@@ -108,7 +119,17 @@ func (v *VolDriver) volumeMount(c *cli.Context) {
 
 	}
 
-	err := v.volDriver.Mount(api.VolumeID(volumeID), path)
+	var opts *api.MountOptions
+	if c.Bool("read-only") || c.String("options") != "" || c.String("subpath") != "" {
+		opts = &api.MountOptions{
+			ReadOnly:      c.Bool("read-only"),
+			Options:       c.String("options"),
+			SubPath:       c.String("subpath"),
+			CreateSubPath: c.Bool("create-subpath"),
+		}
+	}
+
+	err := v.volDriver.Mount(api.VolumeID(volumeID), path, opts)
 	if err != nil {
 		cmdError(c, fn, err)
 		return
@@ -214,6 +235,23 @@ func (v *VolDriver) volumeInspect(c *cli.Context) {
 	cmdOutput(c, volumes)
 }
 
+func (v *VolDriver) volumeDescribe(c *cli.Context) {
+	v.volumeOptions(c)
+	fn := "describe"
+	if len(c.Args()) != 1 {
+		missingParameter(c, fn, "volumeID", "Invalid number of arguments")
+		return
+	}
+
+	desc, err := volume.Describe(v.volDriver, api.VolumeID(c.Args()[0]))
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	cmdOutput(c, desc)
+}
+
 func (v *VolDriver) volumeEnumerate(c *cli.Context) {
 	var locator api.VolumeLocator
 	var err error
@@ -245,7 +283,12 @@ func (v *VolDriver) volumeDelete(c *cli.Context) {
 	}
 	volumeID := c.Args()[0]
 	v.volumeOptions(c)
-	err := v.volDriver.Delete(api.VolumeID(volumeID))
+	var err error
+	if c.Bool("recursive") {
+		err = volume.DeleteRecursive(v.volDriver, api.VolumeID(volumeID))
+	} else {
+		err = v.volDriver.Delete(api.VolumeID(volumeID))
+	}
 	if err != nil {
 		cmdError(c, fn, err)
 		return
@@ -323,6 +366,22 @@ func (v *VolDriver) snapDelete(c *cli.Context) {
 	fmtOutput(c, &Format{UUID: []string{c.Args()[0]}})
 }
 
+func (v *VolDriver) snapPromote(c *cli.Context) {
+	fn := "promote"
+	if len(c.Args()) < 1 {
+		missingParameter(c, fn, "snapID", "Invalid number of arguments")
+		return
+	}
+	v.volumeOptions(c)
+	id, err := volume.PromoteSnapshot(v.volDriver, api.SnapID(c.Args()[0]))
+	if err != nil {
+		cmdError(c, fn, err)
+		return
+	}
+
+	fmtOutput(c, &Format{UUID: []string{string(id)}})
+}
+
 func BlockVolumeCommands(name string) []cli.Command {
 	v := &VolDriver{name: name}
 
@@ -338,6 +397,11 @@ func BlockVolumeCommands(name string) []cli.Command {
 					Usage: "Comma separated name=value pairs, e.g name=sqlvolume,type=production",
 					Value: "",
 				},
+				cli.StringFlag{
+					Name:  "tags",
+					Usage: "Comma separated billing tags, e.g cost-center=eng,project=db",
+					Value: "",
+				},
 				cli.IntFlag{
 					Name:  "size,s",
 					Usage: "specify size in MB",
@@ -398,6 +462,22 @@ func BlockVolumeCommands(name string) []cli.Command {
 					Name:  "path",
 					Usage: "destination path at which this volume must be mounted on",
 				},
+				cli.BoolFlag{
+					Name:  "read-only",
+					Usage: "mount the volume read-only",
+				},
+				cli.StringFlag{
+					Name:  "options",
+					Usage: "comma separated mount options, e.g. noatime,nosuid",
+				},
+				cli.StringFlag{
+					Name:  "subpath",
+					Usage: "directory within the volume to mount instead of its root",
+				},
+				cli.BoolFlag{
+					Name:  "create-subpath",
+					Usage: "create the subpath if it does not exist",
+				},
 			},
 		},
 		{
@@ -423,6 +503,12 @@ func BlockVolumeCommands(name string) []cli.Command {
 			Aliases: []string{"rm"},
 			Usage:   "Detach specified volume",
 			Action:  v.volumeDelete,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "recursive,r",
+					Usage: "delete the child volumes of the volume too",
+				},
+			},
 		},
 		{
 			Name:    "enumerate",
@@ -446,6 +532,12 @@ func BlockVolumeCommands(name string) []cli.Command {
 			Usage:   "Inspect volume",
 			Action:  v.volumeInspect,
 		},
+		{
+			Name:    "describe",
+			Aliases: []string{"ds"},
+			Usage:   "Describe volume with its snapshots and stats",
+			Action:  v.volumeDescribe,
+		},
 		{
 			Name:    "snap",
 			Aliases: []string{"sc"},
@@ -486,6 +578,12 @@ func BlockVolumeCommands(name string) []cli.Command {
 			Usage:   "Delete snap",
 			Action:  v.snapDelete,
 		},
+		{
+			Name:    "snapPromote",
+			Aliases: []string{"sp"},
+			Usage:   "Promote snap to an independent volume",
+			Action:  v.snapPromote,
+		},
 	}
 	return commands
 }
@@ -505,6 +603,11 @@ func FileVolumeCommands(name string) []cli.Command {
 					Usage: "Comma separated name=value pairs, e.g name=sqlvolume,type=production",
 					Value: "",
 				},
+				cli.StringFlag{
+					Name:  "tags",
+					Usage: "Comma separated billing tags, e.g cost-center=eng,project=db",
+					Value: "",
+				},
 				cli.IntFlag{
 					Name:  "size,s",
 					Usage: "specify size in MB",
@@ -547,6 +650,22 @@ func FileVolumeCommands(name string) []cli.Command {
 					Name:  "path",
 					Usage: "destination path at which this volume must be mounted on",
 				},
+				cli.BoolFlag{
+					Name:  "read-only",
+					Usage: "mount the volume read-only",
+				},
+				cli.StringFlag{
+					Name:  "options",
+					Usage: "comma separated mount options, e.g. noatime,nosuid",
+				},
+				cli.StringFlag{
+					Name:  "subpath",
+					Usage: "directory within the volume to mount instead of its root",
+				},
+				cli.BoolFlag{
+					Name:  "create-subpath",
+					Usage: "create the subpath if it does not exist",
+				},
 			},
 		},
 		{
@@ -566,6 +685,12 @@ func FileVolumeCommands(name string) []cli.Command {
 			Aliases: []string{"rm"},
 			Usage:   "Detach specified volume",
 			Action:  v.volumeDelete,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "recursive,r",
+					Usage: "delete the child volumes of the volume too",
+				},
+			},
 		},
 		{
 			Name:    "enumerate",
@@ -589,6 +714,12 @@ func FileVolumeCommands(name string) []cli.Command {
 			Usage:   "Inspect volume",
 			Action:  v.volumeInspect,
 		},
+		{
+			Name:    "describe",
+			Aliases: []string{"ds"},
+			Usage:   "Describe volume with its snapshots and stats",
+			Action:  v.volumeDescribe,
+		},
 		{
 			Name:    "snap",
 			Aliases: []string{"sc"},
@@ -629,6 +760,12 @@ func FileVolumeCommands(name string) []cli.Command {
 			Usage:   "Delete snap",
 			Action:  v.snapDelete,
 		},
+		{
+			Name:    "snapPromote",
+			Aliases: []string{"sp"},
+			Usage:   "Promote snap to an independent volume",
+			Action:  v.snapPromote,
+		},
 	}
 	return commands
 }
@@ -26,6 +26,6 @@ func TestAll(t *testing.T) {
 	}
 	d := c.VolumeDriver()
 	ctx := test.NewContext(d)
-	ctx.Filesystem = string(api.FsBtrfs)
+	ctx.Filesystem = api.FsBtrfs
 	test.Run(t, ctx)
 }
@@ -3,6 +3,7 @@ package client
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -11,6 +12,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/libopenstorage/openstorage/volume"
 )
 
 // Request is contructed iteratively by the client and finally dispatched.
@@ -202,17 +205,21 @@ func headerVal(key string, resp *http.Response) (int, bool) {
 	return 0, false
 }
 
+// errorStatus is the body of an error response of the REST server.
+type errorStatus struct {
+	Err  string
+	Code int
+	Kind string
+}
+
 func parseHTTPStatus(resp *http.Response, body []byte) error {
 
-	var (
-		status *Status
-		err    error
-	)
+	var status Status
 
 	httpOK := resp.StatusCode >= http.StatusOK && resp.StatusCode <= http.StatusPartialContent
 	hasStatus := false
 	if body != nil {
-		err = json.Unmarshal(body, status)
+		err := json.Unmarshal(body, &status)
 		if err == nil && status.Message != "" {
 			hasStatus = true
 		}
@@ -227,6 +234,16 @@ func parseHTTPStatus(resp *http.Response, body []byte) error {
 		return nil
 	}
 
+	// Errors of a known kind are returned as the volume error they stand
+	// for, so that callers can compare them.
+	var e errorStatus
+	if body != nil && json.Unmarshal(body, &e) == nil && e.Err != "" {
+		if err, ok := volume.ErrorKinds[e.Kind]; ok {
+			return err
+		}
+		return errors.New(e.Err)
+	}
+
 	// If HTTP status is NG, return an error.
 	return fmt.Errorf("HTTP error %d", resp.StatusCode)
 }
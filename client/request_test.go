@@ -2,8 +2,13 @@ package client
 
 import (
 	"encoding/json"
+	"errors"
+	"net/http"
 	"net/url"
+	"reflect"
 	"testing"
+
+	"github.com/libopenstorage/openstorage/volume"
 )
 
 func TestQueryOptionLabel(t *testing.T) {
@@ -43,3 +48,30 @@ func TestBasic(t *testing.T) {
 
 func init() {
 }
+
+func TestParseHTTPStatus(t *testing.T) {
+	tests := []struct {
+		code int
+		body string
+		want error
+	}{
+		{http.StatusOK, `{"id":"vol"}`, nil},
+		{http.StatusNotFound, `{"Err":"Volume does not exist.","Code":404,"Kind":"VolumeNotFound"}`,
+			volume.ErrEnoEnt},
+		{http.StatusServiceUnavailable, `{"Err":"read-only","Code":503,"Kind":"ReadOnlyMode"}`,
+			volume.ErrReadOnlyMode},
+		{http.StatusInternalServerError, `{"Err":"disk on fire","Code":500,"Kind":"Internal"}`,
+			errors.New("disk on fire")},
+		{http.StatusBadGateway, "", errors.New("HTTP error 502")},
+	}
+	for _, tt := range tests {
+		var body []byte
+		if tt.body != "" {
+			body = []byte(tt.body)
+		}
+		err := parseHTTPStatus(&http.Response{StatusCode: tt.code}, body)
+		if !reflect.DeepEqual(err, tt.want) {
+			t.Errorf("Status %d %s: got %v, want %v", tt.code, tt.body, err, tt.want)
+		}
+	}
+}
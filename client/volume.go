@@ -91,6 +91,22 @@ func (v *volumeClient) Delete(volumeID api.VolumeID) error {
 	return nil
 }
 
+// DeleteRecursive deletes the children of the volume and then the volume.
+func (v *volumeClient) DeleteRecursive(volumeID api.VolumeID) error {
+
+	var response api.VolumeResponse
+
+	err := v.c.Delete().Resource(volumePath).Instance(string(volumeID)).
+		QueryOption(string(api.OptRecursive), "true").Do().Unmarshal(&response)
+	if err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
 // Snap specified volume. IO to the underlying volume should be quiesced before
 // calling this function.
 // Errors ErrEnoEnt may be returned
@@ -126,6 +142,21 @@ func (v *volumeClient) SnapDelete(snapID api.SnapID) error {
 	return nil
 }
 
+// PromoteSnapshot turns snapID into an independent volume.
+// Errors ErrSnapNotFound may be returned
+func (v *volumeClient) PromoteSnapshot(snapID api.SnapID) (api.VolumeID, error) {
+	var response api.VolumeCreateResponse
+
+	err := v.c.Post().Resource(snapPath + "/promote").Instance(string(snapID)).Do().Unmarshal(&response)
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	if response.Error != "" {
+		return api.BadVolumeID, errors.New(response.Error)
+	}
+	return response.ID, nil
+}
+
 // SnapInspect provides details on this snapshot.
 // Errors ErrEnoEnt may be returned
 func (v *volumeClient) SnapInspect(ids []api.SnapID) ([]api.VolumeSnap, error) {
@@ -268,11 +299,12 @@ func (v *volumeClient) Detach(volumeID api.VolumeID) error {
 
 // Mount volume at specified path
 // Errors ErrEnoEnt, ErrVolDetached may be returned.
-func (v *volumeClient) Mount(volumeID api.VolumeID, mountpath string) error {
+func (v *volumeClient) Mount(volumeID api.VolumeID, mountpath string, opts *api.MountOptions) error {
 	var response api.VolumeStateResponse
 	req := api.VolumeStateAction{
-		Mount:     api.ParamOn,
-		MountPath: mountpath,
+		Mount:        api.ParamOn,
+		MountPath:    mountpath,
+		MountOptions: opts,
 	}
 	err := v.c.Put().Resource(volumePath).Instance(string(volumeID)).Body(&req).Do().Unmarshal(&response)
 	if err != nil {
@@ -11,6 +11,8 @@ import (
 
 type osd struct {
 	Drivers map[string]volume.DriverParams
+	// TagKeys allowed in volume tags, volume.DefaultTagKeys if empty.
+	TagKeys []string `yaml:"tag_keys"`
 }
 
 type Config struct {
@@ -3,6 +3,7 @@ package main
 
 import (
 	"github.com/libopenstorage/openstorage/drivers/aws"
+	"github.com/libopenstorage/openstorage/drivers/block"
 	"github.com/libopenstorage/openstorage/drivers/btrfs"
 	"github.com/libopenstorage/openstorage/drivers/nfs"
 	"github.com/libopenstorage/openstorage/volume"
@@ -24,5 +25,8 @@ var (
 		// BTRFS driver. This provisions storage from local btrfs fs.
 		{driverType: volume.File,
 			name: btrfs.Name},
+		// Block driver. This provisions loop devices backed by local files.
+		{driverType: volume.Block,
+			name: block.Name},
 	}
 )
@@ -123,6 +123,11 @@ func (d *awsDriver) Delete(volumeID api.VolumeID) error {
 	return nil
 }
 
+// Capabilities EBS volumes are attached as block devices.
+func (d *awsDriver) Capabilities() volume.Capabilities {
+	return volume.CapBlock
+}
+
 func (d *awsDriver) Snapshot(volumeID api.VolumeID, labels api.Labels) (api.SnapID, error) {
 	return "", volume.ErrNotSupported
 }
@@ -237,13 +242,13 @@ func (d *awsDriver) Detach(volumeID api.VolumeID) error {
 	return err
 }
 
-func (d *awsDriver) Mount(volumeID api.VolumeID, mountpath string) error {
+func (d *awsDriver) Mount(volumeID api.VolumeID, mountpath string, opts *api.MountOptions) error {
 	v, err := d.get(string(volumeID))
 	if err != nil {
 		return err
 	}
 
-	err = syscall.Mount(v.device, mountpath, string(v.spec.Format), 0, "")
+	err = volume.MountWithOptions(v.device, mountpath, string(v.spec.Format), 0, "", opts)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,669 @@
+package block
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/kvdb"
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	Name = "block"
+	// RootParam directory the sparse backing files are created in.
+	RootParam = "home"
+	// CgroupParam cgroup the IO limits of volumes are applied in unless
+	// they set volume.IOCgroupLabel. Volumes without a cgroup are not
+	// throttled.
+	CgroupParam = "cgroup"
+	// QuiesceTimeoutParam duration after which a quiesced volume is thawed
+	// if Unquiesce is not called, volume.DefaultFreezeTimeout if not set.
+	QuiesceTimeoutParam = "quiesce-timeout"
+	// NodeParam name volumes attached on this node are claimed with, the
+	// hostname if not set.
+	NodeParam   = "node"
+	defaultRoot = "/var/lib/openstorage/block"
+)
+
+// Implements the open storage volume interface with loop devices backed by
+// sparse files.
+type blockDriver struct {
+	*volume.DefaultEnumerator
+	root   string
+	cgroup string
+	// node volumes are claimed for on Attach, see volume.ClaimVolume.
+	node   api.MachineID
+	ops    *volume.OpCounter
+	frozen *volume.Freezer
+	// roMounts are mounts made in read-only mode, which are not recorded.
+	roMounts volume.SubPathMounts
+	// createLock serializes Create while existing volumes are checked.
+	createLock sync.Mutex
+}
+
+func uuid() (string, error) {
+	out, err := exec.Command("uuidgen").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// run executes name and returns its trimmed output, or its stderr in the
+// error if it fails.
+func run(name string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%v %v failed: %v: %s",
+			name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func Init(params volume.DriverParams) (volume.VolumeDriver, error) {
+	root := params[RootParam]
+	if root == "" {
+		root = defaultRoot
+	}
+	if err := os.MkdirAll(root, 0744); err != nil {
+		return nil, err
+	}
+	if _, err := exec.LookPath("losetup"); err != nil {
+		return nil, fmt.Errorf("The block driver requires losetup: %v", err)
+	}
+	cgroup := params[CgroupParam]
+	timeout := volume.DefaultFreezeTimeout
+	if v, ok := params[QuiesceTimeoutParam]; ok {
+		var err error
+		if timeout, err = time.ParseDuration(v); err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("Invalid %s %q", QuiesceTimeoutParam, v)
+		}
+	}
+	node := params[NodeParam]
+	if node == "" {
+		var err error
+		if node, err = os.Hostname(); err != nil {
+			return nil, err
+		}
+	}
+	if err := volume.MigrateNamespaceOnRequest(kvdb.Instance(), params, Name); err != nil {
+		return nil, err
+	}
+	inst := &blockDriver{
+		DefaultEnumerator: volume.NewNamespacedEnumerator(
+			params[volume.NamespaceParam], Name, kvdb.Instance()),
+		root:   root,
+		cgroup: cgroup,
+		node:   api.MachineID(node),
+		ops:    volume.NewOpCounter(),
+		frozen: volume.NewFreezer(timeout),
+	}
+	log.Infof("Block driver initialized with backing files in %s", root)
+	return inst, nil
+}
+
+func (d *blockDriver) String() string {
+	return Name
+}
+
+// SupportedFilesystems formats mkfs is run with, FsNone leaves the device
+// unformatted.
+func (d *blockDriver) SupportedFilesystems() []api.Filesystem {
+	return []api.Filesystem{api.FsExt4, api.FsXfs, api.FsBtrfs, api.FsNone}
+}
+
+// Capabilities volumes are loop devices, snapshots fall back to a copy.
+func (d *blockDriver) Capabilities() volume.Capabilities {
+	return volume.CapBlock
+}
+
+// Version of the backing file layout.
+func (d *blockDriver) Version() api.DriverVersion {
+	return api.DriverVersion{Driver: Name, Version: "1.0.0"}
+}
+
+// Status diagnostic information
+func (d *blockDriver) Status() [][2]string {
+	status := [][2]string{
+		{"Home", d.root},
+		d.ModeStatus(),
+		volume.VersionStatus(d.Version()),
+		{"IO Cgroup", cgroupStatus(d.cgroup)},
+	}
+	vols, err := d.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		return status
+	}
+	throttled := 0
+	for _, v := range vols {
+		if l, err := volume.GetIOLimits(v.Spec); err == nil && l.Limited() {
+			throttled++
+		}
+	}
+	return append(status, [2]string{"Throttled Volumes", strconv.Itoa(throttled)})
+}
+
+// backingFile of volumeID.
+func (d *blockDriver) backingFile(volumeID api.VolumeID) string {
+	return path.Join(d.root, string(volumeID)+".img")
+}
+
+// loopDevice returns the loop device file is attached to, if any.
+func loopDevice(file string) (string, error) {
+	out, err := run("losetup", "-j", file)
+	if err != nil || out == "" {
+		return "", err
+	}
+	// /dev/loop0: [2049]:1234 (/path/to/file)
+	return strings.SplitN(out, ":", 2)[0], nil
+}
+
+// Create a sparse backing file of spec.Size. The device is formatted by
+// Format once it is attached.
+func (d *blockDriver) Create(locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (id api.VolumeID, err error) {
+
+	defer func() { d.ops.Record(volume.OpCreate, err) }()
+	if err = d.CheckWritable(); err != nil {
+		return api.BadVolumeID, err
+	}
+	if spec.Size == 0 {
+		return api.BadVolumeID, errors.New("Volume size must be specified")
+	}
+	format := spec.Format
+	if format == "" {
+		format = api.FsExt4
+	}
+	if err = volume.ValidateFormat(d, format); err != nil {
+		return api.BadVolumeID, err
+	}
+	if _, err = volume.GetIOLimits(spec); err != nil {
+		return api.BadVolumeID, err
+	}
+	if _, err = volume.GetIOCgroup(spec, ""); err != nil {
+		return api.BadVolumeID, err
+	}
+	if err = volume.ValidateTags(spec.Tags); err != nil {
+		return api.BadVolumeID, err
+	}
+
+	// Held until the backing file is sized and recorded.
+	d.createLock.Lock()
+	defer d.createLock.Unlock()
+	if options != nil && options.Idempotent {
+		if id, ok, err := volume.VolumeExists(d, locator); err != nil || ok {
+			return id, err
+		}
+	}
+	if volume.IsNameTemplate(locator.Name) {
+		name, release, err := volume.UniqueName(d, locator.Name, time.Now())
+		if err != nil {
+			return api.BadVolumeID, err
+		}
+		defer release()
+		locator.Name = name
+	}
+
+	volumeID, err := uuid()
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	v := &api.Volume{
+		ID:       api.VolumeID(volumeID),
+		Locator:  locator,
+		Ctime:    time.Now(),
+		Spec:     spec,
+		LastScan: time.Now(),
+		Format:   format,
+		State:    api.VolumeAvailable,
+		Tags:     spec.Tags,
+	}
+	file := d.backingFile(v.ID)
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	err = f.Truncate(int64(spec.Size))
+	f.Close()
+	if err == nil {
+		err = d.CreateVol(v)
+	}
+	if err != nil {
+		os.Remove(file)
+		return api.BadVolumeID, err
+	}
+	return v.ID, nil
+}
+
+// Delete the backing file. The volume must be detached.
+func (d *blockDriver) Delete(volumeID api.VolumeID) (err error) {
+	defer func() { d.ops.Record(volume.OpDelete, err) }()
+	if err = d.CheckWritable(); err != nil {
+		return err
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.DevicePath != "" {
+		return volume.ErrVolAttached
+	}
+	if err = d.DeleteVol(volumeID); err != nil {
+		return err
+	}
+	if err = os.Remove(d.backingFile(volumeID)); os.IsNotExist(err) {
+		err = nil
+	}
+	return err
+}
+
+// Attach claims the volume for this node and sets up a loop device for the
+// backing file. A volume that is already attached returns its loop device.
+// Errors ErrVolumeAttachedElsewhere if another node holds the volume.
+func (d *blockDriver) Attach(volumeID api.VolumeID) (string, error) {
+	if err := d.CheckWritable(); err != nil {
+		return "", err
+	}
+	if err := d.ClaimVolume(volumeID, d.node); err != nil {
+		return "", err
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return "", err
+	}
+	dev, err := d.attach(v)
+	if err != nil && v.DevicePath == "" {
+		d.ReleaseVolume(volumeID, d.node)
+	}
+	return dev, err
+}
+
+func (d *blockDriver) attach(v *api.Volume) (string, error) {
+	file := d.backingFile(v.ID)
+	// Loop devices do not survive a reboot, the record may be stale.
+	dev, err := loopDevice(file)
+	if err != nil {
+		return "", err
+	}
+	if dev == "" {
+		if dev, err = run("losetup", "--find", "--show", file); err != nil {
+			return "", err
+		}
+	}
+	if v.DevicePath != dev {
+		v.DevicePath = dev
+		v.State = api.VolumeAttached
+		if err = d.UpdateVol(v); err != nil {
+			return "", err
+		}
+	}
+	return dev, nil
+}
+
+// Format runs mkfs for the volume's format on its loop device, or on the
+// backing file if it is detached. A volume that already has a filesystem of
+// its format is not formatted again, one of another format is an error.
+func (d *blockDriver) Format(volumeID api.VolumeID) error {
+	if err := d.CheckWritable(); err != nil {
+		return err
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	target := v.DevicePath
+	if target == "" {
+		target = d.backingFile(volumeID)
+	}
+	if v.AttachPath != "" {
+		return fmt.Errorf("Volume %v is mounted at %v", volumeID, v.AttachPath)
+	}
+	if v.Format == api.FsNone {
+		return nil
+	}
+	// blkid exits 2 if there is no filesystem.
+	if fs, _ := run("blkid", "-o", "value", "-s", "TYPE", target); fs != "" {
+		if fs == string(v.Format) {
+			return nil
+		}
+		return fmt.Errorf("Volume %v is already formatted with %v", volumeID, fs)
+	}
+	force := "-F"
+	if v.Format != api.FsExt4 {
+		force = "-f"
+	}
+	_, err = run("mkfs."+string(v.Format), force, target)
+	return err
+}
+
+// Detach tears down the loop device and releases the claim of this node on
+// the volume. The volume must be unmounted.
+// Errors ErrVolumeAttachedElsewhere if another node holds the volume.
+func (d *blockDriver) Detach(volumeID api.VolumeID) error {
+	if err := d.CheckWritable(); err != nil {
+		return err
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.AttachedOn != "" && v.AttachedOn != d.node {
+		return volume.ErrVolumeAttachedElsewhere
+	}
+	if v.DevicePath == "" {
+		return volume.ErrVolDetached
+	}
+	if v.AttachPath != "" {
+		return fmt.Errorf("Volume %v is mounted at %v", volumeID, v.AttachPath)
+	}
+	if dev, err := loopDevice(d.backingFile(volumeID)); err != nil {
+		return err
+	} else if dev != "" {
+		// The loop device is reused by other volumes.
+		if l, _ := volume.GetIOLimits(v.Spec); l.Limited() {
+			if cgroup := d.ioCgroup(v); cgroup != "" {
+				if err = volume.ApplyIOLimits(cgroup, dev, volume.IOLimits{}); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err = run("losetup", "-d", dev); err != nil {
+			return err
+		}
+	}
+	v.DevicePath = ""
+	v.State = api.VolumeAvailable
+	if err = d.UpdateVol(v); err != nil {
+		return err
+	}
+	return d.ReleaseVolume(volumeID, d.node)
+}
+
+// Mount the loop device at mountpath. The volume must be attached and
+// formatted.
+func (d *blockDriver) Mount(
+	volumeID api.VolumeID,
+	mountpath string,
+	opts *api.MountOptions) (err error) {
+
+	defer func() { d.ops.Record(volume.OpMount, err) }()
+	if err = d.CheckMount(opts); err != nil {
+		return err
+	}
+	if opts != nil && opts.SubPath != "" {
+		return volume.ErrNotSupported
+	}
+	v, err := d.GetVolVerified(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.DevicePath == "" {
+		return volume.ErrVolDetached
+	}
+	if v.AttachPath != "" || d.roMounts.Count(volumeID) > 0 {
+		return volume.ErrVolumeBusy
+	}
+	if v.Format == api.FsNone {
+		return fmt.Errorf("Volume %v has no filesystem", volumeID)
+	}
+	if l, err := volume.GetIOLimits(v.Spec); err != nil {
+		return err
+	} else if l.Limited() {
+		if err = d.applyIOLimits(v, l); err != nil {
+			return err
+		}
+	}
+	err = volume.MountWithOptions(v.DevicePath, mountpath, string(v.Format), 0, "", opts)
+	if err != nil {
+		return &volume.MountError{Source: v.DevicePath, Target: mountpath, Err: err}
+	}
+	if d.ReadOnly() {
+		d.roMounts.Add(volumeID, mountpath)
+		return nil
+	}
+	v.AttachPath = mountpath
+	return d.UpdateVol(v)
+}
+
+// Unmount the volume.
+func (d *blockDriver) Unmount(volumeID api.VolumeID, mountpath string) (err error) {
+	defer func() { d.ops.Record(volume.OpUnmount, err) }()
+	if mountpath != "" && d.roMounts.Has(volumeID, mountpath) {
+		if err = syscall.Unmount(mountpath, 0); err != nil {
+			return err
+		}
+		d.roMounts.Remove(volumeID, mountpath)
+		return nil
+	}
+	if err = d.CheckWritable(); err != nil {
+		return err
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.AttachPath == "" {
+		return fmt.Errorf("Device %v not mounted", volumeID)
+	}
+	if mountpath != "" && mountpath != v.AttachPath {
+		return fmt.Errorf("Device %v not mounted at %v", volumeID, mountpath)
+	}
+	if err = d.frozen.Thaw(volumeID); err != nil {
+		return err
+	}
+	if err = syscall.Unmount(v.AttachPath, 0); err != nil {
+		return err
+	}
+	v.AttachPath = ""
+	return d.UpdateVol(v)
+}
+
+// CheckVolume runs fsck on the loop device, or on the backing file if the
+// volume is detached.
+func (d *blockDriver) CheckVolume(volumeID api.VolumeID, repair bool) (api.FsckResult, error) {
+	if repair {
+		if err := d.CheckWritable(); err != nil {
+			return api.FsckResult{}, err
+		}
+	}
+	v, err := d.GetVolVerified(volumeID)
+	if err != nil {
+		return api.FsckResult{}, err
+	}
+	if v.AttachPath != "" || d.roMounts.Count(volumeID) > 0 {
+		return api.FsckResult{}, volume.ErrVolumeBusy
+	}
+	target := v.DevicePath
+	if target == "" {
+		target = d.backingFile(volumeID)
+	}
+	log.Infof("Checking volume %v on %v, repair %v", volumeID, target, repair)
+	return volume.Fsck(v.Format, target, repair)
+}
+
+// ForceRelease detaches the volume's mount, tears down its loop device and
+// clears its attach state and claim even if Unmount and Detach would fail.
+func (d *blockDriver) ForceRelease(volumeID api.VolumeID) error {
+	if err := d.CheckWritable(); err != nil {
+		return err
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	d.frozen.Thaw(volumeID)
+	err = volume.ForceUnmount(volumeID, v.AttachPath)
+	dev, lerr := loopDevice(d.backingFile(volumeID))
+	if lerr == nil && dev != "" {
+		if cgroup := d.ioCgroup(v); cgroup != "" {
+			volume.ApplyIOLimits(cgroup, dev, volume.IOLimits{})
+		}
+		// A lazily unmounted device is released by the kernel once the last
+		// user is gone, -d only flags it for autoclear if it is busy.
+		if _, lerr = run("losetup", "-d", dev); lerr == nil {
+			log.Infof("Force released volume %v: detached loop device %v", volumeID, dev)
+		}
+	}
+	if lerr != nil {
+		log.Warnf("Force releasing volume %v: %v", volumeID, lerr)
+		if err == nil {
+			err = lerr
+		}
+	}
+	v.AttachPath = ""
+	v.DevicePath = ""
+	v.AttachedOn = ""
+	v.State = api.VolumeAvailable
+	if uerr := d.UpdateVol(v); err == nil {
+		err = uerr
+	}
+	log.Infof("Force released volume %v", volumeID)
+	return err
+}
+
+// ioCgroup returns the cgroup the IO limits of v are applied in, empty if
+// there is none.
+func (d *blockDriver) ioCgroup(v *api.Volume) string {
+	cgroup, err := volume.GetIOCgroup(v.Spec, d.cgroup)
+	if err != nil {
+		log.Warnf("Volume %v: %v", v.ID, err)
+		return ""
+	}
+	return cgroup
+}
+
+// applyIOLimits applies l to the loop device of v. Without a cgroup to
+// apply them in the volume is not throttled.
+func (d *blockDriver) applyIOLimits(v *api.Volume, l volume.IOLimits) error {
+	cgroup := d.ioCgroup(v)
+	if cgroup == "" {
+		log.Warnf("Volume %v has IO limits but no cgroup is configured, "+
+			"set %v or the %v label to throttle it",
+			v.ID, CgroupParam, volume.IOCgroupLabel)
+		return nil
+	}
+	return volume.ApplyIOLimits(cgroup, v.DevicePath, l)
+}
+
+func cgroupStatus(cgroup string) string {
+	if cgroup == "" {
+		return "none"
+	}
+	return cgroup
+}
+
+// SetIOLimits stores limits in the volume's spec and applies them to its
+// loop device if it is mounted.
+func (d *blockDriver) SetIOLimits(volumeID api.VolumeID, limits volume.IOLimits) error {
+	if err := d.CheckWritable(); err != nil {
+		return err
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if v.AttachPath != "" {
+		if err = d.applyIOLimits(v, limits); err != nil {
+			return err
+		}
+	}
+	if v.Spec == nil {
+		v.Spec = &api.VolumeSpec{}
+	}
+	volume.SetIOLimitLabels(v.Spec, limits)
+	return d.UpdateVol(v)
+}
+
+// Quiesce freezes the filesystems of the mounted volumes in volumeIDs. They
+// are thawed by Unquiesce or after the quiesce timeout.
+func (d *blockDriver) Quiesce(volumeIDs []api.VolumeID) error {
+	for i, id := range volumeIDs {
+		v, err := d.GetVol(id)
+		if err == nil && v.AttachPath != "" {
+			err = d.frozen.Freeze(id, v.AttachPath)
+		}
+		if err != nil {
+			d.Unquiesce(volumeIDs[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+// Unquiesce thaws the filesystems of volumeIDs.
+func (d *blockDriver) Unquiesce(volumeIDs []api.VolumeID) error {
+	var first error
+	for _, id := range volumeIDs {
+		if err := d.frozen.Thaw(id); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Snapshot is not native, volume.Snapshot copies the device instead.
+func (d *blockDriver) Snapshot(volumeID api.VolumeID, labels api.Labels) (api.SnapID, error) {
+	return api.BadSnapID, volume.ErrNotSupported
+}
+
+func (d *blockDriver) SnapDelete(snapID api.SnapID) error {
+	return volume.ErrNotSupported
+}
+
+// Stats LogicalBytes is the space used in the filesystem if the volume is
+// mounted, PhysicalBytes the space allocated to the sparse backing file.
+func (d *blockDriver) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return api.VolumeStats{}, err
+	}
+	var stats api.VolumeStats
+	var st syscall.Stat_t
+	if err = syscall.Stat(d.backingFile(volumeID), &st); err != nil {
+		return stats, err
+	}
+	stats.PhysicalBytes = uint64(st.Blocks) * 512
+	if v.AttachPath != "" {
+		var fs syscall.Statfs_t
+		if err = syscall.Statfs(v.AttachPath, &fs); err != nil {
+			return stats, err
+		}
+		stats.LogicalBytes = (fs.Blocks - fs.Bfree) * uint64(fs.Bsize)
+	}
+	return stats, nil
+}
+
+func (d *blockDriver) Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error) {
+	return api.VolumeAlerts{}, volume.ErrNotSupported
+}
+
+// Metrics operation counts.
+func (d *blockDriver) Metrics() []api.Metric {
+	return d.ops.Metrics()
+}
+
+func (d *blockDriver) Shutdown() {
+	log.Printf("%s Shutting down", Name)
+	d.frozen.ThawAll()
+}
+
+func init() {
+	// Register ourselves as an openstorage volume driver.
+	volume.Register(Name, volume.Block, Init)
+}
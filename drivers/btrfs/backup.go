@@ -0,0 +1,317 @@
+package btrfs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	// stagingDir holds temporary subvolumes used by send and receive.
+	stagingDir = "staging"
+	// sendMagic starts a btrfs send stream. Streams written before backups
+	// had a version header start with it.
+	sendMagic = "btrfs-stream\x00"
+	// RestoredLabel is set on the snapshot Restore keeps of what it received.
+	RestoredLabel = "restored"
+	// BackupVersionParam set to "true" starts backups with the driver
+	// version as a JSON line ahead of the btrfs send stream, which Restore
+	// checks for compatibility. Such backups cannot be fed to btrfs receive
+	// as they are, so they are plain send streams by default.
+	BackupVersionParam = "backup_version"
+)
+
+// driverVersion of the subvolume layout and the backup stream, see
+// BackupVersionParam.
+var driverVersion = api.DriverVersion{
+	Driver:   Name,
+	Version:  "1.0.0",
+	Features: []string{"send-stream-v1"},
+}
+
+// Version of the subvolume layout and backup stream.
+func (d *btrfsDriver) Version() api.DriverVersion {
+	return driverVersion
+}
+
+func btrfsCmd(stdin io.Reader, stdout io.Writer, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("btrfs", args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("btrfs %v failed: %v: %s", args, err, stderr.String())
+	}
+	return nil
+}
+
+func deleteSubvolume(p string) error {
+	return btrfsCmd(nil, nil, "subvolume", "delete", p)
+}
+
+func setReadOnly(p string, ro bool) error {
+	return btrfsCmd(nil, nil, "property", "set", "-ts", p, "ro", fmt.Sprintf("%v", ro))
+}
+
+func isReadOnly(p string) (bool, error) {
+	var out bytes.Buffer
+	if err := btrfsCmd(nil, &out, "property", "get", "-ts", p, "ro"); err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out.String()) == "ro=true", nil
+}
+
+// holdReadOnly makes p read-only and returns the function that restores its
+// original flag.
+func holdReadOnly(p string) (func(), error) {
+	ro, err := isReadOnly(p)
+	if err != nil {
+		return nil, err
+	}
+	if ro {
+		return func() {}, nil
+	}
+	if err = setReadOnly(p, true); err != nil {
+		return nil, err
+	}
+	return func() { setReadOnly(p, false) }, nil
+}
+
+// staging returns a new unique path in the staging area.
+func (d *btrfsDriver) staging() (string, error) {
+	dir := path.Join(d.root, Volumes, stagingDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	id, err := uuid()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, id), nil
+}
+
+// backupSource returns the subvolume of id, the volume it belongs to and
+// whether id is a snapshot rather than a volume.
+func (d *btrfsDriver) backupSource(id api.VolumeID) (string, api.VolumeID, bool, error) {
+	isSnap := false
+	volumeID := id
+	if _, err := d.GetVol(id); err != nil {
+		snap, serr := d.GetSnap(api.SnapID(id))
+		if serr != nil {
+			return "", "", false, err
+		}
+		isSnap = true
+		volumeID = snap.VolumeID
+	}
+	p, err := d.btrfs.Get(string(id), "")
+	return p, volumeID, isSnap, err
+}
+
+// send streams id to dest, relative to parent if it is not empty. A volume
+// is sent from a temporary read-only snapshot, a snapshot is sent itself so
+// that the receiving side can use it as the parent of later streams.
+func (d *btrfsDriver) send(id api.VolumeID, parent string, dest io.Writer) error {
+	src, _, isSnap, err := d.backupSource(id)
+	if err != nil {
+		return err
+	}
+	if isSnap {
+		release, err := holdReadOnly(src)
+		if err != nil {
+			return err
+		}
+		defer release()
+	} else {
+		snap, err := d.staging()
+		if err != nil {
+			return err
+		}
+		err = btrfsCmd(nil, nil, "subvolume", "snapshot", "-r", src, snap)
+		if err != nil {
+			return err
+		}
+		defer deleteSubvolume(snap)
+		src = snap
+	}
+
+	if d.backupVersion {
+		if err = json.NewEncoder(dest).Encode(&driverVersion); err != nil {
+			return err
+		}
+	}
+	args := []string{"send"}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+	args = append(args, src)
+	return btrfsCmd(nil, dest, args...)
+}
+
+// Backup streams the contents of volumeID to dest using btrfs send.
+// volumeID may also be a snapshot, the backup of which can be restored as the
+// base of incremental backups taken since that snapshot.
+func (d *btrfsDriver) Backup(volumeID api.VolumeID, dest io.Writer) error {
+	return d.send(volumeID, "", dest)
+}
+
+// BackupIncremental streams the changes to volumeID, a volume or a snapshot,
+// since sinceSnapID to dest using btrfs send with the snapshot as parent.
+func (d *btrfsDriver) BackupIncremental(
+	volumeID api.VolumeID,
+	sinceSnapID api.SnapID,
+	dest io.Writer) error {
+
+	_, ofVolume, _, err := d.backupSource(volumeID)
+	if err != nil {
+		return err
+	}
+	snap, err := d.GetSnap(sinceSnapID)
+	if err != nil {
+		return err
+	}
+	if snap.VolumeID != ofVolume {
+		return fmt.Errorf("Snap %v is not a snapshot of volume %v", sinceSnapID, ofVolume)
+	}
+	parent, err := d.btrfs.Get(string(sinceSnapID), "")
+	if err != nil {
+		return err
+	}
+	// The parent of a send must stay read-only for the duration of the send.
+	release, err := holdReadOnly(parent)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return d.send(volumeID, parent, dest)
+}
+
+// Restore creates a new volume from a stream written by Backup or
+// BackupIncremental using btrfs receive, with or without a version line. The parent of an incremental stream
+// must be a snapshot restored earlier, or the snapshot it was taken since.
+// The received subvolume is kept as a read-only snapshot of the volume,
+// labelled RestoredLabel.
+func (d *btrfsDriver) Restore(src io.Reader) (api.VolumeID, error) {
+	if err := d.CheckWritable(); err != nil {
+		return api.BadVolumeID, err
+	}
+	br := bufio.NewReader(src)
+	if magic, err := br.Peek(len(sendMagic)); err != nil {
+		return api.BadVolumeID, fmt.Errorf("Failed to read backup stream: %v", err)
+	} else if string(magic) != sendMagic {
+		line, err := br.ReadBytes('\n')
+		if err != nil {
+			return api.BadVolumeID, fmt.Errorf("Failed to read backup version: %v", err)
+		}
+		var version api.DriverVersion
+		if err = json.Unmarshal(line, &version); err != nil {
+			return api.BadVolumeID, fmt.Errorf("Failed to parse backup version: %v", err)
+		}
+		if err = volume.CheckCompatible(driverVersion, version); err != nil {
+			return api.BadVolumeID, err
+		}
+	}
+	recv, err := d.staging()
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	if err = os.MkdirAll(recv, 0755); err != nil {
+		return api.BadVolumeID, err
+	}
+	defer os.RemoveAll(recv)
+	if err = btrfsCmd(br, nil, "receive", recv); err != nil {
+		return api.BadVolumeID, err
+	}
+	entries, err := ioutil.ReadDir(recv)
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	if len(entries) != 1 {
+		return api.BadVolumeID, fmt.Errorf("Expected one subvolume in stream, found %v",
+			len(entries))
+	}
+	received := path.Join(recv, entries[0].Name())
+
+	volumeID, err := uuid()
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	v := &api.Volume{
+		ID:       api.VolumeID(volumeID),
+		Ctime:    time.Now(),
+		Spec:     &api.VolumeSpec{Format: api.FsBtrfs},
+		LastScan: time.Now(),
+		Format:   api.FsBtrfs,
+		State:    api.VolumeAvailable,
+	}
+	if err = d.CreateVol(v); err != nil {
+		return api.BadVolumeID, err
+	}
+	// Let the graph driver allocate the subvolume path, then replace the
+	// empty subvolume with a writable snapshot of the received one.
+	if err = d.btrfs.Create(volumeID, ""); err == nil {
+		v.DevicePath, err = d.btrfs.Get(volumeID, "")
+	}
+	if err == nil {
+		err = deleteSubvolume(v.DevicePath)
+	}
+	if err == nil {
+		err = btrfsCmd(nil, nil, "subvolume", "snapshot", received, v.DevicePath)
+	}
+	if err == nil {
+		err = d.UpdateVol(v)
+	}
+	if err == nil {
+		err = d.keepReceived(v.ID, received)
+	}
+	if err != nil {
+		deleteSubvolume(received)
+		d.DeleteVol(v.ID)
+		d.btrfs.Remove(volumeID)
+		return api.BadVolumeID, err
+	}
+	return v.ID, nil
+}
+
+// keepReceived moves the read-only subvolume received by Restore into a
+// snapshot of volumeID. It keeps the identity of the subvolume that was
+// sent, so later incremental streams relative to it can be received.
+func (d *btrfsDriver) keepReceived(volumeID api.VolumeID, received string) error {
+	snapID, err := uuid()
+	if err != nil {
+		return err
+	}
+	if err = d.btrfs.Create(snapID, ""); err != nil {
+		return err
+	}
+	p, err := d.btrfs.Get(snapID, "")
+	if err == nil {
+		err = deleteSubvolume(p)
+	}
+	if err == nil {
+		err = os.Rename(received, p)
+	}
+	if err == nil {
+		err = d.CreateSnap(&api.VolumeSnap{
+			ID:         api.SnapID(snapID),
+			VolumeID:   volumeID,
+			SnapLabels: api.Labels{RestoredLabel: "true"},
+			Ctime:      time.Now(),
+		})
+	}
+	if err != nil {
+		d.btrfs.Remove(snapID)
+	}
+	return err
+}
@@ -1,13 +1,18 @@
 package btrfs
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	log "github.com/Sirupsen/logrus"
+
 	graph "github.com/docker/docker/daemon/graphdriver"
 	"github.com/docker/docker/daemon/graphdriver/btrfs"
 
@@ -21,6 +26,9 @@ const (
 	Name      = "btrfs"
 	RootParam = "home"
 	Volumes   = "volumes"
+
+	// alertInterval between background capacity alert checks.
+	alertInterval = time.Minute
 )
 
 var (
@@ -33,6 +41,25 @@ type btrfsDriver struct {
 	*volume.DefaultEnumerator
 	btrfs graph.Driver
 	root  string
+	// devices and raid profile the filesystem was set up with, if any.
+	devices []string
+	raid    string
+	ops     *volume.OpCounter
+	alerts  *volume.CapacityAlerter
+	// snapMounts read-only mounts made by MountSnap.
+	snapMounts snapMounts
+	// roMounts are mounts made in read-only mode, which are not recorded.
+	roMounts volume.SubPathMounts
+	broker   *volume.AlertBroker
+	scrub    scrubber
+	qgroups  qgroupCache
+	// promotions in progress, reported in Status.
+	promotions promotions
+	stop       chan struct{}
+	// backupVersion true if backups start with the driver version.
+	backupVersion bool
+	// createLock serializes Create while existing volumes are checked.
+	createLock sync.Mutex
 }
 
 func uuid() (string, error) {
@@ -50,32 +77,130 @@ func Init(params volume.DriverParams) (volume.VolumeDriver, error) {
 	if !ok {
 		return nil, fmt.Errorf("Root directory should be specified with key %q", RootParam)
 	}
+	devs, profile, err := parseDevices(params[DevicesParam], params[RaidParam])
+	if err != nil {
+		return nil, err
+	}
+	if len(devs) > 0 {
+		if err = setupDevices(root, devs, profile); err != nil {
+			return nil, err
+		}
+	}
+	var scrubInterval time.Duration
+	if v, ok := params[ScrubIntervalParam]; ok {
+		if scrubInterval, err = time.ParseDuration(v); err != nil || scrubInterval <= 0 {
+			return nil, fmt.Errorf("Invalid %v %q", ScrubIntervalParam, v)
+		}
+	}
 	home := path.Join(root, Volumes)
 	d, err := btrfs.Init(home, nil)
 	if err != nil {
 		return nil, err
 	}
-	s := volume.NewDefaultEnumerator(Name, kvdb.Instance())
-	return &btrfsDriver{btrfs: d, root: root, DefaultEnumerator: s}, nil
+	if err = volume.MigrateNamespaceOnRequest(kvdb.Instance(), params, Name); err != nil {
+		return nil, err
+	}
+	s := volume.NewNamespacedEnumerator(params[volume.NamespaceParam], Name, kvdb.Instance())
+	inst := &btrfsDriver{
+		btrfs:             d,
+		root:              root,
+		devices:           devs,
+		raid:              profile,
+		ops:               volume.NewOpCounter(),
+		alerts:            volume.NewCapacityAlerter(volume.DefaultAlertCooldown),
+		snapMounts:        snapMounts{paths: make(map[api.SnapID]map[string]bool)},
+		broker:            volume.NewAlertBroker(),
+		stop:              make(chan struct{}),
+		DefaultEnumerator: s,
+	}
+	inst.scrub.interval = scrubInterval
+	if v, ok := params[QgroupUsageParam]; ok {
+		if inst.qgroups.enabled, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("Invalid %v %q", QgroupUsageParam, v)
+		}
+	}
+	if v, ok := params[BackupVersionParam]; ok {
+		if inst.backupVersion, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("Invalid %v %q", BackupVersionParam, v)
+		}
+	}
+	go inst.watchAlerts()
+	if scrubInterval > 0 {
+		go inst.scheduleScrub()
+	}
+	return inst, nil
 }
 
 func (d *btrfsDriver) String() string {
 	return Name
 }
 
+// SupportedFilesystems only btrfs subvolumes can be created.
+func (d *btrfsDriver) SupportedFilesystems() []api.Filesystem {
+	return []api.Filesystem{api.FsBtrfs}
+}
+
+// Capabilities btrfs snapshots are native subvolume snapshots.
+func (d *btrfsDriver) Capabilities() volume.Capabilities {
+	return volume.CapSnapshot
+}
+
 // Status diagnostic information
 func (d *btrfsDriver) Status() [][2]string {
-	return d.btrfs.Status()
+	status := append(d.btrfs.Status(), d.ModeStatus(), volume.VersionStatus(d.Version()))
+	status = append(status, d.scrubStatus()...)
+	status = append(status, d.promoteStatus()...)
+	if len(d.devices) > 0 {
+		status = append(status,
+			[2]string{"RAID Profile", d.raid},
+			[2]string{"Devices", strings.Join(d.devices, ",")})
+	}
+	return status
 }
 
 // Create a new subvolume. The volume spec is not taken into account.
 func (d *btrfsDriver) Create(locator api.VolumeLocator,
 	options *api.CreateOptions,
-	spec *api.VolumeSpec) (api.VolumeID, error) {
+	spec *api.VolumeSpec) (id api.VolumeID, err error) {
 
-	if spec.Format != api.FsBtrfs && spec.Format != "" {
-		return api.BadVolumeID, fmt.Errorf("Filesystem format (%v) must be %v",
-			spec.Format, api.FsBtrfs)
+	defer func() { d.ops.Record(volume.OpCreate, err) }()
+	if err = d.CheckWritable(); err != nil {
+		return api.BadVolumeID, err
+	}
+	format := spec.Format
+	if format == "" {
+		format = api.FsBtrfs
+	}
+	if err = volume.ValidateFormat(d, format); err != nil {
+		return api.BadVolumeID, err
+	}
+	if err = volume.CheckNoIOLimits(spec); err != nil {
+		return api.BadVolumeID, err
+	}
+	if err = volume.ValidateTags(spec.Tags); err != nil {
+		return api.BadVolumeID, err
+	}
+
+	// Held until the subvolume and its children are created.
+	d.createLock.Lock()
+	defer d.createLock.Unlock()
+	if options != nil && options.Idempotent {
+		if id, ok, err := volume.VolumeExists(d, locator); err != nil || ok {
+			return id, err
+		}
+	}
+	children, err := parseSubvolumes(locator.VolumeLabels[SubvolumesLabel])
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+
+	if volume.IsNameTemplate(locator.Name) {
+		name, release, err := volume.UniqueName(d, locator.Name, time.Now())
+		if err != nil {
+			return api.BadVolumeID, err
+		}
+		defer release()
+		locator.Name = name
 	}
 
 	volumeID, err := uuid()
@@ -91,6 +216,7 @@ func (d *btrfsDriver) Create(locator api.VolumeLocator,
 		LastScan: time.Now(),
 		Format:   api.FsBtrfs,
 		State:    api.VolumeAvailable,
+		Tags:     spec.Tags,
 	}
 	err = d.CreateVol(v)
 	if err != nil {
@@ -104,47 +230,120 @@ func (d *btrfsDriver) Create(locator api.VolumeLocator,
 	if err != nil {
 		return v.ID, err
 	}
+	if err = createSubvolumes(v.DevicePath, children); err != nil {
+		d.DeleteVol(v.ID)
+		d.btrfs.Remove(volumeID)
+		return api.BadVolumeID, err
+	}
 	err = d.UpdateVol(v)
 	return v.ID, err
 }
 
 // Delete subvolume
-func (d *btrfsDriver) Delete(volumeID api.VolumeID) error {
-	err := d.DeleteVol(volumeID)
+func (d *btrfsDriver) Delete(volumeID api.VolumeID) (err error) {
+	defer func() { d.ops.Record(volume.OpDelete, err) }()
+	if err = d.CheckWritable(); err != nil {
+		return err
+	}
+	// A subvolume removed out of band only leaves the record to delete.
+	v, err := d.GetVolVerified(volumeID)
+	gone := err == volume.ErrVolBackingGone
+	if err != nil && !gone {
+		return err
+	}
+	if !gone && (v.AttachPath != "" || len(v.SubPathMounts) > 0 ||
+		d.roMounts.Count(volumeID) > 0) {
+		return volume.ErrVolumeBusy
+	}
+	if !gone && len(subvolumes(v)) > 0 {
+		return ErrHasSubvolumes
+	}
+	err = d.DeleteVol(volumeID)
 	chaos.Now(koStrayDelete)
-	if err == nil {
+	if err == nil && !gone {
 		err = d.btrfs.Remove(string(volumeID))
 	}
 	return err
 }
 
 // Mount bind mount btrfs subvolume
-func (d *btrfsDriver) Mount(volumeID api.VolumeID, mountpath string) error {
-	v, err := d.GetVol(volumeID)
+func (d *btrfsDriver) Mount(
+	volumeID api.VolumeID,
+	mountpath string,
+	opts *api.MountOptions) (err error) {
+
+	defer func() { d.ops.Record(volume.OpMount, err) }()
+	if err = d.CheckMount(opts); err != nil {
+		return err
+	}
+	v, err := d.GetVolVerified(volumeID)
 	if err != nil {
 		return err
 	}
-	err = syscall.Mount(v.DevicePath,
+	source, err := volume.ResolveSubPath(v.DevicePath, opts)
+	if err != nil {
+		return err
+	}
+	err = volume.MountWithOptions(source,
 		mountpath,
 		string(v.Format),
-		syscall.MS_BIND, "")
+		syscall.MS_BIND, "", opts)
 	if err != nil {
-		return fmt.Errorf("Faield to mount %v at %v: %v", v.DevicePath, mountpath, err)
+		err = &volume.MountError{Source: source, Target: mountpath, Err: err}
+		d.broker.Publish(api.Alert{
+			Type:     api.AlertMountFailure,
+			VolumeID: volumeID,
+			Time:     time.Now(),
+			Message:  err.Error(),
+		})
+		return err
+	}
+	// Mounts in read-only mode are tracked apart from the record, which
+	// cannot be updated.
+	if d.ReadOnly() {
+		d.roMounts.Add(volumeID, mountpath)
+		return nil
+	}
+	if opts != nil && opts.SubPath != "" {
+		v.SubPathMounts = volume.AddMountPath(v.SubPathMounts, mountpath)
+	} else {
+		v.AttachPath = mountpath
 	}
-	v.AttachPath = mountpath
 	err = d.UpdateVol(v)
 	return err
 }
 
-// Unmount btrfs subvolume
-func (d *btrfsDriver) Unmount(volumeID api.VolumeID, mountpath string) error {
+// Unmount btrfs subvolume at mountpath, or at the path it is mounted at if
+// mountpath is empty.
+func (d *btrfsDriver) Unmount(volumeID api.VolumeID, mountpath string) (err error) {
+	defer func() { d.ops.Record(volume.OpUnmount, err) }()
+	if mountpath != "" && d.roMounts.Has(volumeID, mountpath) {
+		if err = syscall.Unmount(mountpath, 0); err != nil {
+			return err
+		}
+		d.roMounts.Remove(volumeID, mountpath)
+		return nil
+	}
+	if err = d.CheckWritable(); err != nil {
+		return err
+	}
 	v, err := d.GetVol(volumeID)
 	if err != nil {
 		return err
 	}
+	if mounts, ok := volume.RemoveMountPath(v.SubPathMounts, mountpath); ok {
+		if err = syscall.Unmount(mountpath, 0); err != nil {
+			return err
+		}
+		v.SubPathMounts = mounts
+		return d.UpdateVol(v)
+	}
 	if v.AttachPath == "" {
 		return fmt.Errorf("Device %v not mounted", volumeID)
 	}
+	if mountpath != "" && mountpath != v.AttachPath {
+		return fmt.Errorf("Device %v not mounted at %v", volumeID, mountpath)
+	}
 	err = syscall.Unmount(v.AttachPath, 0)
 	if err != nil {
 		return err
@@ -154,8 +353,59 @@ func (d *btrfsDriver) Unmount(volumeID api.VolumeID, mountpath string) error {
 	return err
 }
 
-// Snapshot create new subvolume from volume
-func (d *btrfsDriver) Snapshot(volumeID api.VolumeID, labels api.Labels) (api.SnapID, error) {
+// ForceRelease detaches all mounts of the volume and clears its attach
+// state even if they cannot be unmounted cleanly.
+func (d *btrfsDriver) ForceRelease(volumeID api.VolumeID) error {
+	if err := d.CheckWritable(); err != nil {
+		return err
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	paths := append(d.roMounts.Clear(volumeID), v.SubPathMounts...)
+	err = volume.ForceUnmount(volumeID, append(paths, v.AttachPath)...)
+	if v.AttachPath != "" || len(v.SubPathMounts) > 0 {
+		v.AttachPath = ""
+		v.SubPathMounts = nil
+		if uerr := d.UpdateVol(v); err == nil {
+			err = uerr
+		}
+	}
+	log.Infof("Force released volume %v", volumeID)
+	return err
+}
+
+// Snapshot create new subvolume from volume. The subvolume is created before
+// the snapshot record so that a failure never leaves a record without data.
+func (d *btrfsDriver) Snapshot(volumeID api.VolumeID, labels api.Labels) (id api.SnapID, err error) {
+	defer func() { d.ops.Record(volume.OpSnapshot, err) }()
+	if err = d.CheckWritable(); err != nil {
+		return api.BadSnapID, err
+	}
+	token, err := d.Lock(volumeID)
+	if err != nil {
+		return api.BadSnapID, err
+	}
+	defer d.Unlock(token)
+
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return api.BadSnapID, err
+	}
+	if template := labels[volume.SnapNameLabel]; volume.IsNameTemplate(template) {
+		name, release, err := volume.UniqueSnapName(d, volumeID, template, time.Now())
+		if err != nil {
+			return api.BadSnapID, err
+		}
+		defer release()
+		named := api.Labels{}
+		for k, v := range labels {
+			named[k] = v
+		}
+		named[volume.SnapNameLabel] = name
+		labels = named
+	}
 	snapID, err := uuid()
 	if err != nil {
 		return api.BadSnapID, err
@@ -167,21 +417,52 @@ func (d *btrfsDriver) Snapshot(volumeID api.VolumeID, labels api.Labels) (api.Sn
 		SnapLabels: labels,
 		Ctime:      time.Now(),
 	}
-	err = d.CreateSnap(snap)
+	// Child subvolumes appear as empty directories in a snapshot of their
+	// parent, each has to be snapshotted on its own.
+	if child := labels[SnapSubvolumeLabel]; child != "" {
+		err = d.snapshotSubvolume(v, child, snapID)
+	} else {
+		err = d.btrfs.Create(snapID, string(volumeID))
+	}
 	if err != nil {
 		return api.BadSnapID, err
 	}
-	chaos.Now(koStrayCreate)
-	err = d.btrfs.Create(snapID, string(volumeID))
+	err = chaos.Now(koStrayCreate)
+	if err == nil {
+		err = d.CreateSnap(snap)
+	}
 	if err != nil {
+		d.btrfs.Remove(snapID)
 		return api.BadSnapID, err
 	}
 	return snap.ID, nil
 }
 
+// Quiesce flushes the btrfs filesystem holding the volumes. fsfreeze is not
+// used since a frozen btrfs blocks the snapshot ioctl itself; each subvolume
+// snapshot is atomic once dirty data is on disk.
+func (d *btrfsDriver) Quiesce(volumeIDs []api.VolumeID) error {
+	return btrfsCmd(nil, nil, "filesystem", "sync", d.root)
+}
+
+// Unquiesce nothing to release after Quiesce.
+func (d *btrfsDriver) Unquiesce(volumeIDs []api.VolumeID) error {
+	return nil
+}
+
 // SnapDelete Delete subvolume
-func (d *btrfsDriver) SnapDelete(snapID api.SnapID) error {
-	err := d.DeleteSnap(snapID)
+func (d *btrfsDriver) SnapDelete(snapID api.SnapID) (err error) {
+	defer func() { d.ops.Record(volume.OpSnapDelete, err) }()
+	if err = d.CheckWritable(); err != nil {
+		return err
+	}
+	d.snapMounts.Lock()
+	mounted := len(d.snapMounts.paths[snapID])
+	d.snapMounts.Unlock()
+	if mounted > 0 {
+		return fmt.Errorf("Snapshot %v is mounted at %d paths", snapID, mounted)
+	}
+	err = d.DeleteSnap(snapID)
 	chaos.Now(koStrayDelete)
 	if err == nil {
 		err = d.btrfs.Remove(string(snapID))
@@ -191,18 +472,102 @@ func (d *btrfsDriver) SnapDelete(snapID api.SnapID) error {
 
 // Stats for specified volume.
 func (d *btrfsDriver) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
-	return api.VolumeStats{}, nil
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return api.VolumeStats{}, err
+	}
+	return spaceUsage(v.DevicePath)
 }
 
-// Alerts on this volume.
+// Alerts on this volume. Usage is only computed when the volume has a
+// capacity alert threshold.
 func (d *btrfsDriver) Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error) {
-	return api.VolumeAlerts{}, nil
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return api.VolumeAlerts{}, err
+	}
+	if t, err := volume.AlertThreshold(v); err != nil || t == 0 {
+		return api.VolumeAlerts{}, err
+	}
+	usage, err := diskUsage(v.DevicePath)
+	if err != nil {
+		return api.VolumeAlerts{}, err
+	}
+	alerts, err := d.alerts.Check(v, usage)
+	d.broker.Publish(alerts...)
+	return api.VolumeAlerts{Alerts: alerts}, err
+}
+
+// SubscribeAlerts streams capacity and mount failure alerts. Capacity is
+// checked every alertInterval for volumes with an alert threshold.
+func (d *btrfsDriver) SubscribeAlerts(ctx context.Context) (<-chan api.Alert, error) {
+	return d.broker.SubscribeAlerts(ctx)
+}
+
+// watchAlerts checks capacity alerts until Shutdown.
+func (d *btrfsDriver) watchAlerts() {
+	t := time.NewTicker(alertInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-t.C:
+		}
+		d.checkScrub()
+		vols, err := d.Enumerate(api.VolumeLocator{}, nil)
+		if err != nil {
+			log.Warnf("Failed to enumerate volumes for alerts: %v", err)
+			continue
+		}
+		for _, v := range vols {
+			if th, _ := volume.AlertThreshold(&v); th > 0 {
+				d.Alerts(v.ID)
+			}
+		}
+	}
+}
+
+// diskUsage returns the bytes used by files under p.
+func diskUsage(p string) (uint64, error) {
+	out, err := exec.Command("du", "-sb", p).Output()
+	if err != nil {
+		return 0, fmt.Errorf("du %v failed: %v", p, err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("Unexpected du output %q", out)
+	}
+	return strconv.ParseUint(fields[0], 10, 64)
+}
+
+// Metrics operation counts, snapshot count and provisioned capacity.
+func (d *btrfsDriver) Metrics() []api.Metric {
+	m := d.ops.Metrics()
+	snaps, err := d.SnapEnumerate(nil, nil)
+	if err != nil {
+		return m
+	}
+	vols, err := d.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		return m
+	}
+	var capacity uint64
+	for _, v := range vols {
+		if v.Spec != nil {
+			capacity += v.Spec.Size
+		}
+	}
+	return append(m, volume.CapacityMetrics(len(snaps), capacity)...)
 }
 
 // Shutdown and cleanup.
 func (d *btrfsDriver) Shutdown() {
+	close(d.stop)
 }
 
 func init() {
+	koStrayCreate = chaos.Add("btrfs", "Snapshot", "create subvolume without snapshot record")
+	koStrayDelete = chaos.Add("btrfs", "Delete", "delete record without subvolume")
 	volume.Register(Name, volume.File, Init)
 }
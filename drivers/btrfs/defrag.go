@@ -0,0 +1,18 @@
+package btrfs
+
+import (
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// Defragment runs btrfs filesystem defragment recursively on the subvolume.
+// It works online, but defragmenting breaks extent sharing with snapshots.
+func (d *btrfsDriver) Defragment(volumeID api.VolumeID) error {
+	if err := d.CheckWritable(); err != nil {
+		return err
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	return btrfsCmd(nil, nil, "filesystem", "defragment", "-r", v.DevicePath)
+}
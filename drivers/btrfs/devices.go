@@ -0,0 +1,140 @@
+package btrfs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const procMounts = "/proc/mounts"
+
+const (
+	// DevicesParam comma separated block devices to build the filesystem on.
+	DevicesParam = "devices"
+	// RaidParam data and metadata RAID profile used with DevicesParam.
+	RaidParam = "raid"
+)
+
+// raidMinDevices is the number of devices each supported profile needs.
+var raidMinDevices = map[string]int{
+	"single": 1,
+	"raid0":  2,
+	"raid1":  2,
+	"raid10": 4,
+}
+
+// parseDevices returns the devices and RAID profile requested in params.
+func parseDevices(devices, profile string) ([]string, string, error) {
+	if devices == "" {
+		if profile != "" {
+			return nil, "", fmt.Errorf("%q requires %q", RaidParam, DevicesParam)
+		}
+		return nil, "", nil
+	}
+	devs := strings.Split(devices, ",")
+	for i := range devs {
+		devs[i] = strings.TrimSpace(devs[i])
+	}
+	if profile == "" {
+		profile = "single"
+		if len(devs) > 1 {
+			profile = "raid1"
+		}
+	}
+	min, ok := raidMinDevices[profile]
+	if !ok {
+		return nil, "", fmt.Errorf("Unsupported RAID profile %q", profile)
+	}
+	if len(devs) < min {
+		return nil, "", fmt.Errorf("RAID profile %v needs at least %d devices, got %d",
+			profile, min, len(devs))
+	}
+	return devs, profile, nil
+}
+
+func isBtrfs(dev string) bool {
+	out, err := exec.Command("blkid", "-s", "TYPE", "-o", "value", dev).Output()
+	return err == nil && strings.TrimSpace(string(out)) == "btrfs"
+}
+
+// setupDevices creates a btrfs filesystem across devs with profile unless one
+// exists already and mounts it at root.
+func setupDevices(root string, devs []string, profile string) error {
+	if !isBtrfs(devs[0]) {
+		args := []string{"-d", profile, "-m", profile}
+		out, err := exec.Command("mkfs.btrfs", append(args, devs...)...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("mkfs.btrfs %v failed: %v: %s", devs, err, out)
+		}
+	}
+	if err := btrfsCmd(nil, nil, "device", "scan"); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+	f, err := os.Open(procMounts)
+	if err != nil {
+		return err
+	}
+	source, fstype, err := mountSource(f, root)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if source == "" {
+		return syscall.Mount(devs[0], root, "btrfs", 0, "")
+	}
+	// Any device of a multi-device filesystem can be listed as its source.
+	if fstype == "btrfs" {
+		for _, dev := range devs {
+			if sameDevice(source, dev) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%v is already mounted from %v (%v), not from %v",
+		root, source, fstype, devs)
+}
+
+// mountSource returns the source and filesystem type of the last mount at
+// root listed in mounts, in the /proc/mounts format. The source is empty if
+// root is not a mount point.
+func mountSource(mounts io.Reader, root string) (string, string, error) {
+	root = filepath.Clean(root)
+	var source, fstype string
+	s := bufio.NewScanner(mounts)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) > 2 && unescapeMount(fields[1]) == root {
+			source, fstype = unescapeMount(fields[0]), fields[2]
+		}
+	}
+	return source, fstype, s.Err()
+}
+
+// unescapeMount decodes the octal escapes of spaces, tabs and backslashes
+// in /proc/mounts.
+func unescapeMount(p string) string {
+	r := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\134`, `\`)
+	return r.Replace(p)
+}
+
+// sameDevice returns true if a and b are the same device once symlinks,
+// such as /dev/disk/by-id names, are resolved.
+func sameDevice(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ra, err := filepath.EvalSymlinks(a)
+	if err != nil {
+		return false
+	}
+	rb, err := filepath.EvalSymlinks(b)
+	return err == nil && ra == rb
+}
@@ -0,0 +1,47 @@
+package btrfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDevices(t *testing.T) {
+	devs, profile, err := parseDevices("/dev/sdb, /dev/sdc", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/dev/sdb", "/dev/sdc"}, devs)
+	assert.Equal(t, "raid1", profile, "Several devices default to raid1")
+
+	_, _, err = parseDevices("/dev/sdb", "raid1")
+	assert.Error(t, err, "raid1 needs two devices")
+	_, _, err = parseDevices("", "raid0")
+	assert.Error(t, err, "A profile needs devices")
+	_, _, err = parseDevices("/dev/sdb", "raid5")
+	assert.Error(t, err, "raid5 is not supported")
+}
+
+func TestMountSource(t *testing.T) {
+	mounts := `/dev/sda1 / ext4 rw,relatime 0 0
+/dev/sdb /var/lib/openstorage/btrfs btrfs rw,relatime 0 0
+/dev/sdc /mnt/with\040space btrfs rw 0 0
+`
+	tests := []struct {
+		root   string
+		source string
+		fstype string
+	}{
+		{"/var/lib/openstorage/btrfs", "/dev/sdb", "btrfs"},
+		{"/var/lib/openstorage/btrfs/", "/dev/sdb", "btrfs"},
+		{"/mnt/with space", "/dev/sdc", "btrfs"},
+		// A subdirectory of a btrfs mount is not a mount point itself.
+		{"/var/lib/openstorage/btrfs/volumes", "", ""},
+		{"/", "/dev/sda1", "ext4"},
+	}
+	for _, tt := range tests {
+		source, fstype, err := mountSource(strings.NewReader(mounts), tt.root)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.source, source, "Source of %v", tt.root)
+		assert.Equal(t, tt.fstype, fstype, "Type of %v", tt.root)
+	}
+}
@@ -0,0 +1,45 @@
+// +build linux
+
+package btrfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+func TestMountErrorTransient(t *testing.T) {
+	d, _ := newFakeDriver(t)
+	d.broker = volume.NewAlertBroker()
+	dir, err := ioutil.TempDir("", "btrfs_mount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	vol := &api.Volume{ID: "mountvol", DevicePath: dir, Format: api.FsBtrfs, Spec: &api.VolumeSpec{}}
+	assert.NoError(t, d.CreateVol(vol), "Failed in CreateVol")
+
+	var seen error
+	policy := volume.RetryPolicy{Retryable: func(err error) bool {
+		seen = err
+		return false
+	}}
+	err = volume.WithRetry(d, policy).Mount(vol.ID, filepath.Join(dir, "missing"), nil)
+	assert.Error(t, err, "Mount at a missing path should fail")
+	assert.Equal(t, err, seen, "The retry policy should see the driver's error")
+	me, ok := err.(*volume.MountError)
+	if !assert.True(t, ok, "Mount should return a MountError, got %T", err) {
+		return
+	}
+	errno, ok := me.Err.(syscall.Errno)
+	assert.True(t, ok, "The mount error should keep its errno, got %T", me.Err)
+	assert.Equal(t, volume.IsTransient(errno), volume.IsTransient(err),
+		"The wrapped error should be classified by its errno")
+}
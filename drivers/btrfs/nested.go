@@ -0,0 +1,136 @@
+package btrfs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// SubvolumesLabel on a volume lists, comma separated, the paths inside
+	// the volume that are created as child subvolumes.
+	SubvolumesLabel = "btrfs.subvolumes"
+	// SnapSubvolumeLabel on a snapshot request selects the child subvolume
+	// to snapshot instead of the whole volume.
+	SnapSubvolumeLabel = "btrfs.subvolume"
+)
+
+// ErrHasSubvolumes is returned by Delete for volumes with child subvolumes,
+// use DeleteRecursive to delete them.
+var ErrHasSubvolumes = errors.New("Volume has child subvolumes")
+
+// parseSubvolumes returns the child paths listed in a SubvolumesLabel value,
+// once each and parents before their children.
+func parseSubvolumes(label string) ([]string, error) {
+	var children []string
+	seen := make(map[string]bool)
+	for _, p := range strings.Split(label, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		clean := path.Clean(p)
+		if path.IsAbs(clean) || clean == "." || clean == ".." ||
+			strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("Invalid subvolume path %q", p)
+		}
+		if !seen[clean] {
+			seen[clean] = true
+			children = append(children, clean)
+		}
+	}
+	sort.Strings(children)
+	return children, nil
+}
+
+// subvolumes returns the child subvolumes of v.
+func subvolumes(v *api.Volume) []string {
+	children, _ := parseSubvolumes(v.Locator.VolumeLabels[SubvolumesLabel])
+	return children
+}
+
+// createSubvolumes creates children under dir. Children created before a
+// failure are deleted again.
+func createSubvolumes(dir string, children []string) error {
+	for i, c := range children {
+		p := path.Join(dir, c)
+		err := os.MkdirAll(path.Dir(p), 0755)
+		if err == nil {
+			err = btrfsCmd(nil, nil, "subvolume", "create", p)
+		}
+		if err != nil {
+			deleteSubvolumes(dir, children[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteSubvolumes deletes children of dir, children before their parents.
+func deleteSubvolumes(dir string, children []string) error {
+	for i := len(children) - 1; i >= 0; i-- {
+		p := path.Join(dir, children[i])
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			continue
+		}
+		if err := deleteSubvolume(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotSubvolume snapshots the child subvolume of v into a new subvolume
+// snapID allocated by the graph driver.
+func (d *btrfsDriver) snapshotSubvolume(v *api.Volume, child, snapID string) error {
+	child = path.Clean(child)
+	found := false
+	for _, c := range subvolumes(v) {
+		found = found || c == child
+	}
+	if !found {
+		return fmt.Errorf("Volume %v has no subvolume %q", v.ID, child)
+	}
+	err := d.btrfs.Create(snapID, "")
+	if err != nil {
+		return err
+	}
+	dst, err := d.btrfs.Get(snapID, "")
+	if err == nil {
+		err = deleteSubvolume(dst)
+	}
+	if err == nil {
+		err = btrfsCmd(nil, nil, "subvolume", "snapshot", path.Join(v.DevicePath, child), dst)
+	}
+	if err != nil {
+		d.btrfs.Remove(snapID)
+	}
+	return err
+}
+
+// DeleteRecursive deletes the child subvolumes of volumeID and then the
+// volume itself.
+func (d *btrfsDriver) DeleteRecursive(volumeID api.VolumeID) error {
+	if err := d.CheckWritable(); err != nil {
+		return err
+	}
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return err
+	}
+	if children := subvolumes(v); len(children) > 0 {
+		if err = deleteSubvolumes(v.DevicePath, children); err != nil {
+			return err
+		}
+		delete(v.Locator.VolumeLabels, SubvolumesLabel)
+		if err = d.UpdateVol(v); err != nil {
+			return err
+		}
+	}
+	return d.Delete(volumeID)
+}
@@ -0,0 +1,31 @@
+package btrfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSubvolumes(t *testing.T) {
+	tests := []struct {
+		label string
+		want  []string
+	}{
+		{"", nil},
+		{" , ", nil},
+		{"a", []string{"a"}},
+		{"b/c, a,b", []string{"a", "b", "b/c"}},
+		{"a/./b/, a//b", []string{"a/b"}},
+		{"..data", []string{"..data"}},
+	}
+	for _, tt := range tests {
+		children, err := parseSubvolumes(tt.label)
+		assert.NoError(t, err, "Label %q", tt.label)
+		assert.Equal(t, tt.want, children, "Label %q", tt.label)
+	}
+
+	for _, label := range []string{"/a", ".", "..", "../a", "a/../../b", "a,/b"} {
+		_, err := parseSubvolumes(label)
+		assert.Error(t, err, "Label %q should be rejected", label)
+	}
+}
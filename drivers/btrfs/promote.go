@@ -0,0 +1,147 @@
+package btrfs
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// promotions tracks the phase of each promotion in progress.
+type promotions struct {
+	sync.Mutex
+	phases map[api.SnapID]promotion
+}
+
+type promotion struct {
+	phase string
+	since time.Time
+}
+
+// start snapID in phase, false if it is being promoted already.
+func (p *promotions) start(snapID api.SnapID, phase string) bool {
+	p.Lock()
+	defer p.Unlock()
+	if _, ok := p.phases[snapID]; ok {
+		return false
+	}
+	if p.phases == nil {
+		p.phases = make(map[api.SnapID]promotion)
+	}
+	p.phases[snapID] = promotion{phase, time.Now()}
+	return true
+}
+
+func (p *promotions) set(snapID api.SnapID, phase string) {
+	p.Lock()
+	defer p.Unlock()
+	p.phases[snapID] = promotion{phase, time.Now()}
+}
+
+func (p *promotions) done(snapID api.SnapID) {
+	p.Lock()
+	defer p.Unlock()
+	delete(p.phases, snapID)
+}
+
+// promoteStatus is the Status entry of each promotion in progress.
+func (d *btrfsDriver) promoteStatus() [][2]string {
+	d.promotions.Lock()
+	defer d.promotions.Unlock()
+	ids := make([]string, 0, len(d.promotions.phases))
+	for id := range d.promotions.phases {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+	status := make([][2]string, 0, len(ids))
+	for _, id := range ids {
+		p := d.promotions.phases[api.SnapID(id)]
+		elapsed := time.Since(p.since) / time.Second * time.Second
+		status = append(status, [2]string{"Promoting " + id, fmt.Sprintf("%v for %v", p.phase, elapsed)})
+	}
+	return status
+}
+
+// PromoteSnapshot unshares the snapshot's extents from its parent with a
+// recursive defragment, then replaces the snapshot record by a volume
+// record. The subvolume itself stays where it is. The new volume is labeled
+// with volume.SnapSourceLabel and gets the parent's spec, if the parent
+// still exists. The phase of the promotion is reported in Status.
+func (d *btrfsDriver) PromoteSnapshot(snapID api.SnapID) (api.VolumeID, error) {
+	if err := d.CheckWritable(); err != nil {
+		return api.BadVolumeID, err
+	}
+	snap, err := d.GetSnap(snapID)
+	if err != nil {
+		return api.BadVolumeID, volume.ErrSnapNotFound
+	}
+	if !d.promotions.start(snapID, "checking") {
+		return api.BadVolumeID, fmt.Errorf("Snapshot %v is being promoted", snapID)
+	}
+	defer d.promotions.done(snapID)
+	d.snapMounts.Lock()
+	mounted := len(d.snapMounts.paths[snapID])
+	d.snapMounts.Unlock()
+	if mounted > 0 {
+		return api.BadVolumeID, fmt.Errorf("Snapshot %v is mounted at %d paths", snapID, mounted)
+	}
+	dir, err := d.btrfs.Get(string(snapID), "")
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+
+	log.Infof("Promoting snapshot %v of %v: unsharing data", snapID, snap.VolumeID)
+	d.promotions.set(snapID, "unsharing data")
+	start := time.Now()
+	if err = btrfsCmd(nil, nil, "filesystem", "defragment", "-r", dir); err != nil {
+		return api.BadVolumeID, err
+	}
+	log.Infof("Promoting snapshot %v: data unshared in %v", snapID, time.Since(start))
+	d.promotions.set(snapID, "updating records")
+
+	spec := &api.VolumeSpec{Format: api.FsBtrfs}
+	locator := api.VolumeLocator{VolumeLabels: api.Labels{}}
+	if parent, err := d.GetVol(snap.VolumeID); err == nil {
+		if parent.Spec != nil {
+			s := *parent.Spec
+			spec = &s
+		}
+		if parent.Locator.Name != "" {
+			name, release, err := volume.UniqueName(d, parent.Locator.Name+".snap", time.Now())
+			if err != nil {
+				return api.BadVolumeID, err
+			}
+			defer release()
+			locator.Name = name
+		}
+	}
+	for k, v := range snap.SnapLabels {
+		locator.VolumeLabels[k] = v
+	}
+	locator.VolumeLabels[volume.SnapSourceLabel] = string(snap.VolumeID)
+
+	v := &api.Volume{
+		ID:         api.VolumeID(snapID),
+		Locator:    locator,
+		Ctime:      snap.Ctime,
+		Spec:       spec,
+		LastScan:   time.Now(),
+		Format:     api.FsBtrfs,
+		State:      api.VolumeAvailable,
+		DevicePath: dir,
+	}
+	if err = d.CreateVol(v); err != nil {
+		return api.BadVolumeID, err
+	}
+	if err = d.DeleteSnap(snapID); err != nil {
+		d.DeleteVol(v.ID)
+		return api.BadVolumeID, err
+	}
+	log.Infof("Promoted snapshot %v to volume %v", snapID, v.ID)
+	return v.ID, nil
+}
@@ -0,0 +1,83 @@
+// +build linux
+
+package btrfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// fakeDefrag puts a btrfs in PATH whose defragment waits until the returned
+// file exists.
+func fakeDefrag(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "promote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := filepath.Join(dir, "release")
+	script := "#!/bin/sh\nwhile [ ! -e " + release + " ]; do sleep 0.01; done\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "btrfs"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+":"+path)
+	return release, func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestPromoteSnapshot(t *testing.T) {
+	release, cleanup := fakeDefrag(t)
+	defer cleanup()
+	d, g := newFakeDriver(t)
+	vol := &api.Volume{ID: "promotevol", Locator: api.VolumeLocator{Name: "promotevol"},
+		Spec: &api.VolumeSpec{Size: 1}}
+	assert.NoError(t, d.CreateVol(vol), "Failed in CreateVol")
+	assert.NoError(t, g.Create(string(vol.ID), ""))
+	snapID, err := d.Snapshot(vol.ID, api.Labels{"app": "db"})
+	assert.NoError(t, err, "Failed in Snapshot")
+
+	type result struct {
+		id  api.VolumeID
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		id, err := volume.PromoteSnapshot(d, snapID)
+		done <- result{id, err}
+	}()
+	phase := ""
+	for i := 0; i < 500 && !strings.HasPrefix(phase, "unsharing data"); i++ {
+		time.Sleep(10 * time.Millisecond)
+		for _, kv := range d.promoteStatus() {
+			if kv[0] == "Promoting "+string(snapID) {
+				phase = kv[1]
+			}
+		}
+	}
+	assert.True(t, strings.HasPrefix(phase, "unsharing data"), "Status should report the defragment, got %q", phase)
+	_, err = d.PromoteSnapshot(snapID)
+	assert.Error(t, err, "A snapshot should be promoted once at a time")
+	assert.NoError(t, ioutil.WriteFile(release, nil, 0644))
+
+	r := <-done
+	assert.NoError(t, r.err, "Failed to promote")
+	assert.Equal(t, api.VolumeID(snapID), r.id)
+	assert.Empty(t, d.promoteStatus(), "Finished promotions should not be reported")
+	v, err := d.GetVol(r.id)
+	assert.NoError(t, err, "Promoted volume should exist")
+	assert.Equal(t, string(vol.ID), v.Locator.VolumeLabels[volume.SnapSourceLabel])
+	assert.Equal(t, "db", v.Locator.VolumeLabels["app"])
+	_, err = d.GetSnap(snapID)
+	assert.Error(t, err, "Snapshot record should be removed")
+}
@@ -0,0 +1,135 @@
+package btrfs
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// QgroupUsageParam set to "true" makes Enumerate report the qgroup
+	// usage of each volume. Quotas must be enabled on the filesystem.
+	QgroupUsageParam = "qgroup_usage"
+	// qgroupCacheTTL how long qgroup usage is reused between Enumerates.
+	qgroupCacheTTL = 10 * time.Second
+)
+
+// qgroupUsage of a subvolume in bytes.
+type qgroupUsage struct {
+	referenced uint64
+	exclusive  uint64
+}
+
+// qgroupCache holds the usage of each subvolume, by subvolume name, or the
+// error reading it, e.g. when quotas are disabled.
+type qgroupCache struct {
+	sync.Mutex
+	enabled bool
+	at      time.Time
+	usage   map[string]qgroupUsage
+	err     error
+}
+
+// parseQgroupShow parses "btrfs qgroup show --raw" into usage by qgroup
+// ID, e.g. "0/257".
+func parseQgroupShow(out string) map[string]qgroupUsage {
+	usage := make(map[string]qgroupUsage)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "0/") {
+			continue
+		}
+		rfer, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		excl, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		usage[fields[0]] = qgroupUsage{referenced: rfer, exclusive: excl}
+	}
+	return usage
+}
+
+// parseSubvolumeList parses "btrfs subvolume list" into subvolume IDs by
+// the base name of the subvolume path.
+func parseSubvolumeList(out string) map[string]string {
+	ids := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		// ID 257 gen 8 top level 5 path volumes/subvolumes/<id>
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "ID" {
+			continue
+		}
+		if i := strings.Index(line, " path "); i >= 0 {
+			ids[path.Base(line[i+len(" path "):])] = fields[1]
+		}
+	}
+	return ids
+}
+
+// qgroupUsages returns the usage of each subvolume by name. The usage, or
+// the failure to read it, is cached for qgroupCacheTTL.
+func (d *btrfsDriver) qgroupUsages() (map[string]qgroupUsage, error) {
+	d.qgroups.Lock()
+	defer d.qgroups.Unlock()
+	if !d.qgroups.at.IsZero() && time.Since(d.qgroups.at) < qgroupCacheTTL {
+		return d.qgroups.usage, d.qgroups.err
+	}
+	d.qgroups.usage, d.qgroups.err = d.readQgroupUsages()
+	d.qgroups.at = time.Now()
+	if d.qgroups.err != nil {
+		log.Warnf("Cannot read qgroup usage: %v", d.qgroups.err)
+	}
+	return d.qgroups.usage, d.qgroups.err
+}
+
+// readQgroupUsages runs btrfs to list subvolumes and their qgroups.
+func (d *btrfsDriver) readQgroupUsages() (map[string]qgroupUsage, error) {
+	var list, show bytes.Buffer
+	if err := btrfsCmd(nil, &list, "subvolume", "list", d.root); err != nil {
+		return nil, err
+	}
+	if err := btrfsCmd(nil, &show, "qgroup", "show", "--raw", d.root); err != nil {
+		return nil, fmt.Errorf("Quotas may not be enabled on %v: %v", d.root, err)
+	}
+	byID := parseQgroupShow(show.String())
+	usage := make(map[string]qgroupUsage)
+	for name, id := range parseSubvolumeList(list.String()) {
+		if u, ok := byID["0/"+id]; ok {
+			usage[name] = u
+		}
+	}
+	return usage, nil
+}
+
+// Enumerate volumes that match the locator. With QgroupUsageParam set the
+// Usage and ExclusiveUsage of each volume come from its qgroup, which
+// accounts for extents shared with snapshots.
+func (d *btrfsDriver) Enumerate(locator api.VolumeLocator, labels api.Labels) ([]api.Volume, error) {
+	vols, err := d.DefaultEnumerator.Enumerate(locator, labels)
+	if err != nil || !d.qgroups.enabled {
+		return vols, err
+	}
+	// Failures are logged by qgroupUsages once per qgroupCacheTTL.
+	usage, err := d.qgroupUsages()
+	if err != nil {
+		return vols, nil
+	}
+	for i := range vols {
+		if u, ok := usage[string(vols[i].ID)]; ok {
+			vols[i].Usage = u.referenced
+			vols[i].ExclusiveUsage = u.exclusive
+		}
+	}
+	return vols, nil
+}
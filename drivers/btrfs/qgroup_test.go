@@ -0,0 +1,50 @@
+package btrfs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQgroupShow(t *testing.T) {
+	out := `qgroupid         rfer         excl 
+--------         ----         ---- 
+0/5             16384        16384 
+0/257         1064960        16384 
+0/258         1064960      1048576 
+1/100         2129920      1064960 
+0/259           bad        16384 
+`
+	want := map[string]qgroupUsage{
+		"0/5":   {referenced: 16384, exclusive: 16384},
+		"0/257": {referenced: 1064960, exclusive: 16384},
+		"0/258": {referenced: 1064960, exclusive: 1048576},
+	}
+	assert.Equal(t, want, parseQgroupShow(out))
+	assert.Empty(t, parseQgroupShow("ERROR: can't list qgroups: quotas not enabled\n"))
+}
+
+func TestParseSubvolumeList(t *testing.T) {
+	out := `ID 257 gen 8 top level 5 path volumes/subvolumes/vol1
+ID 258 gen 9 top level 5 path volumes/subvolumes/vol with space
+ID 259 gen 10 top level 257 path snap1
+`
+	want := map[string]string{
+		"vol1":           "257",
+		"vol with space": "258",
+		"snap1":          "259",
+	}
+	assert.Equal(t, want, parseSubvolumeList(out))
+	assert.Empty(t, parseSubvolumeList(""))
+}
+
+func TestQgroupFailureCached(t *testing.T) {
+	d := &btrfsDriver{root: "/nonexistent"}
+	failed := errors.New("quotas not enabled")
+	d.qgroups.err = failed
+	d.qgroups.at = time.Now()
+	_, err := d.qgroupUsages()
+	assert.Equal(t, failed, err, "The failure should be reused within the TTL")
+}
@@ -0,0 +1,140 @@
+package btrfs
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// ScrubIntervalParam schedules a scrub of the filesystem at this
+	// interval, e.g. "168h". Scrubs are not scheduled by default.
+	ScrubIntervalParam = "scrub_interval"
+)
+
+// scrubber tracks the last known scrub status.
+type scrubber struct {
+	sync.Mutex
+	interval time.Duration
+	// active once a scrub was started by this driver.
+	active bool
+	last   api.ScrubStatus
+}
+
+// Scrub starts a scrub of the filesystem in the background.
+func (d *btrfsDriver) Scrub() error {
+	if err := btrfsCmd(nil, nil, "scrub", "start", d.root); err != nil {
+		return err
+	}
+	d.scrub.Lock()
+	d.scrub.active = true
+	d.scrub.Unlock()
+	return nil
+}
+
+// ScrubStatus returns the progress or result of the last scrub.
+func (d *btrfsDriver) ScrubStatus() (api.ScrubStatus, error) {
+	var out bytes.Buffer
+	if err := btrfsCmd(nil, &out, "scrub", "status", "-R", d.root); err != nil {
+		return api.ScrubStatus{}, err
+	}
+	return parseScrubStatus(out.String())
+}
+
+// parseScrubStatus parses the raw output of btrfs scrub status -R.
+func parseScrubStatus(out string) (api.ScrubStatus, error) {
+	var s api.ScrubStatus
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Contains(line, "running") {
+			s.Running = true
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(kv[1]), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "data_bytes_scrubbed", "tree_bytes_scrubbed":
+			s.BytesScrubbed += n
+		case "corrected_errors":
+			s.CorrectedErrors = n
+		case "uncorrectable_errors":
+			s.UncorrectableErrors = n
+		}
+	}
+	return s, nil
+}
+
+// checkScrub refreshes the scrub status and raises an alert when new
+// uncorrectable errors are found.
+func (d *btrfsDriver) checkScrub() {
+	d.scrub.Lock()
+	active := d.scrub.active
+	d.scrub.Unlock()
+	if !active {
+		return
+	}
+	s, err := d.ScrubStatus()
+	if err != nil {
+		log.Warnf("Failed to get scrub status of %v: %v", d.root, err)
+		return
+	}
+	d.scrub.Lock()
+	prev := d.scrub.last
+	d.scrub.last = s
+	d.scrub.Unlock()
+	if s.UncorrectableErrors > prev.UncorrectableErrors {
+		d.broker.Publish(api.Alert{
+			Type: api.AlertScrubErrors,
+			Time: time.Now(),
+			Message: fmt.Sprintf("Scrub of %v found %d uncorrectable errors",
+				d.root, s.UncorrectableErrors),
+		})
+	}
+}
+
+// scheduleScrub starts a scrub every interval until Shutdown.
+func (d *btrfsDriver) scheduleScrub() {
+	t := time.NewTicker(d.scrub.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-t.C:
+		}
+		if s, err := d.ScrubStatus(); err == nil && s.Running {
+			continue
+		}
+		if err := d.Scrub(); err != nil {
+			log.Warnf("Failed to start scrub of %v: %v", d.root, err)
+		}
+	}
+}
+
+// scrubStatus is the Status entry of the last scrub.
+func (d *btrfsDriver) scrubStatus() [][2]string {
+	d.scrub.Lock()
+	defer d.scrub.Unlock()
+	if !d.scrub.active {
+		return nil
+	}
+	s := d.scrub.last
+	return [][2]string{
+		{"Scrub Running", strconv.FormatBool(s.Running)},
+		{"Scrub Bytes", strconv.FormatUint(s.BytesScrubbed, 10)},
+		{"Scrub Corrected Errors", strconv.FormatUint(s.CorrectedErrors, 10)},
+		{"Scrub Uncorrectable Errors", strconv.FormatUint(s.UncorrectableErrors, 10)},
+	}
+}
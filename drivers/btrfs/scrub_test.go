@@ -0,0 +1,43 @@
+package btrfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestParseScrubStatus(t *testing.T) {
+	tests := []struct {
+		out  string
+		want api.ScrubStatus
+	}{
+		{"", api.ScrubStatus{}},
+		{`scrub status for 4f0e3c5a-0d3e-4ff1-b0c4-3a7e0cb6e6f3
+	scrub started at Thu Jan  1 10:00:00 2015 and finished after 00:00:05
+	data_extents_scrubbed: 12
+	tree_extents_scrubbed: 3
+	data_bytes_scrubbed: 1048576
+	tree_bytes_scrubbed: 49152
+	read_errors: 0
+	csum_errors: 2
+	corrected_errors: 2
+	uncorrectable_errors: 1
+	unverified_errors: 0
+`, api.ScrubStatus{BytesScrubbed: 1097728, CorrectedErrors: 2, UncorrectableErrors: 1}},
+		{`scrub status for 4f0e3c5a-0d3e-4ff1-b0c4-3a7e0cb6e6f3
+	scrub started at Thu Jan  1 10:00:00 2015, running for 00:00:10
+	data_bytes_scrubbed: 4096
+	tree_bytes_scrubbed: 0
+	corrected_errors: 0
+	uncorrectable_errors: 0
+`, api.ScrubStatus{Running: true, BytesScrubbed: 4096}},
+		{"\tdata_bytes_scrubbed: many\n", api.ScrubStatus{}},
+	}
+	for _, tt := range tests {
+		s, err := parseScrubStatus(tt.out)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, s, "Scrub status of %q", tt.out)
+	}
+}
@@ -0,0 +1,208 @@
+package btrfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// SnapDiff lists the changes from base to target by piping a metadata-only
+// btrfs send into btrfs receive --dump.
+func (d *btrfsDriver) SnapDiff(base, target api.SnapID) ([]api.BlockChange, error) {
+	b, err := d.GetSnap(base)
+	if err != nil {
+		return nil, err
+	}
+	t, err := d.GetSnap(target)
+	if err != nil {
+		return nil, err
+	}
+	if b.VolumeID != t.VolumeID {
+		return nil, fmt.Errorf("Snaps %v and %v are not of the same volume", base, target)
+	}
+	var paths [2]string
+	for i, id := range []api.SnapID{base, target} {
+		if paths[i], err = d.btrfs.Get(string(id), ""); err != nil {
+			return nil, err
+		}
+		// Both ends of a send must stay read-only while it runs.
+		release, err := holdReadOnly(paths[i])
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	r, w := io.Pipe()
+	var stderr bytes.Buffer
+	dump := exec.Command("btrfs", "receive", "--dump")
+	dump.Stdin = r
+	dump.Stderr = &stderr
+	out, err := dump.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = dump.Start(); err != nil {
+		return nil, err
+	}
+	sent := make(chan error, 1)
+	go func() {
+		err := btrfsCmd(nil, w, "send", "--no-data", "-p", paths[0], paths[1])
+		w.CloseWithError(err)
+		sent <- err
+	}()
+	changes, perr := parseSendDump(out)
+	err = dump.Wait()
+	// Fail the send's writes if receive exited before reading all of it.
+	r.Close()
+	serr := <-sent
+	if err != nil {
+		return nil, fmt.Errorf("btrfs receive --dump failed: %v: %s", err, stderr.String())
+	}
+	if serr != nil {
+		return nil, serr
+	}
+	return changes, perr
+}
+
+// parseSendDump converts btrfs receive --dump output into block changes.
+// Lines look like "update_extent ./dir/file offset=0 len=4096" or
+// "rename ./o257-7-0 dest=./dir/file". Whitespace in paths is backslash
+// escaped. New files and directories are created under temporary names and
+// renamed into place, so changes are tracked by their final path. Files that
+// are created, renamed or truncated are reported with a Length of 0, which
+// stands for everything from Offset to the end of the file.
+func parseSendDump(r io.Reader) ([]api.BlockChange, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	changes := []api.BlockChange{}
+	// created are the paths that do not exist in the base snapshot.
+	created := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := splitEscaped(line)
+		if len(fields) < 2 {
+			continue
+		}
+		p := strings.TrimPrefix(fields[1], "./")
+		switch fields[0] {
+		case "write", "update_extent", "clone", "truncate":
+			c := api.BlockChange{Path: p}
+			for _, kv := range fields[2:] {
+				var dst *uint64
+				switch {
+				case strings.HasPrefix(kv, "offset="), strings.HasPrefix(kv, "size="):
+					dst = &c.Offset
+				case strings.HasPrefix(kv, "len="):
+					dst = &c.Length
+				default:
+					continue
+				}
+				v := kv[strings.Index(kv, "=")+1:]
+				if *dst, err = strconv.ParseUint(v, 10, 64); err != nil {
+					return nil, fmt.Errorf("Unexpected send dump line %q", line)
+				}
+			}
+			if !created[p] {
+				changes = append(changes, c)
+			}
+		case "mkfile", "mkdir", "mknod", "mkfifo", "mksock", "symlink", "link":
+			created[p] = true
+			changes = append(changes, api.BlockChange{Path: p})
+		case "rename":
+			dest, ok := dumpValue(fields[2:], "dest")
+			if !ok {
+				return nil, fmt.Errorf("Unexpected send dump line %q", line)
+			}
+			dest = strings.TrimPrefix(dest, "./")
+			if created[p] {
+				changes = renameChanges(changes, created, p, dest)
+				break
+			}
+			created[dest] = true
+			changes = append(changes, api.BlockChange{Path: p, Deleted: true},
+				api.BlockChange{Path: dest})
+		case "unlink", "rmdir":
+			if created[p] {
+				changes = dropChanges(changes, p)
+				delete(created, p)
+				break
+			}
+			changes = append(changes, api.BlockChange{Path: p, Deleted: true})
+		}
+	}
+	return changes, nil
+}
+
+// dumpValue returns the value of key in the key=value fields of a dump line.
+func dumpValue(fields []string, key string) (string, bool) {
+	for _, kv := range fields {
+		if strings.HasPrefix(kv, key+"=") {
+			return kv[len(key)+1:], true
+		}
+	}
+	return "", false
+}
+
+// underPath returns true if p is dir or inside it.
+func underPath(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// renameChanges moves the changes and created paths at or under from to to.
+func renameChanges(changes []api.BlockChange, created map[string]bool, from, to string) []api.BlockChange {
+	for i := range changes {
+		if !changes[i].Deleted && underPath(changes[i].Path, from) {
+			changes[i].Path = to + changes[i].Path[len(from):]
+		}
+	}
+	for p := range created {
+		if underPath(p, from) {
+			delete(created, p)
+			created[to+p[len(from):]] = true
+		}
+	}
+	return changes
+}
+
+// dropChanges removes the changes to p, which no longer exists.
+func dropChanges(changes []api.BlockChange, p string) []api.BlockChange {
+	kept := changes[:0]
+	for _, c := range changes {
+		if c.Deleted || c.Path != p {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// splitEscaped splits s on whitespace that is not preceded by a backslash.
+func splitEscaped(s string) []string {
+	var fields []string
+	var cur []byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			cur = append(cur, s[i])
+		case s[i] == ' ' || s[i] == '\t':
+			if len(cur) > 0 {
+				fields = append(fields, string(cur))
+				cur = nil
+			}
+		default:
+			cur = append(cur, s[i])
+		}
+	}
+	if len(cur) > 0 {
+		fields = append(fields, string(cur))
+	}
+	return fields
+}
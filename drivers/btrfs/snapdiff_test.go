@@ -0,0 +1,73 @@
+package btrfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestParseSendDump(t *testing.T) {
+	tests := []struct {
+		name string
+		dump string
+		want []api.BlockChange
+	}{
+		{"empty", "", []api.BlockChange{}},
+		{"extents", `snapshot        ./snap2                         uuid=1 transid=9 parent_uuid=2 parent_transid=8
+update_extent   ./a                             offset=0 len=4096
+write           ./b                             offset=8192 len=512
+clone           ./c                             offset=0 len=4096 from=./a clone_offset=0
+utimes          ./a                             atime=2015-01-01T00:00:00+0000
+`, []api.BlockChange{
+			{Path: "a", Length: 4096},
+			{Path: "b", Offset: 8192, Length: 512},
+			{Path: "c", Length: 4096},
+		}},
+		{"truncate", "truncate ./a size=1024\n", []api.BlockChange{{Path: "a", Offset: 1024}}},
+		{"new file", `mkfile          ./o257-9-0
+rename          ./o257-9-0                      dest=./new
+update_extent   ./new                           offset=0 len=4096
+`, []api.BlockChange{{Path: "new"}}},
+		{"new directory", `mkdir           ./o258-9-0
+rename          ./o258-9-0                      dest=./dir
+mkfile          ./o259-9-0
+rename          ./o259-9-0                      dest=./dir/f
+rename          ./dir                           dest=./moved
+`, []api.BlockChange{{Path: "moved"}, {Path: "moved/f"}}},
+		{"rename", "rename ./old dest=./new\n", []api.BlockChange{
+			{Path: "old", Deleted: true},
+			{Path: "new"},
+		}},
+		{"links", `symlink ./sym dest=target
+link ./hard dest=a
+`, []api.BlockChange{{Path: "sym"}, {Path: "hard"}}},
+		{"removed", `unlink ./a
+rmdir ./dir
+mkfile ./o260-9-0
+unlink ./o260-9-0
+`, []api.BlockChange{
+			{Path: "a", Deleted: true},
+			{Path: "dir", Deleted: true},
+		}},
+		{"escaped", `update_extent ./with\ space offset=0 len=1`, []api.BlockChange{
+			{Path: "with space", Length: 1},
+		}},
+	}
+	for _, tt := range tests {
+		changes, err := parseSendDump(strings.NewReader(tt.dump))
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, changes, tt.name)
+	}
+
+	for _, dump := range []string{
+		"write ./a offset=x len=1\n",
+		"truncate ./a size=-1\n",
+		"rename ./a\n",
+	} {
+		_, err := parseSendDump(strings.NewReader(dump))
+		assert.Error(t, err, "Dump %q", dump)
+	}
+}
@@ -0,0 +1,70 @@
+package btrfs
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// snapMounts tracks the paths each snapshot is mounted at.
+type snapMounts struct {
+	sync.Mutex
+	paths map[api.SnapID]map[string]bool
+}
+
+// MountSnap bind mounts the snapshot subvolume read-only at mountpath.
+func (d *btrfsDriver) MountSnap(snapID api.SnapID, mountpath string) error {
+	if _, err := d.GetSnap(snapID); err != nil {
+		return volume.ErrSnapNotFound
+	}
+	dir, err := d.btrfs.Get(string(snapID), "")
+	if err != nil {
+		return err
+	}
+
+	d.snapMounts.Lock()
+	defer d.snapMounts.Unlock()
+	if d.snapMounts.paths[snapID][mountpath] {
+		return fmt.Errorf("Snapshot %v already mounted at %v", snapID, mountpath)
+	}
+	if err = syscall.Mount(dir, mountpath, "", syscall.MS_BIND, ""); err != nil {
+		return &volume.MountError{Source: dir, Target: mountpath, Err: err}
+	}
+	// A bind mount only becomes read-only on remount.
+	err = syscall.Mount("", mountpath, "",
+		syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, "")
+	if err != nil {
+		syscall.Unmount(mountpath, 0)
+		return fmt.Errorf("Failed to make %v read-only: %v", mountpath, err)
+	}
+	if d.snapMounts.paths[snapID] == nil {
+		d.snapMounts.paths[snapID] = make(map[string]bool)
+	}
+	d.snapMounts.paths[snapID][mountpath] = true
+	return nil
+}
+
+// UnmountSnap unmounts the snapshot from mountpath.
+func (d *btrfsDriver) UnmountSnap(snapID api.SnapID, mountpath string) error {
+	d.snapMounts.Lock()
+	defer d.snapMounts.Unlock()
+	if _, ok := d.snapMounts.paths[snapID]; !ok {
+		if _, err := d.GetSnap(snapID); err != nil {
+			return volume.ErrSnapNotFound
+		}
+	}
+	if !d.snapMounts.paths[snapID][mountpath] {
+		return fmt.Errorf("Snapshot %v not mounted at %v", snapID, mountpath)
+	}
+	if err := syscall.Unmount(mountpath, 0); err != nil {
+		return err
+	}
+	delete(d.snapMounts.paths[snapID], mountpath)
+	if len(d.snapMounts.paths[snapID]) == 0 {
+		delete(d.snapMounts.paths, snapID)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// +build linux
+
+package btrfs
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	graph "github.com/docker/docker/daemon/graphdriver"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/kvdb"
+	"github.com/libopenstorage/kvdb/mem"
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/pkg/chaos"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// fakeGraph tracks subvolumes in memory.
+type fakeGraph struct {
+	graph.Driver
+	sync.Mutex
+	subvols map[string]string
+}
+
+func (f *fakeGraph) Create(id, parent string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.subvols[id] = parent
+	return nil
+}
+
+func (f *fakeGraph) Get(id, mountLabel string) (string, error) {
+	f.Lock()
+	defer f.Unlock()
+	if _, ok := f.subvols[id]; !ok {
+		return "", fmt.Errorf("No subvolume %v", id)
+	}
+	return "/fake/" + id, nil
+}
+
+func (f *fakeGraph) Remove(id string) error {
+	f.Lock()
+	defer f.Unlock()
+	delete(f.subvols, id)
+	return nil
+}
+
+func newFakeDriver(t *testing.T) (*btrfsDriver, *fakeGraph) {
+	kv, err := kvdb.New(mem.Name, "btrfs_snapshot_test", []string{}, nil)
+	if err != nil {
+		t.Fatalf("Failed to initialize KVDB: %v", err)
+	}
+	g := &fakeGraph{subvols: make(map[string]string)}
+	return &btrfsDriver{
+		btrfs:             g,
+		ops:               volume.NewOpCounter(),
+		DefaultEnumerator: volume.NewDefaultEnumerator(Name, kv),
+	}, g
+}
+
+func TestSnapshotCrashWindow(t *testing.T) {
+	d, g := newFakeDriver(t)
+	vol := &api.Volume{ID: "snapvol", Spec: &api.VolumeSpec{}}
+	assert.NoError(t, d.CreateVol(vol), "Failed in CreateVol")
+
+	chaos.Activate(true)
+	defer chaos.Activate(false)
+	assert.NoError(t, chaos.Enable(koStrayCreate, chaos.Once, chaos.Error))
+	defer chaos.Disable(koStrayCreate)
+
+	_, err := d.Snapshot(vol.ID, nil)
+	assert.Error(t, err, "Snapshot should fail in the crash window")
+	snaps, err := d.SnapEnumerate([]api.VolumeID{vol.ID}, nil)
+	assert.NoError(t, err, "Failed in SnapEnumerate")
+	assert.Equal(t, 0, len(snaps), "No snapshot record should be left")
+	assert.Equal(t, 0, len(g.subvols), "Subvolume should be rolled back")
+
+	chaos.Disable(koStrayCreate)
+	id, err := d.Snapshot(vol.ID, nil)
+	assert.NoError(t, err, "Failed in Snapshot")
+	assert.Equal(t, string(vol.ID), g.subvols[string(id)], "Subvolume parent")
+}
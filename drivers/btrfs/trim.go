@@ -0,0 +1,42 @@
+package btrfs
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// Trim runs fstrim on the subvolume. Subvolumes live on the btrfs root
+// filesystem, so the volume does not need to be mounted. fstrim discards the
+// free space of the whole filesystem: all volumes of the driver are trimmed
+// and the count returned is for the filesystem, not for volumeID alone.
+func (d *btrfsDriver) Trim(volumeID api.VolumeID) (uint64, error) {
+	v, err := d.GetVol(volumeID)
+	if err != nil {
+		return 0, err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("fstrim", "-v", v.DevicePath)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("fstrim %v failed: %v: %s", v.DevicePath, err, stderr.String())
+	}
+	return parseTrimmed(string(out))
+}
+
+// parseTrimmed parses fstrim -v output of the form
+// "/path: 1048576 bytes were trimmed" or "/path: 1 MiB (1048576 bytes) trimmed".
+func parseTrimmed(out string) (uint64, error) {
+	fields := strings.Fields(strings.Replace(out, "(", " ", -1))
+	for i := 1; i < len(fields); i++ {
+		if strings.HasPrefix(fields[i], "bytes") {
+			return strconv.ParseUint(fields[i-1], 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("Unexpected fstrim output %q", out)
+}
@@ -0,0 +1,78 @@
+package btrfs
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// spaceUsage returns the logical and physical usage of the subvolume at p.
+// compsize accounts for compression and shared extents, btrfs filesystem du
+// only for shared extents and is used if compsize is not installed.
+func spaceUsage(p string) (api.VolumeStats, error) {
+	if _, err := exec.LookPath("compsize"); err == nil {
+		var stderr bytes.Buffer
+		cmd := exec.Command("compsize", "-b", p)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return api.VolumeStats{}, fmt.Errorf("compsize %v failed: %v: %s", p, err, stderr.String())
+		}
+		return parseCompsize(string(out))
+	}
+	var out bytes.Buffer
+	if err := btrfsCmd(nil, &out, "filesystem", "du", "-s", "--raw", p); err != nil {
+		return api.VolumeStats{}, err
+	}
+	return parseFilesystemDu(out.String())
+}
+
+// parseCompsize parses the TOTAL line of compsize -b output,
+// "TOTAL  30%  3407872  11534336  11534336": percentage, disk usage,
+// uncompressed and referenced bytes.
+func parseCompsize(out string) (api.VolumeStats, error) {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 5 || fields[0] != "TOTAL" {
+			continue
+		}
+		disk, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			break
+		}
+		referenced, err := strconv.ParseUint(fields[4], 10, 64)
+		if err != nil {
+			break
+		}
+		return api.VolumeStats{LogicalBytes: referenced, PhysicalBytes: disk}, nil
+	}
+	// An empty volume has no extents and no TOTAL line.
+	if !strings.Contains(out, "TOTAL") {
+		return api.VolumeStats{}, nil
+	}
+	return api.VolumeStats{}, fmt.Errorf("Unexpected compsize output %q", out)
+}
+
+// parseFilesystemDu parses btrfs filesystem du -s --raw output,
+// "12345  6789  1000  /path": total, exclusive and shared bytes.
+func parseFilesystemDu(out string) (api.VolumeStats, error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) >= 4 {
+		var n [3]uint64
+		var err error
+		for i := range n {
+			if n[i], err = strconv.ParseUint(fields[i], 10, 64); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			return api.VolumeStats{LogicalBytes: n[0], PhysicalBytes: n[1] + n[2]}, nil
+		}
+	}
+	return api.VolumeStats{}, fmt.Errorf("Unexpected btrfs filesystem du output %q", out)
+}
@@ -0,0 +1,59 @@
+package btrfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestParseCompsize(t *testing.T) {
+	tests := []struct {
+		out  string
+		want api.VolumeStats
+		err  bool
+	}{
+		{`Processed 3 files, 3 regular extents (3 refs), 0 inline.
+Type       Perc     Disk Usage   Uncompressed Referenced
+TOTAL       30%      3407872     11534336     11534336
+none       100%       524288       524288       524288
+zstd        27%      2883584     11010048     11010048
+`, api.VolumeStats{LogicalBytes: 11534336, PhysicalBytes: 3407872}, false},
+		{"No files.\n", api.VolumeStats{}, false},
+		{"TOTAL  30%  3.2M  11M  11M\n", api.VolumeStats{}, true},
+	}
+	for _, tt := range tests {
+		s, err := parseCompsize(tt.out)
+		if tt.err {
+			assert.Error(t, err, "Compsize output %q", tt.out)
+			continue
+		}
+		assert.NoError(t, err, "Compsize output %q", tt.out)
+		assert.Equal(t, tt.want, s, "Compsize output %q", tt.out)
+	}
+}
+
+func TestParseFilesystemDu(t *testing.T) {
+	tests := []struct {
+		out  string
+		want api.VolumeStats
+		err  bool
+	}{
+		{`     Total   Exclusive  Set shared  Filename
+  11534336     1048576    10485760  /var/lib/openstorage/btrfs/volumes/vol1
+`, api.VolumeStats{LogicalBytes: 11534336, PhysicalBytes: 11534336}, false},
+		{"0  0  0  /mnt/empty\n", api.VolumeStats{}, false},
+		{"", api.VolumeStats{}, true},
+		{"11.00MiB  1.00MiB  10.00MiB  /mnt/human\n", api.VolumeStats{}, true},
+	}
+	for _, tt := range tests {
+		s, err := parseFilesystemDu(tt.out)
+		if tt.err {
+			assert.Error(t, err, "Du output %q", tt.out)
+			continue
+		}
+		assert.NoError(t, err, "Du output %q", tt.out)
+		assert.Equal(t, tt.want, s, "Du output %q", tt.out)
+	}
+}
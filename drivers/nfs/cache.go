@@ -0,0 +1,437 @@
+package nfs
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	// EnableCacheParam set to "true" mounts volumes through an overlay whose
+	// upper layer is a local cache directory under CachePathParam.
+	EnableCacheParam = "enable-cache"
+	// CachePathParam local directory that holds the cache of each volume.
+	CachePathParam = "cache-path"
+	// CacheSizeParam bounds the cache in bytes, DefaultCacheSize if not set.
+	CacheSizeParam = "cache-size"
+	// DefaultCacheSize of 10GB.
+	DefaultCacheSize = 10 << 30
+
+	// cacheFlushInterval between write backs of a mounted volume's cache.
+	cacheFlushInterval = 30 * time.Second
+	// cacheDirty marks a cache with writes not yet flushed to the export.
+	cacheDirty   = "dirty"
+	opaqueXattr  = "trusted.overlay.opaque"
+	cacheTmpName = ".osd-cache-"
+)
+
+// volumeCache keeps a local overlay upper layer for each volume, with the
+// volume directory on the export as the lower layer. Files written or copied
+// up are served locally and written back to the export every
+// cacheFlushInterval and at unmount, after which they stay as a read cache
+// for the next mount. Caches of unmounted volumes are evicted least recently
+// used first when the cache grows over size.
+type volumeCache struct {
+	sync.Mutex
+	path string
+	size uint64
+	// flushers stop the write back of the volumes mounted with the cache.
+	flushers map[api.VolumeID]chan struct{}
+}
+
+// parseCache returns the cache configured in params, nil if it is not
+// enabled.
+func parseCache(params volume.DriverParams) (*volumeCache, error) {
+	v, ok := params[EnableCacheParam]
+	if !ok {
+		return nil, nil
+	}
+	enabled, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s %q: %v", EnableCacheParam, v, err)
+	}
+	if !enabled {
+		return nil, nil
+	}
+	c := &volumeCache{
+		path:     params[CachePathParam],
+		size:     DefaultCacheSize,
+		flushers: make(map[api.VolumeID]chan struct{}),
+	}
+	if c.path == "" {
+		return nil, fmt.Errorf("%s requires %s", EnableCacheParam, CachePathParam)
+	}
+	if v, ok := params[CacheSizeParam]; ok {
+		if c.size, err = strconv.ParseUint(v, 10, 64); err != nil || c.size == 0 {
+			return nil, fmt.Errorf("Invalid %s %q", CacheSizeParam, v)
+		}
+	}
+	if err = os.MkdirAll(c.path, 0700); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *volumeCache) dir(volumeID api.VolumeID) string {
+	return filepath.Join(c.path, string(volumeID))
+}
+
+func (c *volumeCache) upper(volumeID api.VolumeID) string {
+	return filepath.Join(c.dir(volumeID), "upper")
+}
+
+// mount the overlay of the cache of volumeID over lower at mountpath. Writes
+// left over from a mount that could not be flushed are flushed first, and
+// cached files that changed on the export are dropped.
+func (c *volumeCache) mount(volumeID api.VolumeID, lower, mountpath string, opts *api.MountOptions) error {
+	c.Lock()
+	defer c.Unlock()
+	dir := c.dir(volumeID)
+	upper := c.upper(volumeID)
+	work := filepath.Join(dir, "work")
+	// The overlay options are separated by commas and colons.
+	if strings.ContainsAny(lower+upper, ",:") {
+		return fmt.Errorf("Cannot cache %v, its path contains ',' or ':'", lower)
+	}
+	for _, p := range []string{upper, work} {
+		if err := os.MkdirAll(p, 0755); err != nil {
+			return err
+		}
+	}
+	dirty := filepath.Join(dir, cacheDirty)
+	if _, err := os.Stat(dirty); err == nil {
+		if err = flushCache(upper, lower, true); err != nil {
+			return fmt.Errorf("Cache of %v has writes not flushed to the export: %v", volumeID, err)
+		}
+		os.Remove(dirty)
+	}
+	if err := dropStale(upper, lower); err != nil {
+		return err
+	}
+	data := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", lower, upper, work)
+	if err := volume.MountWithOptions("overlay", mountpath, "overlay", 0, data, opts); err != nil {
+		return err
+	}
+	now := time.Now()
+	os.Chtimes(dir, now, now)
+	stop := make(chan struct{})
+	c.flushers[volumeID] = stop
+	go c.flusher(volumeID, lower, stop)
+	return nil
+}
+
+// flusher writes the cache of volumeID back to lower until stop is closed.
+func (c *volumeCache) flusher(volumeID api.VolumeID, lower string, stop chan struct{}) {
+	t := time.NewTicker(cacheFlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+		c.Lock()
+		select {
+		case <-stop:
+		default:
+			if err := flushCache(c.upper(volumeID), lower, false); err != nil {
+				log.Warnf("Failed to flush the cache of %v: %v", volumeID, err)
+			}
+		}
+		c.Unlock()
+	}
+}
+
+// stopFlusher must be called with c locked.
+func (c *volumeCache) stopFlusher(volumeID api.VolumeID) {
+	if stop, ok := c.flushers[volumeID]; ok {
+		close(stop)
+		delete(c.flushers, volumeID)
+	}
+}
+
+// unmounted flushes the cache of volumeID once its overlay is unmounted. If
+// the flush fails the cache is marked dirty and flushed at the next mount.
+func (c *volumeCache) unmounted(volumeID api.VolumeID, lower string) error {
+	c.Lock()
+	defer c.Unlock()
+	c.stopFlusher(volumeID)
+	upper := c.upper(volumeID)
+	if _, err := os.Stat(upper); os.IsNotExist(err) {
+		return nil
+	}
+	if err := flushCache(upper, lower, true); err != nil {
+		ioutil.WriteFile(filepath.Join(c.dir(volumeID), cacheDirty), nil, 0600)
+		return err
+	}
+	now := time.Now()
+	os.Chtimes(c.dir(volumeID), now, now)
+	return c.evict()
+}
+
+// released marks the cache of volumeID dirty after its overlay was forcibly
+// unmounted without a flush.
+func (c *volumeCache) released(volumeID api.VolumeID) {
+	c.Lock()
+	defer c.Unlock()
+	c.stopFlusher(volumeID)
+	if _, err := os.Stat(c.upper(volumeID)); err == nil {
+		ioutil.WriteFile(filepath.Join(c.dir(volumeID), cacheDirty), nil, 0600)
+	}
+}
+
+// remove the cache of a deleted volume.
+func (c *volumeCache) remove(volumeID api.VolumeID) error {
+	c.Lock()
+	defer c.Unlock()
+	c.stopFlusher(volumeID)
+	return os.RemoveAll(c.dir(volumeID))
+}
+
+// cacheEntry is the cache of one volume, for eviction.
+type cacheEntry struct {
+	dir   string
+	used  time.Time
+	bytes uint64
+}
+
+type byUse []cacheEntry
+
+func (e byUse) Len() int           { return len(e) }
+func (e byUse) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e byUse) Less(i, j int) bool { return e[i].used.Before(e[j].used) }
+
+// evict the caches of unmounted volumes, least recently used first, until
+// the cache fits in size. Dirty caches are kept. c must be locked.
+func (c *volumeCache) evict() error {
+	infos, err := ioutil.ReadDir(c.path)
+	if err != nil {
+		return err
+	}
+	var total uint64
+	var evictable []cacheEntry
+	for _, fi := range infos {
+		if !fi.IsDir() {
+			continue
+		}
+		e := cacheEntry{dir: filepath.Join(c.path, fi.Name()), used: fi.ModTime()}
+		e.bytes = dirSize(e.dir)
+		total += e.bytes
+		_, mounted := c.flushers[api.VolumeID(fi.Name())]
+		if _, err := os.Stat(filepath.Join(e.dir, cacheDirty)); mounted || err == nil {
+			continue
+		}
+		evictable = append(evictable, e)
+	}
+	sort.Sort(byUse(evictable))
+	for _, e := range evictable {
+		if total <= c.size {
+			break
+		}
+		if err = os.RemoveAll(e.dir); err != nil {
+			return err
+		}
+		total -= e.bytes
+	}
+	return nil
+}
+
+// dirSize sums the size of the regular files under dir.
+func dirSize(dir string) uint64 {
+	var n uint64
+	filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			n += uint64(fi.Size())
+		}
+		return nil
+	})
+	return n
+}
+
+// isWhiteout returns true if fi is an overlay whiteout, a character device
+// with device number 0.
+func isWhiteout(fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && fi.Mode()&os.ModeCharDevice != 0 && st.Rdev == 0
+}
+
+// isOpaque returns true if the upper directory p hides the lower one.
+func isOpaque(p string) bool {
+	buf := make([]byte, 1)
+	n, err := syscall.Getxattr(p, opaqueXattr, buf)
+	return err == nil && n == 1 && buf[0] == 'y'
+}
+
+// sameFile returns true if the cached file and the export's file are the
+// same, the copy back keeps the modification time.
+func sameFile(cached, exported os.FileInfo) bool {
+	return exported.Mode() == cached.Mode() &&
+		exported.Size() == cached.Size() &&
+		exported.ModTime().Unix() == cached.ModTime().Unix()
+}
+
+// flushCache writes the files, directories and deletions in upper back to
+// lower. With clean the whiteouts and opaque markers are dropped once
+// applied, which may only be done while the overlay is not mounted.
+func flushCache(upper, lower string, clean bool) error {
+	return filepath.Walk(upper, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || p == upper {
+			return err
+		}
+		dst := filepath.Join(lower, p[len(upper):])
+		switch {
+		case isWhiteout(fi):
+			if err = os.RemoveAll(dst); err != nil || !clean {
+				return err
+			}
+			return os.Remove(p)
+		case fi.IsDir():
+			if st, err := os.Lstat(dst); err == nil && !st.IsDir() {
+				os.Remove(dst)
+			}
+			if err = os.MkdirAll(dst, fi.Mode().Perm()); err != nil {
+				return err
+			}
+			if err = os.Chmod(dst, fi.Mode().Perm()); err != nil {
+				return err
+			}
+			if !isOpaque(p) {
+				return nil
+			}
+			if err = removeHidden(p, dst); err != nil || !clean {
+				return err
+			}
+			return syscall.Removexattr(p, opaqueXattr)
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if cur, err := os.Readlink(dst); err == nil && cur == target {
+				return nil
+			}
+			os.RemoveAll(dst)
+			return os.Symlink(target, dst)
+		case fi.Mode().IsRegular():
+			return copyBack(p, dst, fi)
+		}
+		return nil
+	})
+}
+
+// removeHidden removes the entries of the lower directory that the opaque
+// upper directory hides.
+func removeHidden(upper, lower string) error {
+	infos, err := ioutil.ReadDir(lower)
+	if err != nil {
+		return err
+	}
+	for _, fi := range infos {
+		if _, err = os.Lstat(filepath.Join(upper, fi.Name())); os.IsNotExist(err) {
+			if err = os.RemoveAll(filepath.Join(lower, fi.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyBack copies the cached file src to dst unless they are the same. The
+// copy is renamed into place so that readers never see a partial file.
+func copyBack(src, dst string, fi os.FileInfo) error {
+	if st, err := os.Lstat(dst); err == nil {
+		if sameFile(fi, st) {
+			return nil
+		}
+		if st.IsDir() {
+			if err = os.RemoveAll(dst); err != nil {
+				return err
+			}
+		}
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := filepath.Join(filepath.Dir(dst), cacheTmpName+filepath.Base(dst))
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, fi.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, fi.ModTime(), fi.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// dropStale removes the cached files that no longer match the export, which
+// was changed by another client since they were flushed.
+func dropStale(upper, lower string) error {
+	var dirs []string
+	err := filepath.Walk(upper, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || p == upper {
+			return err
+		}
+		dst := filepath.Join(lower, p[len(upper):])
+		st, lerr := os.Lstat(dst)
+		switch {
+		case fi.IsDir():
+			dirs = append(dirs, p)
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, _ := os.Readlink(p)
+			if cur, err := os.Readlink(dst); err != nil || cur != target {
+				return os.Remove(p)
+			}
+		case lerr != nil || !sameFile(fi, st):
+			return os.Remove(p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Directories removed from the export are dropped once empty, children
+	// first.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dst := filepath.Join(lower, dirs[i][len(upper):])
+		if _, err = os.Lstat(dst); os.IsNotExist(err) {
+			os.Remove(dirs[i])
+		}
+	}
+	return nil
+}
+
+// cacheStatus describes the cache for Status.
+func (d *nfsDriver) cacheStatus() [2]string {
+	if d.cache == nil {
+		return [2]string{"Cache", "false"}
+	}
+	return [2]string{"Cache", fmt.Sprintf("%s, %d bytes", d.cache.path, d.cache.size)}
+}
@@ -0,0 +1,152 @@
+package nfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+func writeFile(t *testing.T, p, data string) {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseCache(t *testing.T) {
+	c, err := parseCache(volume.DriverParams{})
+	if err != nil || c != nil {
+		t.Fatalf("The cache should be off by default: %v %v", c, err)
+	}
+	if _, err = parseCache(volume.DriverParams{EnableCacheParam: "true"}); err == nil {
+		t.Error("The cache should require a path")
+	}
+	dir, err := ioutil.TempDir("", "nfs_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, err = parseCache(volume.DriverParams{
+		EnableCacheParam: "true",
+		CachePathParam:   dir,
+		CacheSizeParam:   "1024",
+	})
+	if err != nil || c == nil || c.size != 1024 {
+		t.Fatalf("Failed to parse the cache params: %v %v", c, err)
+	}
+}
+
+func TestFlushCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfs_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	upper := filepath.Join(dir, "upper")
+	lower := filepath.Join(dir, "lower")
+	writeFile(t, filepath.Join(lower, "kept"), "export")
+	writeFile(t, filepath.Join(upper, "new"), "written")
+	writeFile(t, filepath.Join(upper, "dir", "nested"), "nested")
+	if err = os.Symlink("new", filepath.Join(upper, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = flushCache(upper, lower, true); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	for p, want := range map[string]string{
+		"kept":       "export",
+		"new":        "written",
+		"dir/nested": "nested",
+		"link":       "written",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(lower, p))
+		if err != nil || string(data) != want {
+			t.Errorf("%s on the export is %q, %v, want %q", p, data, err, want)
+		}
+	}
+
+	// Flushed files are kept as a cache until the export changes.
+	if err = dropStale(upper, lower); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(upper, "new")); err != nil {
+		t.Errorf("Flushed file should stay cached: %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err = os.Chtimes(filepath.Join(lower, "new"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.RemoveAll(filepath.Join(lower, "dir")); err != nil {
+		t.Fatal(err)
+	}
+	if err = dropStale(upper, lower); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"new", "dir/nested", "dir"} {
+		if _, err = os.Lstat(filepath.Join(upper, p)); !os.IsNotExist(err) {
+			t.Errorf("Stale %s should be dropped from the cache: %v", p, err)
+		}
+	}
+	if _, err = os.Lstat(filepath.Join(upper, "link")); err != nil {
+		t.Errorf("Unchanged link should stay cached: %v", err)
+	}
+}
+
+func TestEvictCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfs_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := &volumeCache{
+		path:     dir,
+		size:     10,
+		flushers: map[api.VolumeID]chan struct{}{"mounted": make(chan struct{})},
+	}
+	now := time.Now()
+	for i, id := range []api.VolumeID{"mounted", "dirty", "old", "recent"} {
+		writeFile(t, filepath.Join(c.upper(id), "data"), "0123456789")
+		used := now.Add(time.Duration(i) * time.Minute)
+		if err = os.Chtimes(c.dir(id), used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(c.dir("dirty"), cacheDirty), "")
+
+	if err = c.evict(); err != nil {
+		t.Fatalf("Failed to evict: %v", err)
+	}
+	for id, kept := range map[api.VolumeID]bool{
+		"mounted": true,
+		"dirty":   true,
+		"old":     false,
+		"recent":  false,
+	} {
+		if _, err = os.Stat(c.dir(id)); (err == nil) != kept {
+			t.Errorf("Cache of %s kept %v, want %v", id, err == nil, kept)
+		}
+	}
+
+	c.size = 30
+	writeFile(t, filepath.Join(c.upper("old"), "data"), "0123456789")
+	writeFile(t, filepath.Join(c.upper("recent"), "data"), "0123456789")
+	os.Chtimes(c.dir("old"), now, now)
+	os.Chtimes(c.dir("recent"), now.Add(time.Hour), now.Add(time.Hour))
+	if err = c.evict(); err != nil {
+		t.Fatalf("Failed to evict: %v", err)
+	}
+	if _, err = os.Stat(c.dir("old")); !os.IsNotExist(err) {
+		t.Error("The least recently used cache should be evicted")
+	}
+	if _, err = os.Stat(c.dir("recent")); err != nil {
+		t.Errorf("The recently used cache should be kept: %v", err)
+	}
+}
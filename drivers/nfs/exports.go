@@ -0,0 +1,204 @@
+package nfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// showmountTimeout bounds the query of the exports, showmount hangs on
+// servers that drop mountd requests.
+const showmountTimeout = 10 * time.Second
+
+// nfsExport is a directory the server exports and the clients it is
+// exported to.
+type nfsExport struct {
+	path    string
+	clients string
+}
+
+// queryExports lists the exports of server with showmount.
+func queryExports(server string) ([]nfsExport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), showmountTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "showmount", "--exports", "--no-headers", server)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("showmount %v timed out after %v", server, showmountTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("showmount %v failed: %v: %s",
+			server, err, strings.TrimSpace(stderr.String()))
+	}
+	return parseExports(string(out)), nil
+}
+
+// parseExports parses showmount output, one "path clients" line per export.
+func parseExports(out string) []nfsExport {
+	var exports []nfsExport
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		e := nfsExport{path: fields[0]}
+		if len(fields) > 1 {
+			e.clients = strings.Join(fields[1:], " ")
+		}
+		exports = append(exports, e)
+	}
+	return exports
+}
+
+// nfsClient identifies this node in the client lists of exports.
+type nfsClient struct {
+	hostname string
+	addrs    []net.IP
+	// unknown true if this node could not be identified, all clients are
+	// then assumed to include it.
+	unknown bool
+}
+
+// localClient returns the hostname and the interface addresses of this
+// node.
+func localClient() (nfsClient, error) {
+	var c nfsClient
+	hostname, err := os.Hostname()
+	if err != nil {
+		return c, err
+	}
+	c.hostname = strings.ToLower(hostname)
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return c, err
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok {
+			c.addrs = append(c.addrs, ipnet.IP)
+		}
+	}
+	return c, nil
+}
+
+// allows returns true if the comma separated clients of an export, as
+// listed by showmount, may include c. Netgroups cannot be resolved here
+// and are assumed to include it.
+func (c nfsClient) allows(clients string) bool {
+	if clients == "" || c.unknown {
+		return true
+	}
+	for _, client := range strings.Split(clients, ",") {
+		client = strings.ToLower(strings.TrimSpace(client))
+		switch {
+		case client == "*" || client == "(everyone)" || strings.HasPrefix(client, "@"):
+			return true
+		case strings.Contains(client, "/"):
+			if c.inNetwork(client) {
+				return true
+			}
+		case net.ParseIP(client) != nil:
+			for _, ip := range c.addrs {
+				if ip.Equal(net.ParseIP(client)) {
+					return true
+				}
+			}
+		default:
+			short := strings.SplitN(c.hostname, ".", 2)[0]
+			if ok, _ := path.Match(client, c.hostname); ok || client == short {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inNetwork returns true if one of the addresses of c is in network, given
+// as address/prefix length or address/netmask.
+func (c nfsClient) inNetwork(network string) bool {
+	_, ipnet, err := net.ParseCIDR(network)
+	if err != nil {
+		parts := strings.SplitN(network, "/", 2)
+		ip, mask := net.ParseIP(parts[0]), net.ParseIP(parts[1])
+		if ip == nil || mask == nil || ip.To4() == nil || mask.To4() == nil {
+			return false
+		}
+		m := net.IPMask(mask.To4())
+		ipnet = &net.IPNet{IP: ip.To4().Mask(m), Mask: m}
+	}
+	for _, ip := range c.addrs {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkExport returns an error listing exports if p is not one of them or
+// a directory within one of them, or if none of those is exported to
+// client.
+func checkExport(server, p string, exports []nfsExport, client nfsClient) error {
+	p = path.Clean(p)
+	names := make([]string, 0, len(exports))
+	var denied []string
+	for _, e := range exports {
+		ep := path.Clean(e.path)
+		names = append(names, fmt.Sprintf("%s (%s)", e.path, e.clients))
+		if p != ep && ep != "/" && !strings.HasPrefix(p, ep+"/") {
+			continue
+		}
+		if client.allows(e.clients) {
+			return nil
+		}
+		denied = append(denied, fmt.Sprintf("%s (%s)", e.path, e.clients))
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("NFS server %s does not export %s to this node %s, exported as: %s",
+			server, p, client.hostname, strings.Join(denied, ", "))
+	}
+	return fmt.Errorf("NFS server %s does not export %s, available exports: %s",
+		server, p, strings.Join(names, ", "))
+}
+
+// validateExport checks that the configured path is exported by the server
+// and caches the exports for Status. Servers that cannot be queried, such
+// as NFSv4 only servers without mountd, are not checked.
+func (d *nfsDriver) validateExport() error {
+	if _, err := exec.LookPath("showmount"); err != nil {
+		log.Warnf("Cannot check the exports of %s: %v", d.nfsServer, err)
+		return nil
+	}
+	exports, err := queryExports(d.nfsServer)
+	if err != nil {
+		log.Warnf("Cannot check the exports of %s: %v", d.nfsServer, err)
+		return nil
+	}
+	d.exports = exports
+	client, err := localClient()
+	if err != nil {
+		log.Warnf("Cannot check the clients of the exports of %s: %v", d.nfsServer, err)
+		client = nfsClient{unknown: true}
+	}
+	return checkExport(d.nfsServer, d.nfsPath, exports, client)
+}
+
+// exportsStatus is the Status entry listing the server's exports.
+func (d *nfsDriver) exportsStatus() [2]string {
+	if d.exports == nil {
+		return [2]string{"Exports", "unknown"}
+	}
+	paths := make([]string, len(d.exports))
+	for i, e := range d.exports {
+		paths[i] = e.path
+	}
+	return [2]string{"Exports", strings.Join(paths, ",")}
+}
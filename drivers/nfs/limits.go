@@ -0,0 +1,129 @@
+package nfs
+
+import (
+	"fmt"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	// MaxVolumesParam limits the number of volumes on the export.
+	MaxVolumesParam = "max-volumes"
+	// MaxTenantVolumesParam limits the number of volumes per tenant.
+	MaxTenantVolumesParam = "max-volumes-per-tenant"
+	// TenantLabelParam names the volume label that identifies the tenant,
+	// DefaultTenantLabel if not set.
+	TenantLabelParam = "tenant-label"
+	// DefaultTenantLabel volume label that identifies the tenant.
+	DefaultTenantLabel = "tenant"
+)
+
+// volumeLimits caps the number of volumes, no limit if 0.
+type volumeLimits struct {
+	max         int
+	perTenant   int
+	tenantLabel string
+}
+
+// parseLimits applies the limit params in params to l.
+func parseLimits(l volumeLimits, params volume.DriverParams) (volumeLimits, error) {
+	for _, k := range []string{MaxVolumesParam, MaxTenantVolumesParam} {
+		v, ok := params[k]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return l, fmt.Errorf("Invalid %s %q", k, v)
+		}
+		if k == MaxVolumesParam {
+			l.max = n
+		} else {
+			l.perTenant = n
+		}
+	}
+	if v, ok := params[TenantLabelParam]; ok {
+		l.tenantLabel = v
+	}
+	if l.tenantLabel == "" {
+		l.tenantLabel = DefaultTenantLabel
+	}
+	return l, nil
+}
+
+// countedVolumes returns the volumes that count against the limits, which
+// include the volumes in the trash as their directories are still on the
+// export.
+func (d *nfsDriver) countedVolumes() ([]*nfsVolume, error) {
+	vols, err := d.enumerate()
+	if err != nil {
+		return nil, err
+	}
+	trashed, err := d.enumerateTrash()
+	if err != nil {
+		return nil, err
+	}
+	return append(vols, trashed...), nil
+}
+
+// checkLimits returns ErrQuotaExceeded if creating a volume with locator
+// would exceed the limits. The caller must hold createLock.
+func (d *nfsDriver) checkLimits(locator api.VolumeLocator) error {
+	d.configLock.Lock()
+	l := d.limits
+	d.configLock.Unlock()
+	if l.max == 0 && l.perTenant == 0 {
+		return nil
+	}
+	vols, err := d.countedVolumes()
+	if err != nil {
+		return err
+	}
+	if l.max > 0 && len(vols) >= l.max {
+		log.Printf("Export has %v of %v volumes", len(vols), l.max)
+		return volume.ErrQuotaExceeded
+	}
+	tenant, ok := locator.VolumeLabels[l.tenantLabel]
+	if l.perTenant == 0 || !ok {
+		return nil
+	}
+	n := 0
+	for _, v := range vols {
+		if t, ok := v.Locator.VolumeLabels[l.tenantLabel]; ok && t == tenant {
+			n++
+		}
+	}
+	if n >= l.perTenant {
+		log.Printf("Tenant %v has %v of %v volumes", tenant, n, l.perTenant)
+		return volume.ErrQuotaExceeded
+	}
+	return nil
+}
+
+// limitsStatus reports the volume count and limit for Status.
+func (d *nfsDriver) limitsStatus() [][2]string {
+	d.configLock.Lock()
+	l := d.limits
+	d.configLock.Unlock()
+	count := "unknown"
+	if vols, err := d.countedVolumes(); err == nil {
+		count = strconv.Itoa(len(vols))
+	}
+	max := "none"
+	if l.max > 0 {
+		max = strconv.Itoa(l.max)
+	}
+	perTenant := "none"
+	if l.perTenant > 0 {
+		perTenant = strconv.Itoa(l.perTenant)
+	}
+	return [][2]string{
+		{"Volumes", count},
+		{"Max Volumes", max},
+		{"Max Volumes Per Tenant", perTenant},
+	}
+}
@@ -0,0 +1,45 @@
+package nfs
+
+import (
+	"sync"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// volumeLocks serializes operations that change where a volume is mounted
+// or stored.
+type volumeLocks struct {
+	sync.Mutex
+	locks map[api.VolumeID]*volumeLock
+}
+
+type volumeLock struct {
+	sync.Mutex
+	// users holding or waiting for the lock.
+	users int
+}
+
+// lock volumeID and return the function that unlocks it.
+func (l *volumeLocks) lock(volumeID api.VolumeID) func() {
+	l.Lock()
+	if l.locks == nil {
+		l.locks = make(map[api.VolumeID]*volumeLock)
+	}
+	vl := l.locks[volumeID]
+	if vl == nil {
+		vl = &volumeLock{}
+		l.locks[volumeID] = vl
+	}
+	vl.users++
+	l.Unlock()
+
+	vl.Lock()
+	return func() {
+		vl.Unlock()
+		l.Lock()
+		if vl.users--; vl.users == 0 {
+			delete(l.locks, volumeID)
+		}
+		l.Unlock()
+	}
+}
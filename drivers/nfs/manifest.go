@@ -0,0 +1,193 @@
+package nfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// ExportManifest serializes the volume and trash records kept under the
+// dbKey. The embedded DefaultEnumerator is not used by this driver.
+func (d *nfsDriver) ExportManifest() ([]byte, error) {
+	vols, err := d.enumerate()
+	if err != nil {
+		return nil, err
+	}
+	trashed, err := d.enumerateTrash()
+	if err != nil {
+		return nil, err
+	}
+	m := &volume.Manifest{
+		Version: volume.ManifestVersion,
+		Driver:  d.name,
+		Ctime:   time.Now(),
+		Volumes: make([]api.Volume, 0, len(vols)),
+		Records: make([]json.RawMessage, 0, len(vols)+len(trashed)),
+	}
+	for _, v := range append(vols, trashed...) {
+		r, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		m.Records = append(m.Records, r)
+		if v.Deleted.IsZero() {
+			m.Volumes = append(m.Volumes, v.volume())
+		}
+	}
+	return json.Marshal(m)
+}
+
+// parseManifest decodes the records of data and checks that they can be
+// imported into d.
+func (d *nfsDriver) parseManifest(data []byte) ([]*nfsVolume, error) {
+	m, err := volume.ParseManifest(data, d.name)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Snapshots) > 0 {
+		return nil, fmt.Errorf("Manifest has snapshots, which %v does not support", d.name)
+	}
+	if len(m.Volumes) > 0 && len(m.Records) == 0 {
+		return nil, fmt.Errorf("Manifest has no %v records", d.name)
+	}
+	trash := path.Clean(d.mountPath + trashDir)
+	ids := make(map[api.VolumeID]bool, len(m.Records))
+	vs := make([]*nfsVolume, 0, len(m.Records))
+	for _, r := range m.Records {
+		v := &nfsVolume{}
+		if err = json.Unmarshal(r, v); err != nil {
+			return nil, fmt.Errorf("Failed to parse manifest: %v", err)
+		}
+		if v.Id == api.BadVolumeID || ids[v.Id] {
+			return nil, fmt.Errorf("Manifest has an empty or duplicate volume ID %q", v.Id)
+		}
+		ids[v.Id] = true
+		if v.Device != path.Clean(v.Device) ||
+			!strings.HasPrefix(v.Device, d.mountPath) || v.Device+"/" == d.mountPath {
+			return nil, fmt.Errorf("Volume %v: %v is not a directory under %v", v.Id, v.Device, d.mountPath)
+		}
+		if overlaps(v.Device, trash) {
+			return nil, fmt.Errorf("Volume %v: %v overlaps the trash directory %v", v.Id, v.Device, trash)
+		}
+		reconcileImported(v)
+		vs = append(vs, v)
+	}
+	return vs, nil
+}
+
+// reconcileImported clears the mounts of v that did not survive the loss of
+// the kvdb.
+func reconcileImported(v *nfsVolume) {
+	if v.Mounted {
+		if mounted, err := volume.IsMountPoint(v.Mountpath); err != nil || !mounted {
+			v.Mounted = false
+		}
+	}
+	if !v.Mounted {
+		v.Mountpath = ""
+		v.MountOptions = nil
+	}
+	v.SubPathMounts = volume.MountedPaths(v.SubPathMounts)
+}
+
+// ImportManifest restores the records of a manifest written by
+// ExportManifest. With ConflictFail, nothing is written if any record exists.
+// The directories of the live volumes must not overlap after the import.
+func (d *nfsDriver) ImportManifest(data []byte, opts volume.ImportManifestOptions) error {
+	if !opts.DryRun {
+		if err := d.CheckWritable(); err != nil {
+			return err
+		}
+	}
+	onConflict, err := opts.Conflict()
+	if err != nil {
+		return err
+	}
+	vs, err := d.parseManifest(data)
+	if err != nil {
+		return err
+	}
+
+	d.createLock.Lock()
+	defer d.createLock.Unlock()
+	existing, err := d.enumerate()
+	if err != nil {
+		return err
+	}
+	owners := make(map[api.VolumeID]string, len(existing)+len(vs))
+	for _, v := range existing {
+		owners[v.Id] = v.Device
+	}
+	exists := make(map[api.VolumeID]bool)
+	for _, v := range vs {
+		_, err := d.get(string(v.Id))
+		if _, terr := d.getTrashed(string(v.Id)); err == nil || terr == nil {
+			if onConflict == volume.ConflictFail {
+				return fmt.Errorf("Volume %v already exists", v.Id)
+			}
+			exists[v.Id] = true
+			if onConflict == volume.ConflictSkip {
+				continue
+			}
+		}
+		if v.Deleted.IsZero() {
+			owners[v.Id] = v.Device
+		} else {
+			delete(owners, v.Id)
+		}
+	}
+	for id, dir := range owners {
+		for other, otherDir := range owners {
+			if id < other && overlaps(dir, otherDir) {
+				return fmt.Errorf("Volume %v at %v overlaps volume %v at %v", id, dir, other, otherDir)
+			}
+		}
+	}
+	if opts.DryRun {
+		return nil
+	}
+
+	for _, v := range vs {
+		if exists[v.Id] && onConflict == volume.ConflictSkip {
+			continue
+		}
+		if err = d.importRecord(v); err != nil {
+			return fmt.Errorf("Failed to import volume %v: %v", v.Id, err)
+		}
+	}
+	return nil
+}
+
+// importRecord writes v to the volume or trash records, replacing the
+// existing record of the volume. The mounts of an existing record are kept,
+// they are current.
+func (d *nfsDriver) importRecord(v *nfsVolume) error {
+	id := string(v.Id)
+	defer d.volumeLocks.lock(v.Id)()
+	if old, err := d.get(id); err == nil && (old.Mounted || len(old.SubPathMounts) > 0) {
+		if !v.Deleted.IsZero() {
+			return fmt.Errorf("Volume %v is mounted", v.Id)
+		}
+		v.Mounted = old.Mounted
+		v.Mountpath = old.Mountpath
+		v.MountOptions = old.MountOptions
+		v.SubPathMounts = old.SubPathMounts
+	}
+	if !v.Deleted.IsZero() {
+		if _, err := d.db.Put(d.trashKey(id), v, 0); err != nil {
+			return err
+		}
+		d.del(id)
+		return nil
+	}
+	if err := d.put(id, v); err != nil {
+		return err
+	}
+	d.db.Delete(d.trashKey(id))
+	return nil
+}
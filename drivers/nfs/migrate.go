@@ -0,0 +1,131 @@
+package nfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+// MigrateBacking copies the volume directory to newPath and points the
+// volume, and its mount if it is mounted, at the copy. newPath must not
+// exist and must be on the export outside the directories of other
+// volumes. A mounted volume is remounted read-only for the copy, which
+// fails if files on it are open for writing, so writers must be quiesced.
+func (d *nfsDriver) MigrateBacking(volumeID api.VolumeID, newPath string) error {
+	if err := d.CheckWritable(); err != nil {
+		return err
+	}
+	defer d.volumeLocks.lock(volumeID)()
+	id := string(volumeID)
+	v, err := d.getVerified(id)
+	if err != nil {
+		return err
+	}
+	if len(v.SubPathMounts) > 0 || d.roMounts.Count(volumeID) > 0 {
+		return fmt.Errorf("Cannot migrate %v while subpaths of it are mounted", volumeID)
+	}
+	if v.Mounted && d.cache != nil {
+		return fmt.Errorf("Cannot migrate %v while it is mounted through the cache", volumeID)
+	}
+	newPath = path.Clean(newPath)
+	if err = d.checkExportDir(newPath); err != nil {
+		return err
+	}
+	if _, err = os.Stat(newPath); err == nil {
+		return fmt.Errorf("Cannot migrate %v, %v already exists", volumeID, newPath)
+	}
+	if err = os.MkdirAll(newPath, 0744); err != nil {
+		return err
+	}
+	if err = d.checkNoLinks(newPath); err != nil {
+		os.Remove(newPath)
+		return err
+	}
+
+	// Freeze the mount so that nothing is written to the old directory
+	// after it is copied.
+	if v.Mounted {
+		err = syscall.Mount("", v.Mountpath, "",
+			syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY, "")
+		if err == syscall.EBUSY {
+			err = errors.New("files are open for writing")
+		}
+		if err != nil {
+			os.RemoveAll(newPath)
+			return fmt.Errorf("Cannot freeze %v at %v for migration: %v",
+				volumeID, v.Mountpath, err)
+		}
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("cp", "-a", v.Device+"/.", newPath)
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		d.thaw(v)
+		os.RemoveAll(newPath)
+		return fmt.Errorf("Failed to copy %v to %v: %v: %s", v.Device, newPath, err, stderr.String())
+	}
+
+	// Unmounting always removes the topmost mount, so the old mount is
+	// detached before the copy is mounted in its place rather than after.
+	// Files already open keep working, read-only, against the old
+	// directory.
+	if v.Mounted {
+		if err = d.switchMount(v, newPath); err != nil {
+			os.RemoveAll(newPath)
+			return fmt.Errorf("Failed to switch %v to %v: %v", v.Mountpath, newPath, err)
+		}
+	}
+
+	old := v.Device
+	v.Device = newPath
+	if err = d.put(id, v); err != nil {
+		v.Device = old
+		if v.Mounted {
+			d.switchMount(v, old)
+		}
+		os.RemoveAll(newPath)
+		return err
+	}
+	if v.Mounted {
+		log.Warnf("Volume %v moved to %v, remove %v once it is no longer in use",
+			volumeID, newPath, old)
+	} else if !v.Imported {
+		os.RemoveAll(old)
+	}
+	return nil
+}
+
+// thaw remounts the frozen mount of v with the options it was mounted with.
+func (d *nfsDriver) thaw(v *nfsVolume) {
+	flags, _ := volume.MountFlags(syscall.MS_BIND, "", v.MountOptions)
+	if err := syscall.Mount("", v.Mountpath, "", flags|syscall.MS_REMOUNT, ""); err != nil {
+		log.Warnf("Cannot thaw %v at %v: %v", v.Id, v.Mountpath, err)
+	}
+}
+
+// switchMount replaces the mount of v at its mount path with a mount of
+// dir, with the options v was mounted with. If dir cannot be mounted the
+// directory of v is mounted back, thawed.
+func (d *nfsDriver) switchMount(v *nfsVolume, dir string) error {
+	if err := syscall.Unmount(v.Mountpath, syscall.MNT_DETACH); err != nil {
+		d.thaw(v)
+		return err
+	}
+	err := volume.MountWithOptions(dir, v.Mountpath, "", syscall.MS_BIND, "", v.MountOptions)
+	if err != nil {
+		if rerr := volume.MountWithOptions(v.Device, v.Mountpath, "",
+			syscall.MS_BIND, "", v.MountOptions); rerr != nil {
+			log.Warnf("Cannot mount %v back at %v: %v", v.Device, v.Mountpath, rerr)
+		}
+	}
+	return err
+}
@@ -3,10 +3,17 @@ package nfs
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 
@@ -16,9 +23,21 @@ import (
 )
 
 const (
-	Name         = "nfs"
-	NfsDBKey     = "OpenStorageNFSKey"
+	Name             = "nfs"
+	NfsDBKey         = "OpenStorageNFSKey"
+	NfsInstanceDBKey = "OpenStorageNFSInstance"
+	MountPathParam   = "mountpath"
+	// LayoutParam selects how new volume directories are named on the export.
+	LayoutParam = "layout"
+	// LayoutUUID names volume directories by volume ID.
+	LayoutUUID = "uuid"
+	// LayoutNamed names volume directories by locator name.
+	LayoutNamed = "named"
+	// SyncParam mounts the export with the sync option when "true", and
+	// flushes volumes to the server before they are unmounted.
+	SyncParam    = "sync"
 	nfsMountPath = "/var/lib/openstorage/nfs/"
+	nfsMountBase = "/var/lib/openstorage/"
 )
 
 var (
@@ -35,15 +54,65 @@ type nfsVolume struct {
 	Mounted   bool
 	Device    string
 	Mountpath string
+	// Imported volumes wrap pre-existing data that is kept on Delete.
+	Imported bool
+	// Layout used for Device, empty for volumes created before layouts.
+	Layout string
+	// Deleted time the volume was moved to the trash.
+	Deleted time.Time
+	// Sync true if the volume was created with synchronous writes.
+	Sync bool
+	// Version of the NFS protocol the volume was last mounted over.
+	Version string `json:",omitempty"`
+	// MountOptions the volume is mounted with at Mountpath.
+	MountOptions *api.MountOptions `json:",omitempty"`
+	// SubPathMounts see api.Volume.SubPathMounts.
+	SubPathMounts []string `json:",omitempty"`
+	// Tags see api.Volume.Tags.
+	Tags api.Labels `json:",omitempty"`
 }
 
 // Implements the open storage volume interface.
 type nfsDriver struct {
 	*volume.DefaultBlockDriver
 	*volume.DefaultEnumerator
+	volume.ReadOnlyMode
 	db        kvdb.Kvdb
+	name      string
+	dbKey     string
+	mountPath string
 	nfsServer string
 	nfsPath   string
+	layout    string
+	// cache of the volumes mounted through an overlay, nil if disabled.
+	cache *volumeCache
+	// sync true if the export is mounted with synchronous writes.
+	sync bool
+	// vers NFS version requested with VersionParam, negotiated the version
+	// the export was mounted with at mounted.
+	vers       string
+	negotiated string
+	mounted    time.Time
+	// exports of the server when it was checked at Init, nil if unknown.
+	exports []nfsExport
+	warm    warmer
+	// retention of deleted volumes, soft delete is off if 0.
+	retention time.Duration
+	stop      chan struct{}
+	// stopOnce closes stop on the first Shutdown.
+	stopOnce sync.Once
+	limits   volumeLimits
+	// configLock protects layout and limits, which Reconfigure can change.
+	configLock sync.Mutex
+	// createLock serializes Create while limits and existing volumes are
+	// checked.
+	createLock sync.Mutex
+	// roMounts are mounts made in read-only mode, which are not recorded.
+	roMounts volume.SubPathMounts
+	// volumeLocks serializes the operations on a volume that mount it or
+	// move its directory.
+	volumeLocks volumeLocks
+	ops         *volume.OpCounter
 }
 
 func Init(params volume.DriverParams) (volume.VolumeDriver, error) {
@@ -57,39 +126,193 @@ func Init(params volume.DriverParams) (volume.VolumeDriver, error) {
 		return nil, errors.New("No NFS path provided")
 	}
 
-	log.Printf("NFS driver initializing with %s:%s ", server, path)
+	// Each instance keeps its records and mount point separate so that
+	// several NFS servers can be served at the same time.
+	name := params[volume.InstanceParam]
+	if name == "" {
+		name = Name
+	}
+	dbKey := NfsDBKey
+	mountPath := nfsMountPath
+	if name != Name {
+		dbKey = NfsInstanceDBKey + "/" + name
+		mountPath = nfsMountBase + name + "/"
+	}
+	if mp, ok := params[MountPathParam]; ok {
+		mountPath = strings.TrimSuffix(mp, "/") + "/"
+	}
+
+	layout, err := parseLayout(params[LayoutParam])
+	if err != nil {
+		return nil, err
+	}
+	limits, err := parseLimits(volumeLimits{}, params)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := parseCache(params)
+	if err != nil {
+		return nil, err
+	}
+
+	sync := false
+	if v, ok := params[SyncParam]; ok {
+		if sync, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("Invalid %s %q: %v", SyncParam, v, err)
+		}
+	}
+
+	// Records of a namespace, such as a cluster ID, are kept apart from
+	// those of other clusters sharing the kvdb.
+	if ns := params[volume.NamespaceParam]; ns != "" {
+		migrate := false
+		if v, ok := params[volume.MigrateNamespaceParam]; ok {
+			if migrate, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("Invalid %s %q: %v", volume.MigrateNamespaceParam, v, err)
+			}
+		}
+		old := dbKey
+		dbKey = ns + "/" + dbKey
+		if migrate {
+			n, err := migrateRecords(kvdb.Instance(), old, dbKey)
+			if err != nil {
+				return nil, err
+			}
+			log.Infof("Moved %d NFS records to namespace %q", n, ns)
+		}
+	}
+
+	warmRate, err := parseWarmRate(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var retention time.Duration
+	if v, ok := params[volume.TrashRetentionParam]; ok {
+		if retention, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("Invalid %s %q: %v", volume.TrashRetentionParam, v, err)
+		}
+	}
+
+	log.Printf("NFS driver %s initializing with %s:%s ", name, server, path)
 
 	inst := &nfsDriver{
 		db:        kvdb.Instance(),
+		name:      name,
+		dbKey:     dbKey,
+		mountPath: mountPath,
 		nfsServer: server,
-		nfsPath:   path}
+		nfsPath:   path,
+		layout:    layout,
+		limits:    limits,
+		cache:     cache,
+		sync:      sync,
+		vers:      params[VersionParam],
+		retention: retention,
+		stop:      make(chan struct{}),
+		ops:       volume.NewOpCounter()}
 
-	err := os.MkdirAll(nfsMountPath, 0744)
+	inst.warm.rate = warmRate
+	if err = inst.validateExport(); err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(inst.mountPath, 0744)
 	if err != nil {
 		return nil, err
 	}
 
 	// Mount the nfs server locally on a unique path.
-	syscall.Unmount(nfsMountPath, 0)
-	err = syscall.Mount(":"+inst.nfsPath, nfsMountPath, "nfs", 0, "nolock,addr="+inst.nfsServer)
+	opts := "nolock,addr=" + inst.nfsServer
+	if inst.sync {
+		opts += ",sync"
+	}
+	if inst.vers != "" {
+		opts += ",vers=" + inst.vers
+	}
+	syscall.Unmount(inst.mountPath, 0)
+	err = syscall.Mount(":"+inst.nfsPath, inst.mountPath, "nfs", 0, opts)
 	if err != nil {
-		log.Printf("Unable to mount %s at %s.\n", inst.nfsServer, nfsMountPath)
+		log.Printf("Unable to mount %s at %s.\n", inst.nfsServer, inst.mountPath)
 		return nil, err
 	}
+	inst.setVersion()
+
+	if inst.retention > 0 {
+		go inst.reaper()
+	}
 
-	log.Println("NFS initialized and driver mounted at: ", nfsMountPath)
+	log.Println("NFS initialized and driver mounted at: ", inst.mountPath)
 	return inst, nil
 }
 
+func (v *nfsVolume) volume() api.Volume {
+	spec := v.Spec
+	return api.Volume{
+		ID:            v.Id,
+		Locator:       v.Locator,
+		Spec:          &spec,
+		Format:        api.FsNfs,
+		DevicePath:    v.Device,
+		AttachPath:    v.Mountpath,
+		SubPathMounts: v.SubPathMounts,
+		Tags:          v.Tags,
+	}
+}
+
 func (d *nfsDriver) get(volumeID string) (*nfsVolume, error) {
 	v := &nfsVolume{}
-	key := NfsDBKey + "/" + volumeID
+	key := d.dbKey + "/" + volumeID
 	_, err := d.db.GetVal(key, v)
 	return v, err
 }
 
+// getVerified reads the volume record and reconciles it with the export.
+// A stale mount is cleared, a missing directory returns ErrVolBackingGone.
+func (d *nfsDriver) getVerified(volumeID string) (*nfsVolume, error) {
+	v, err := d.get(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	if v.Mounted {
+		if mounted, err := volume.IsMountPoint(v.Mountpath); err == nil && !mounted {
+			v.Mounted = false
+			v.Mountpath = ""
+			changed = true
+		}
+	}
+	if mounted := volume.MountedPaths(v.SubPathMounts); len(mounted) != len(v.SubPathMounts) {
+		v.SubPathMounts = mounted
+		changed = true
+	}
+	if changed && !d.ReadOnly() {
+		if err = d.put(volumeID, v); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = os.Stat(v.Device); os.IsNotExist(err) {
+		return v, volume.ErrVolBackingGone
+	}
+	return v, nil
+}
+
+// syncfs flushes the filesystem that p is on.
+func syncfs(p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, _, errno := syscall.Syscall(sysSyncfs, f.Fd(), 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
 func (d *nfsDriver) enumerate() ([]*nfsVolume, error) {
-	key := NfsDBKey
+	key := d.dbKey + "/"
 	kvps, err := d.db.Enumerate(key)
 	if err != nil {
 		return nil, err
@@ -111,35 +334,139 @@ func (d *nfsDriver) enumerate() ([]*nfsVolume, error) {
 }
 
 func (d *nfsDriver) put(volumeID string, v *nfsVolume) error {
-	key := NfsDBKey + "/" + volumeID
+	key := d.dbKey + "/" + volumeID
 	_, err := d.db.Put(key, v, 0)
 	return err
 }
 
 func (d *nfsDriver) del(volumeID string) {
-	key := NfsDBKey + "/" + volumeID
+	key := d.dbKey + "/" + volumeID
 	d.db.Delete(key)
 }
 
+// migrateRecords moves the volume and trash records kept under the dbKey from
+// to the dbKey to.
+func migrateRecords(kv kvdb.Kvdb, from, to string) (int, error) {
+	moved := 0
+	for _, suffix := range []string{"/", ".trash/"} {
+		kvps, err := kv.Enumerate(from + suffix)
+		if err != nil {
+			return moved, err
+		}
+		for _, kvp := range kvps {
+			key := strings.TrimPrefix(kvp.Key, "/")
+			newKey := to + strings.TrimPrefix(key, from)
+			if _, err = kv.Create(newKey, json.RawMessage(kvp.Value), 0); err != nil {
+				return moved, fmt.Errorf("Failed to move %v to %v: %v", key, newKey, err)
+			}
+			if _, err = kv.Delete(key); err != nil {
+				return moved, err
+			}
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// ReserveName reserves key in the instance's own keyspace, the embedded
+// DefaultEnumerator is not used by this driver.
+func (d *nfsDriver) ReserveName(key string) error {
+	_, err := d.db.Create(d.dbKey+".names/"+url.QueryEscape(key), "", 0)
+	return err
+}
+
+// ReleaseName drops a reservation made with ReserveName.
+func (d *nfsDriver) ReleaseName(key string) {
+	d.db.Delete(d.dbKey + ".names/" + url.QueryEscape(key))
+}
+
 func (d *nfsDriver) String() string {
-	return Name
+	return d.name
+}
+
+// SupportedFilesystems volumes are directories on the NFS export.
+func (d *nfsDriver) SupportedFilesystems() []api.Filesystem {
+	return []api.Filesystem{api.FsNfs}
+}
+
+// Version of the volume record and export layout.
+func (d *nfsDriver) Version() api.DriverVersion {
+	return api.DriverVersion{Driver: Name, Version: "1.0.0"}
 }
 
 // Status diagnostic information
 func (d *nfsDriver) Status() [][2]string {
-	return [][2]string{}
+	status := [][2]string{
+		d.ModeStatus(),
+		volume.VersionStatus(d.Version()),
+		d.cacheStatus(),
+		{"Sync", strconv.FormatBool(d.sync)},
+		{"Version", d.negotiated},
+		d.exportsStatus(),
+	}
+	status = append(status, d.limitsStatus()...)
+	return append(status, d.warmStatus()...)
 }
 
-func (d *nfsDriver) Create(locator api.VolumeLocator, opt *api.CreateOptions, spec *api.VolumeSpec) (api.VolumeID, error) {
+func (d *nfsDriver) Create(locator api.VolumeLocator, opt *api.CreateOptions, spec *api.VolumeSpec) (id api.VolumeID, err error) {
+	defer func() { d.ops.Record(volume.OpCreate, err) }()
+	if err = d.CheckWritable(); err != nil {
+		return "", err
+	}
+
 	// Validate options.
-	if spec.Format != "nfs" {
-		return "", errors.New("Unsupported filesystem format: " + string(spec.Format))
+	if err = volume.ValidateFormat(d, spec.Format); err != nil {
+		return "", err
+	}
+	if err = volume.CheckNoIOLimits(spec); err != nil {
+		return "", err
+	}
+	if err = volume.ValidateTags(spec.Tags); err != nil {
+		return "", err
 	}
 
 	if spec.BlockSize != 0 {
 		log.Println("NFS driver will ignore the blocksize option.")
 	}
 
+	return d.create(locator, opt, spec, "")
+}
+
+// create registers a volume in a new directory or, if dir is set, in the
+// existing directory dir. Existing volumes and the limits are checked under
+// createLock.
+func (d *nfsDriver) create(
+	locator api.VolumeLocator,
+	opt *api.CreateOptions,
+	spec *api.VolumeSpec,
+	dir string) (api.VolumeID, error) {
+
+	d.createLock.Lock()
+	defer d.createLock.Unlock()
+	if dir != "" {
+		if err := d.checkImport(dir); err != nil {
+			return "", err
+		}
+	}
+	if opt != nil && opt.Idempotent {
+		if id, ok, err := volume.VolumeExists(d, locator); err != nil || ok {
+			return id, err
+		}
+	}
+
+	if volume.IsNameTemplate(locator.Name) {
+		name, release, err := volume.UniqueName(d, locator.Name, time.Now())
+		if err != nil {
+			return "", err
+		}
+		defer release()
+		locator.Name = name
+	}
+
+	if err := d.checkLimits(locator); err != nil {
+		return "", err
+	}
+
 	out, err := exec.Command("uuidgen").Output()
 	if err != nil {
 		log.Println(err)
@@ -148,8 +475,30 @@ func (d *nfsDriver) Create(locator api.VolumeLocator, opt *api.CreateOptions, sp
 	volumeID := string(out)
 	volumeID = strings.TrimSuffix(volumeID, "\n")
 
-	// Create a directory on the NFS server with this UUID.
-	err = os.MkdirAll(nfsMountPath+volumeID, 0744)
+	if dir != "" {
+		err = d.put(volumeID,
+			&nfsVolume{Id: api.VolumeID(volumeID),
+				Device:   dir,
+				Imported: true,
+				Tags:     spec.Tags,
+				Spec:     *spec, Locator: locator})
+		return api.VolumeID(volumeID), err
+	}
+
+	// Create a directory on the NFS server named after the UUID or, in the
+	// named layout, after the volume name.
+	d.configLock.Lock()
+	layout := d.layout
+	d.configLock.Unlock()
+	device := d.mountPath + volumeID
+	if layout == LayoutNamed {
+		if device, err = d.namedDevice(locator.Name); err != nil {
+			return "", err
+		}
+		err = os.Mkdir(device, 0744)
+	} else {
+		err = os.MkdirAll(device, 0744)
+	}
 	if err != nil {
 		log.Println(err)
 		return "", err
@@ -159,55 +508,355 @@ func (d *nfsDriver) Create(locator api.VolumeLocator, opt *api.CreateOptions, sp
 	// this volume ID.
 	err = d.put(volumeID,
 		&nfsVolume{Id: api.VolumeID(volumeID),
-			Device: nfsMountPath + volumeID,
+			Device: device,
+			Layout: layout,
+			Sync:   d.sync,
+			Tags:   spec.Tags,
 			Spec:   *spec, Locator: locator})
 
 	return api.VolumeID(volumeID), err
 }
 
-func (d *nfsDriver) Delete(volumeID api.VolumeID) error {
+func parseLayout(layout string) (string, error) {
+	switch layout {
+	case "":
+		return LayoutUUID, nil
+	case LayoutUUID, LayoutNamed:
+		return layout, nil
+	}
+	return "", fmt.Errorf("Unknown NFS layout %q", layout)
+}
+
+// Reconfigure changes the layout of volumes created from now on and the
+// volume limits. The server, path and mount path are fixed once the export
+// is mounted.
+func (d *nfsDriver) Reconfigure(params volume.DriverParams) error {
+	layout := ""
+	d.configLock.Lock()
+	limits, err := parseLimits(d.limits, params)
+	d.configLock.Unlock()
+	if err != nil {
+		return err
+	}
+	for k, v := range params {
+		switch k {
+		case MaxVolumesParam, MaxTenantVolumesParam, TenantLabelParam:
+		case LayoutParam:
+			l, err := parseLayout(v)
+			if err != nil {
+				return err
+			}
+			layout = l
+		case "server", "path", MountPathParam, VersionParam, volume.InstanceParam:
+			return fmt.Errorf("NFS parameter %q cannot be changed without a restart", k)
+		default:
+			return fmt.Errorf("Unknown NFS parameter %q", k)
+		}
+	}
+	d.configLock.Lock()
+	defer d.configLock.Unlock()
+	if layout != "" {
+		d.layout = layout
+	}
+	d.limits = limits
+	return nil
+}
+
+// namedDevice returns the directory for a volume called name in the named
+// layout. Names must be unique on the export.
+func (d *nfsDriver) namedDevice(name string) (string, error) {
+	if err := volume.ValidateName(name); err != nil {
+		return "", err
+	}
+	device := d.mountPath + name
+	vols, err := d.enumerate()
+	if err != nil {
+		return "", err
+	}
+	for _, v := range vols {
+		if v.Locator.Name == name || v.Device == device {
+			return "", fmt.Errorf("Volume named %v already exists", name)
+		}
+	}
+	if _, err := os.Stat(device); err == nil {
+		return "", fmt.Errorf("%v already exists on the export", device)
+	}
+	return device, nil
+}
+
+// Rename changes the name of a volume. In the named layout the volume's
+// directory is renamed too, which fails with ErrVolumeBusy while the volume
+// is mounted.
+func (d *nfsDriver) Rename(volumeID api.VolumeID, newName string) error {
+	if err := d.CheckWritable(); err != nil {
+		return err
+	}
+	d.createLock.Lock()
+	defer d.createLock.Unlock()
+	defer d.volumeLocks.lock(volumeID)()
+	v, err := d.get(string(volumeID))
+	if err != nil {
+		return volume.ErrEnoEnt
+	}
+	if v.Locator.Name == newName {
+		return nil
+	}
+	if err = volume.ValidateName(newName); err != nil {
+		return err
+	}
+	vols, err := d.enumerate()
+	if err != nil {
+		return err
+	}
+	for _, other := range vols {
+		if other.Id != v.Id && other.Locator.Name == newName {
+			return fmt.Errorf("Volume named %v already exists", newName)
+		}
+	}
+
+	oldDevice := v.Device
+	if v.Layout == LayoutNamed && !v.Imported {
+		if v.Mounted || len(v.SubPathMounts) > 0 {
+			return volume.ErrVolumeBusy
+		}
+		if v.Device, err = d.namedDevice(newName); err != nil {
+			return err
+		}
+		if err = os.Rename(oldDevice, v.Device); err != nil {
+			return err
+		}
+	}
+	v.Locator.Name = newName
+	if err = d.put(string(volumeID), v); err != nil {
+		if v.Device != oldDevice {
+			os.Rename(v.Device, oldDevice)
+		}
+		return err
+	}
+	return nil
+}
+
+// UpdateTags replaces the tags of the volume.
+func (d *nfsDriver) UpdateTags(volumeID api.VolumeID, tags api.Labels) error {
+	if err := d.CheckWritable(); err != nil {
+		return err
+	}
+	if err := volume.ValidateTags(tags); err != nil {
+		return err
+	}
+	defer d.volumeLocks.lock(volumeID)()
 	v, err := d.get(string(volumeID))
 	if err != nil {
+		return volume.ErrEnoEnt
+	}
+	v.Tags = tags
+	return d.put(string(volumeID), v)
+}
+
+// Import registers an existing directory on the NFS export as a volume
+// without touching its contents. It is subject to the same limits as
+// Create.
+func (d *nfsDriver) Import(dir string, locator api.VolumeLocator, spec *api.VolumeSpec) (api.VolumeID, error) {
+	if err := d.CheckWritable(); err != nil {
+		return "", err
+	}
+	if err := volume.ValidateFormat(d, spec.Format); err != nil {
+		return "", err
+	}
+	if err := volume.CheckNoIOLimits(spec); err != nil {
+		return "", err
+	}
+	if err := volume.ValidateTags(spec.Tags); err != nil {
+		return "", err
+	}
+	return d.create(locator, nil, spec, path.Clean(dir))
+}
+
+// checkImport checks that the clean path dir can be imported. The caller
+// must hold createLock.
+func (d *nfsDriver) checkImport(dir string) error {
+	if err := d.checkExportDir(dir); err != nil {
+		return err
+	}
+	if err := d.checkNoLinks(dir); err != nil {
+		return err
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%v is not a directory", dir)
+	}
+	return nil
+}
+
+// checkExportDir checks that the clean path dir is on the export and
+// outside the trash and the directories of all volumes.
+func (d *nfsDriver) checkExportDir(dir string) error {
+	if !strings.HasPrefix(dir, d.mountPath) || dir+"/" == d.mountPath {
+		return fmt.Errorf("%v is not a directory under %v", dir, d.mountPath)
+	}
+	if trash := path.Clean(d.mountPath + trashDir); overlaps(dir, trash) {
+		return fmt.Errorf("%v overlaps the trash directory %v", dir, trash)
+	}
+	vols, err := d.enumerate()
+	if err != nil {
+		return err
+	}
+	trashed, err := d.enumerateTrash()
+	if err != nil {
+		return err
+	}
+	for _, v := range append(vols, trashed...) {
+		if overlaps(dir, v.Device) {
+			return fmt.Errorf("%v overlaps %v of volume %v", dir, v.Device, v.Id)
+		}
+	}
+	return nil
+}
+
+// checkNoLinks checks that the existing directory dir on the export is not
+// reached through symbolic links, which could lead into the trash or into
+// other volumes.
+func (d *nfsDriver) checkNoLinks(dir string) error {
+	root, err := filepath.EvalSymlinks(d.mountPath)
+	if err != nil {
+		return nil
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if real != path.Join(root, dir[len(d.mountPath):]) {
+		return fmt.Errorf("%v is a symbolic link to %v", dir, real)
+	}
+	return nil
+}
+
+// overlaps returns true if one of the clean paths a and b is within the
+// other.
+func overlaps(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
+
+func (d *nfsDriver) Delete(volumeID api.VolumeID) (err error) {
+	defer func() { d.ops.Record(volume.OpDelete, err) }()
+	if err = d.CheckWritable(); err != nil {
+		return err
+	}
+	defer d.volumeLocks.lock(volumeID)()
+	v, err := d.getVerified(string(volumeID))
+	if err != nil && err != volume.ErrVolBackingGone {
 		log.Println(err)
 		return err
 	}
+	if v.Mounted || len(v.SubPathMounts) > 0 || d.roMounts.Count(volumeID) > 0 {
+		return volume.ErrVolumeBusy
+	}
+	d.clearWarm(volumeID)
+	if d.cache != nil {
+		d.cache.remove(volumeID)
+	}
+
+	if d.retention > 0 {
+		return d.trash(v)
+	}
 
 	d.del(string(volumeID))
 
 	// Delete the directory on the nfs server.
-	os.Remove(v.Device)
+	if !v.Imported {
+		os.Remove(v.Device)
+	}
 
 	return nil
 }
 
-func (d *nfsDriver) Mount(volumeID api.VolumeID, mountpath string) error {
-	v, err := d.get(string(volumeID))
+func (d *nfsDriver) Mount(volumeID api.VolumeID, mountpath string, opts *api.MountOptions) (err error) {
+	defer func() { d.ops.Record(volume.OpMount, err) }()
+	if err = d.CheckMount(opts); err != nil {
+		return err
+	}
+	defer d.volumeLocks.lock(volumeID)()
+	v, err := d.getVerified(string(volumeID))
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	source, err := volume.ResolveSubPath(v.Device, opts)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
 
 	syscall.Unmount(mountpath, 0)
-	err = syscall.Mount(v.Device, mountpath, string(v.Spec.Format), syscall.MS_BIND, "")
+	// Only the volume's own mount goes through the cache, and not in
+	// read-only mode, in which it is not recorded and thus not flushed.
+	if d.cache != nil && (opts == nil || opts.SubPath == "") && !d.ReadOnly() {
+		err = d.cache.mount(volumeID, v.Device, mountpath, opts)
+	} else {
+		err = volume.MountWithOptions(source, mountpath, string(v.Spec.Format), syscall.MS_BIND, "", opts)
+	}
 	if err != nil {
-		log.Printf("Cannot mount %s at %s because %+v", v.Device, mountpath, err)
+		log.Printf("Cannot mount %s at %s because %+v", source, mountpath, err)
 		return err
 	}
 
+	// Mounts in read-only mode are tracked apart from the record, which
+	// cannot be updated.
+	if d.ReadOnly() {
+		d.roMounts.Add(volumeID, mountpath)
+		return nil
+	}
+	if opts != nil && opts.SubPath != "" {
+		v.SubPathMounts = volume.AddMountPath(v.SubPathMounts, mountpath)
+		return d.put(string(volumeID), v)
+	}
+
 	v.Mountpath = mountpath
 	v.Mounted = true
-	err = d.put(string(volumeID), v)
+	v.MountOptions = opts
+	v.Version = d.negotiated
+	if err = d.put(string(volumeID), v); err != nil {
+		return err
+	}
+	d.startWarm(v, v.Device)
 
 	return err
 }
 
-func (d *nfsDriver) Unmount(volumeID api.VolumeID, mountpath string) error {
+func (d *nfsDriver) Unmount(volumeID api.VolumeID, mountpath string) (err error) {
+	defer func() { d.ops.Record(volume.OpUnmount, err) }()
+	defer d.volumeLocks.lock(volumeID)()
+	if mountpath != "" && d.roMounts.Has(volumeID, mountpath) {
+		if err = syscall.Unmount(mountpath, 0); err != nil {
+			log.Println(err)
+			return err
+		}
+		d.roMounts.Remove(volumeID, mountpath)
+		return nil
+	}
+	if err = d.CheckWritable(); err != nil {
+		return err
+	}
+
 	v, err := d.get(string(volumeID))
 	if err != nil {
 		log.Println(err)
 		return err
 	}
 
+	if mounts, ok := volume.RemoveMountPath(v.SubPathMounts, mountpath); ok {
+		if err = syscall.Unmount(mountpath, 0); err != nil {
+			log.Println(err)
+			return err
+		}
+		v.SubPathMounts = mounts
+		return d.put(string(volumeID), v)
+	}
+
 	if v.Mountpath == "" {
 		err = errors.New("This volume is not mounted.")
 		log.Println(err)
@@ -220,16 +869,64 @@ func (d *nfsDriver) Unmount(volumeID api.VolumeID, mountpath string) error {
 		return err
 	}
 
+	d.stopWarm(volumeID)
+	if v.Sync || d.sync {
+		if err = syncfs(v.Mountpath); err != nil {
+			log.Printf("Cannot flush %s before unmount: %v", v.Mountpath, err)
+			return err
+		}
+	}
+
 	err = syscall.Unmount(v.Mountpath, 0)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
 
+	var ferr error
+	if d.cache != nil {
+		if ferr = d.cache.unmounted(volumeID, v.Device); ferr != nil {
+			log.Printf("Cannot flush the cache of %s: %v", volumeID, ferr)
+		}
+	}
+
 	v.Mountpath = ""
 	v.Mounted = false
-	err = d.put(string(volumeID), v)
+	v.MountOptions = nil
+	if err = d.put(string(volumeID), v); err != nil {
+		return err
+	}
+
+	return ferr
+}
 
+// ForceRelease detaches all mounts of the volume and clears its mount
+// state, for mounts that hang on an unresponsive server.
+func (d *nfsDriver) ForceRelease(volumeID api.VolumeID) error {
+	if err := d.CheckWritable(); err != nil {
+		return err
+	}
+	defer d.volumeLocks.lock(volumeID)()
+	v, err := d.get(string(volumeID))
+	if err != nil {
+		return err
+	}
+	d.stopWarm(volumeID)
+	paths := append(d.roMounts.Clear(volumeID), v.SubPathMounts...)
+	err = volume.ForceUnmount(volumeID, append(paths, v.Mountpath)...)
+	if d.cache != nil {
+		d.cache.released(volumeID)
+	}
+	if v.Mounted || len(v.SubPathMounts) > 0 {
+		v.Mountpath = ""
+		v.Mounted = false
+		v.MountOptions = nil
+		v.SubPathMounts = nil
+		if perr := d.put(string(volumeID), v); err == nil {
+			err = perr
+		}
+	}
+	log.Printf("Force released volume %v", volumeID)
 	return err
 }
 
@@ -245,14 +942,28 @@ func (d *nfsDriver) Inspect(volumeIDs []api.VolumeID) ([]api.Volume, error) {
 		if err != nil {
 			return nil, err
 		}
-		volumes[i] = api.Volume{
-			ID:   id,
-			Spec: &v.Spec}
+		volumes[i] = v.volume()
 	}
 
 	return volumes, nil
 }
 
+// Enumerate volumes of this driver instance that match the locator.
+func (d *nfsDriver) Enumerate(locator api.VolumeLocator, labels api.Labels) ([]api.Volume, error) {
+	vs, err := d.enumerate()
+	if err != nil {
+		return nil, err
+	}
+	volumes := make([]api.Volume, 0, len(vs))
+	for _, v := range vs {
+		vol := v.volume()
+		if volume.Match(&vol, locator, labels) {
+			volumes = append(volumes, vol)
+		}
+	}
+	return volumes, nil
+}
+
 func (d *nfsDriver) Snapshot(volumeID api.VolumeID, labels api.Labels) (api.SnapID, error) {
 	return "", volume.ErrNotSupported
 }
@@ -265,21 +976,47 @@ func (d *nfsDriver) SnapInspect(snapID []api.SnapID) ([]api.VolumeSnap, error) {
 	return []api.VolumeSnap{}, volume.ErrNotSupported
 }
 
+// Stats the export does not report compression or deduplication, usage
+// fields are left at zero.
 func (d *nfsDriver) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
-	return api.VolumeStats{}, volume.ErrNotSupported
+	if _, err := d.get(string(volumeID)); err != nil {
+		return api.VolumeStats{}, volume.ErrEnoEnt
+	}
+	return api.VolumeStats{}, nil
 }
 
+// Alerts raises a version mismatch alert if the export was not mounted with
+// the requested NFS version.
 func (d *nfsDriver) Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error) {
-	return api.VolumeAlerts{}, volume.ErrNotSupported
+	if _, err := d.get(string(volumeID)); err != nil {
+		return api.VolumeAlerts{}, volume.ErrEnoEnt
+	}
+	return api.VolumeAlerts{Alerts: d.versionAlerts(volumeID)}, nil
 }
 
 func (d *nfsDriver) SnapEnumerate(volIds []api.VolumeID, labels api.Labels) ([]api.VolumeSnap, error) {
 	return nil, volume.ErrNotSupported
 }
 
+// Metrics operation counts and provisioned capacity.
+func (d *nfsDriver) Metrics() []api.Metric {
+	m := d.ops.Metrics()
+	vols, err := d.enumerate()
+	if err != nil {
+		return m
+	}
+	var capacity uint64
+	for _, v := range vols {
+		capacity += v.Spec.Size
+	}
+	return append(m, volume.CapacityMetrics(0, capacity)...)
+}
+
 func (d *nfsDriver) Shutdown() {
-	log.Printf("%s Shutting down", Name)
-	syscall.Unmount(nfsMountPath, 0)
+	log.Printf("%s Shutting down", d.name)
+	d.stopOnce.Do(func() { close(d.stop) })
+	d.stopAllWarm()
+	syscall.Unmount(d.mountPath, 0)
 }
 
 func init() {
@@ -1,8 +1,20 @@
 package nfs
 
 import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/libopenstorage/kvdb"
+	"github.com/libopenstorage/kvdb/mem"
+	"github.com/libopenstorage/openstorage/api"
 	"github.com/libopenstorage/openstorage/drivers/test"
 	"github.com/libopenstorage/openstorage/volume"
 )
@@ -18,7 +30,517 @@ func TestAll(t *testing.T) {
 		t.Fatalf("Failed to initialize Volume Driver: %v", err)
 	}
 	ctx := test.NewContext(d)
-	ctx.Filesystem = "nfs"
+	ctx.Filesystem = api.FsNfs
 
 	test.RunShort(t, ctx)
 }
+
+func TestCheckExport(t *testing.T) {
+	exports := parseExports("/srv/nfs  10.0.0.0/24\n/data *\n")
+	if len(exports) != 2 || exports[1].path != "/data" || exports[1].clients != "*" {
+		t.Fatalf("Unexpected exports %+v", exports)
+	}
+	node := nfsClient{hostname: "node1.example.com", addrs: []net.IP{net.ParseIP("10.0.0.7")}}
+	if err := checkExport("srv", "/srv/nfs/", exports, node); err != nil {
+		t.Errorf("Export rejected: %v", err)
+	}
+	if err := checkExport("srv", "/data/vols", exports, node); err != nil {
+		t.Errorf("Directory within an export rejected: %v", err)
+	}
+	if err := checkExport("srv", "/srv", exports, node); err == nil {
+		t.Errorf("Path that is not exported accepted")
+	}
+	other := nfsClient{hostname: "node2", addrs: []net.IP{net.ParseIP("10.1.0.7")}}
+	if err := checkExport("srv", "/srv/nfs", exports, other); err == nil {
+		t.Errorf("Export to other clients accepted")
+	}
+
+	for clients, want := range map[string]bool{
+		"":                          true,
+		"(everyone)":                true,
+		"@storage":                  true,
+		"10.0.0.7":                  true,
+		"10.0.0.8,10.0.0.7":         true,
+		"10.0.0.8":                  false,
+		"10.0.0.0/255.255.255.0":    true,
+		"10.0.1.0/24":               false,
+		"*.example.com":             true,
+		"NODE1":                     true,
+		"node2.example.com,*.other": false,
+	} {
+		if got := node.allows(clients); got != want {
+			t.Errorf("Clients %q allow node %v, want %v", clients, got, want)
+		}
+	}
+}
+
+func TestWarm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"a", "b"} {
+		if err = ioutil.WriteFile(filepath.Join(dir, f), make([]byte, 4096), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := &nfsDriver{}
+	d.warm.rate = DefaultWarmRate
+	v := &nfsVolume{Id: "warm", Locator: api.VolumeLocator{
+		VolumeLabels: api.Labels{WarmLabel: "true"},
+	}}
+	d.startWarm(v, dir)
+	for i := 0; i < 100 && d.warmStatus()[0][1] != "2 files, 8192 bytes, done"; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s := d.warmStatus(); s[0][1] != "2 files, 8192 bytes, done" {
+		t.Errorf("Unexpected warm status %v", s)
+	}
+}
+
+// newTestDriver returns a driver backed by an in-memory kvdb whose export
+// is a temporary directory. The caller removes d.mountPath when done.
+func newTestDriver(t *testing.T) *nfsDriver {
+	dir, err := ioutil.TempDir("", "nfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv, err := kvdb.New(mem.Name, "nfs_test", []string{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &nfsDriver{
+		db:        kv,
+		name:      Name,
+		dbKey:     NfsDBKey,
+		mountPath: dir + "/",
+		stop:      make(chan struct{}),
+		ops:       volume.NewOpCounter(),
+	}
+}
+
+func TestImportOwnership(t *testing.T) {
+	d := newTestDriver(t)
+	defer os.RemoveAll(d.mountPath)
+	for _, dir := range []string{"data/sub", "other", "old", trashDir + "gone"} {
+		if err := os.MkdirAll(d.mountPath+dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	spec := &api.VolumeSpec{Format: api.FsNfs}
+
+	if _, err := d.Import(d.mountPath+"data", api.VolumeLocator{}, spec); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if _, err := d.Import(d.mountPath+"data/sub", api.VolumeLocator{}, spec); err == nil {
+		t.Errorf("Directory within a volume imported")
+	}
+	if _, err := d.Import(d.mountPath+"data/", api.VolumeLocator{}, spec); err == nil {
+		t.Errorf("Volume directory imported twice")
+	}
+	if _, err := d.Import(d.mountPath+trashDir+"gone", api.VolumeLocator{}, spec); err == nil {
+		t.Errorf("Trashed directory imported")
+	}
+
+	id, err := d.Import(d.mountPath+"old", api.VolumeLocator{}, spec)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	v, err := d.get(string(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.trash(v); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Import(d.mountPath+"old", api.VolumeLocator{}, spec); err == nil {
+		t.Errorf("Directory of a trashed imported volume imported")
+	}
+
+	if _, err := d.Import(d.mountPath+"other", api.VolumeLocator{}, spec); err != nil {
+		t.Errorf("Failed to import: %v", err)
+	}
+}
+
+func TestMigrateRecords(t *testing.T) {
+	d := newTestDriver(t)
+	defer os.RemoveAll(d.mountPath)
+	if err := d.put("live", &nfsVolume{Id: "live"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.db.Put(d.trashKey("gone"), &nfsVolume{Id: "gone"}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := migrateRecords(d.db, d.dbKey, "cluster1/"+d.dbKey)
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("Moved %d records, expected 2", n)
+	}
+	if _, err = d.get("live"); err == nil {
+		t.Errorf("Record left under the old key")
+	}
+	d.dbKey = "cluster1/" + d.dbKey
+	if _, err = d.get("live"); err != nil {
+		t.Errorf("Volume record not moved: %v", err)
+	}
+	if _, err = d.getTrashed("gone"); err != nil {
+		t.Errorf("Trash record not moved: %v", err)
+	}
+}
+
+func TestIdempotentCreate(t *testing.T) {
+	if _, err := exec.LookPath("uuidgen"); err != nil {
+		t.Skip("uuidgen not found")
+	}
+	d := newTestDriver(t)
+	defer os.RemoveAll(d.mountPath)
+	locator := api.VolumeLocator{Name: "retried"}
+	opt := &api.CreateOptions{Idempotent: true}
+
+	var wg sync.WaitGroup
+	ids := make([]api.VolumeID, 4)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if ids[i], err = d.Create(locator, opt, &api.VolumeSpec{Format: api.FsNfs}); err != nil {
+				t.Errorf("Failed to create: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, id := range ids[1:] {
+		if id != ids[0] {
+			t.Errorf("Concurrent idempotent creates returned %v and %v", ids[0], id)
+		}
+	}
+	vols, err := d.enumerate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vols) != 1 {
+		t.Errorf("Created %d volumes, expected 1", len(vols))
+	}
+}
+
+// failingPuts fails writes of the keys with prefix.
+type failingPuts struct {
+	kvdb.Kvdb
+	prefix string
+}
+
+func (f *failingPuts) Put(key string, value interface{}, ttl uint64) (*kvdb.KVPair, error) {
+	if strings.HasPrefix(key, f.prefix) {
+		return nil, errors.New("Put failed")
+	}
+	return f.Kvdb.Put(key, value, ttl)
+}
+
+func TestTrash(t *testing.T) {
+	d := newTestDriver(t)
+	defer os.RemoveAll(d.mountPath)
+	device := d.mountPath + "vol"
+	if err := os.Mkdir(device, 0755); err != nil {
+		t.Fatal(err)
+	}
+	v := &nfsVolume{Id: "vol", Device: device}
+	if err := d.put("vol", v); err != nil {
+		t.Fatal(err)
+	}
+
+	db := d.db
+	d.db = &failingPuts{db, d.trashKey("")}
+	if err := d.trash(v); err == nil {
+		t.Fatal("Trash should fail when its record cannot be written")
+	}
+	if _, err := os.Stat(device); err != nil {
+		t.Errorf("Directory not moved back after a failed trash: %v", err)
+	}
+	if _, err := d.get("vol"); err != nil {
+		t.Errorf("Volume record lost after a failed trash: %v", err)
+	}
+
+	d.db = db
+	if err := d.trash(v); err != nil {
+		t.Fatalf("Failed to trash: %v", err)
+	}
+	if err := os.Symlink(d.trashPath("vol"), d.mountPath+"link"); err != nil {
+		t.Fatal(err)
+	}
+	spec := &api.VolumeSpec{Format: api.FsNfs}
+	if _, err := d.Import(d.mountPath+"link", api.VolumeLocator{}, spec); err == nil {
+		t.Errorf("Trashed directory imported through a symbolic link")
+	}
+}
+
+func TestMigrateBacking(t *testing.T) {
+	d := newTestDriver(t)
+	defer os.RemoveAll(d.mountPath)
+	for _, id := range []string{"a", "b"} {
+		writeFile(t, d.mountPath+id+"/data", id)
+		if err := d.put(id, &nfsVolume{Id: api.VolumeID(id), Device: d.mountPath + id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outside, err := ioutil.TempDir("", "nfs_outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+
+	for _, p := range []string{
+		outside + "/a",
+		d.mountPath + "b/a",
+		d.mountPath + "a/new",
+		d.mountPath + trashDir + "a",
+		"a2",
+	} {
+		if err = d.MigrateBacking("a", p); err == nil {
+			t.Errorf("Migrated to %v", p)
+		}
+	}
+	if err = os.Symlink(d.mountPath+"b", d.mountPath+"link"); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.MigrateBacking("a", d.mountPath+"link/a"); err == nil {
+		t.Error("Migrated through a symbolic link into another volume")
+	}
+
+	if err = d.MigrateBacking("a", d.mountPath+"moved/a"); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	v, err := d.get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Device != d.mountPath+"moved/a" {
+		t.Errorf("Volume directory is %v after migration", v.Device)
+	}
+	if data, err := ioutil.ReadFile(v.Device + "/data"); err != nil || string(data) != "a" {
+		t.Errorf("Migrated data is %q, %v", data, err)
+	}
+	if _, err = os.Stat(d.mountPath + "a"); !os.IsNotExist(err) {
+		t.Errorf("Old directory kept: %v", err)
+	}
+}
+
+func TestImportLimits(t *testing.T) {
+	d := newTestDriver(t)
+	defer os.RemoveAll(d.mountPath)
+	d.limits = volumeLimits{max: 2, tenantLabel: DefaultTenantLabel}
+	for _, dir := range []string{"a", "b", "c"} {
+		if err := os.MkdirAll(d.mountPath+dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	spec := &api.VolumeSpec{Format: api.FsNfs}
+
+	id, err := d.Import(d.mountPath+"a", api.VolumeLocator{}, spec)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	v, err := d.get(string(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.trash(v); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Import(d.mountPath+"b", api.VolumeLocator{}, spec); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if _, err = d.Import(d.mountPath+"c", api.VolumeLocator{}, spec); err != volume.ErrQuotaExceeded {
+		t.Errorf("Import beyond the limit returned %v", err)
+	}
+}
+
+func TestSubPathMountRecords(t *testing.T) {
+	d := newTestDriver(t)
+	defer os.RemoveAll(d.mountPath)
+	mnt, err := ioutil.TempDir("", "nfs_mnt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mnt)
+	if err = os.MkdirAll(d.mountPath+"vol", 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The mount path is a plain directory, as after a reboot.
+	err = d.put("vol", &nfsVolume{
+		Id:            "vol",
+		Device:        d.mountPath + "vol",
+		SubPathMounts: []string{mnt},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := d.getVerified("vol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.SubPathMounts) != 0 {
+		t.Errorf("Stale subpath mounts kept: %v", v.SubPathMounts)
+	}
+
+	v.SubPathMounts = []string{mnt}
+	if err = d.put("vol", v); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.ForceRelease("vol"); err != nil {
+		t.Fatalf("Failed to force release: %v", err)
+	}
+	if v, err = d.get("vol"); err != nil || len(v.SubPathMounts) != 0 {
+		t.Errorf("Subpath mounts not cleared: %v %v", v.SubPathMounts, err)
+	}
+
+	d.roMounts.Add("vol", mnt)
+	if err = d.Delete("vol"); err != volume.ErrVolumeBusy {
+		t.Errorf("Delete of a mounted volume returned %v", err)
+	}
+	d.roMounts.Clear("vol")
+	if err = d.Delete("vol"); err != nil {
+		t.Errorf("Failed to delete: %v", err)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	d := newTestDriver(t)
+	defer os.RemoveAll(d.mountPath)
+	mounted := &nfsVolume{Id: "mounted", Device: d.mountPath + "mounted", Mounted: true,
+		Mountpath: d.mountPath + "mnt", MountOptions: &api.MountOptions{SubPath: "sub"},
+		SubPathMounts: []string{d.mountPath + "sub"}}
+	imported := &nfsVolume{Id: "imported", Device: d.mountPath + "data", Imported: true}
+	trashed := &nfsVolume{Id: "trashed", Device: d.mountPath + "trashed", Deleted: time.Now()}
+	for _, v := range []*nfsVolume{mounted, imported} {
+		if err := d.put(string(v.Id), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := d.db.Put(d.trashKey(string(trashed.Id)), trashed, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := volume.ExportManifest(d)
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	restore := newTestDriver(t)
+	defer os.RemoveAll(restore.mountPath)
+	restore.mountPath = d.mountPath
+	if err = volume.ImportManifest(restore, data, volume.ImportManifestOptions{DryRun: true}); err != nil {
+		t.Fatalf("Failed in dry run: %v", err)
+	}
+	if _, err = restore.get(string(mounted.Id)); err == nil {
+		t.Error("Dry run should not write records")
+	}
+	if err = volume.ImportManifest(restore, data, volume.ImportManifestOptions{}); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	v, err := restore.get(string(mounted.Id))
+	if err != nil || v.Device != mounted.Device {
+		t.Fatalf("Volume record should be restored: %+v %v", v, err)
+	}
+	if v.Mounted || v.Mountpath != "" || v.MountOptions != nil || len(v.SubPathMounts) != 0 {
+		t.Errorf("Stale mounts should be cleared on import: %+v", v)
+	}
+	if v, err = restore.get(string(imported.Id)); err != nil || !v.Imported {
+		t.Errorf("Imported volumes should keep their data on delete: %+v %v", v, err)
+	}
+	if _, err = restore.getTrashed(string(trashed.Id)); err != nil {
+		t.Errorf("Trash record should be restored: %v", err)
+	}
+	if _, err = restore.get(string(trashed.Id)); err == nil {
+		t.Error("Trashed volume should not be restored as a volume")
+	}
+
+	if err = restore.ImportManifest(data, volume.ImportManifestOptions{}); err == nil {
+		t.Error("Existing records should fail the import by default")
+	}
+	if err = restore.ImportManifest(data, volume.ImportManifestOptions{OnConflict: volume.ConflictSkip}); err != nil {
+		t.Errorf("Existing records should be skipped: %v", err)
+	}
+
+	other := newTestDriver(t)
+	defer os.RemoveAll(other.mountPath)
+	if err = other.ImportManifest(data, volume.ImportManifestOptions{DryRun: true}); err == nil {
+		t.Error("Directories outside of the export should be rejected")
+	}
+	if err = restore.put("overlap", &nfsVolume{Id: "overlap", Device: d.mountPath + "data/sub"}); err != nil {
+		t.Fatal(err)
+	}
+	restore.del(string(imported.Id))
+	err = restore.ImportManifest(data, volume.ImportManifestOptions{OnConflict: volume.ConflictSkip, DryRun: true})
+	if err == nil {
+		t.Error("Directories of other volumes should be rejected")
+	}
+}
+
+func TestRenameNamed(t *testing.T) {
+	d := newTestDriver(t)
+	defer os.RemoveAll(d.mountPath)
+	d.layout = LayoutNamed
+	id, err := d.Create(api.VolumeLocator{Name: "old"}, nil, &api.VolumeSpec{Format: api.FsNfs})
+	if err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	if err = d.Rename(id, "new"); err != nil {
+		t.Fatalf("Failed to rename: %v", err)
+	}
+	v, err := d.get(string(id))
+	if err != nil || v.Device != d.mountPath+"new" || v.Locator.Name != "new" {
+		t.Fatalf("Record not renamed: %+v %v", v, err)
+	}
+	if _, err = os.Stat(v.Device); err != nil {
+		t.Errorf("Directory not renamed: %v", err)
+	}
+
+	// The directory of a mounted volume stays where it is mounted from.
+	v.Mounted = true
+	v.Mountpath = d.mountPath + "mnt"
+	if err = d.put(string(id), v); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Rename(id, "other"); err != volume.ErrVolumeBusy {
+		t.Errorf("Renaming a mounted volume returned %v", err)
+	}
+	if v, err = d.get(string(id)); err != nil || v.Device != d.mountPath+"new" || !v.Mounted {
+		t.Errorf("Record of a mounted volume changed: %+v %v", v, err)
+	}
+}
+
+func TestReap(t *testing.T) {
+	d := newTestDriver(t)
+	defer os.RemoveAll(d.mountPath)
+	d.retention = time.Hour
+	for id, deleted := range map[string]time.Time{
+		"expired": time.Now().Add(-2 * time.Hour),
+		"recent":  time.Now(),
+	} {
+		v := &nfsVolume{Id: api.VolumeID(id), Device: d.mountPath + id, Deleted: deleted}
+		if _, err := d.db.Put(d.trashKey(id), v, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(d.trashPath(id), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.reap()
+	if _, err := d.getTrashed("expired"); err == nil {
+		t.Error("Expired volume should be purged")
+	}
+	if _, err := os.Stat(d.trashPath("expired")); !os.IsNotExist(err) {
+		t.Errorf("Data of the expired volume should be removed: %v", err)
+	}
+	if _, err := d.getTrashed("recent"); err != nil {
+		t.Errorf("Recently deleted volume should be kept: %v", err)
+	}
+
+	d.Shutdown()
+	d.Shutdown()
+}
@@ -0,0 +1,4 @@
+package nfs
+
+// sysSyncfs is missing from the syscall package on 386.
+const sysSyncfs = 344
@@ -0,0 +1,4 @@
+package nfs
+
+// sysSyncfs is missing from the syscall package on amd64.
+const sysSyncfs = 306
@@ -0,0 +1,7 @@
+// +build !amd64,!386
+
+package nfs
+
+import "syscall"
+
+const sysSyncfs = syscall.SYS_SYNCFS
@@ -0,0 +1,191 @@
+package nfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	// trashDir on the export that soft deleted volume directories move to.
+	trashDir = ".trash/"
+	// maxReapInterval between checks for expired volumes.
+	maxReapInterval = time.Hour
+)
+
+func (d *nfsDriver) trashKey(volumeID string) string {
+	return d.dbKey + ".trash/" + volumeID
+}
+
+func (d *nfsDriver) trashPath(volumeID string) string {
+	return d.mountPath + trashDir + volumeID
+}
+
+func (d *nfsDriver) getTrashed(volumeID string) (*nfsVolume, error) {
+	v := &nfsVolume{}
+	if _, err := d.db.GetVal(d.trashKey(volumeID), v); err != nil {
+		return nil, volume.ErrEnoEnt
+	}
+	return v, nil
+}
+
+// trash moves the volume record to the trash and its directory under
+// trashDir. Imported volumes keep their data where it is. The directory is
+// moved back if the trash record cannot be written.
+func (d *nfsDriver) trash(v *nfsVolume) error {
+	id := string(v.Id)
+	moved := false
+	if !v.Imported {
+		if err := os.MkdirAll(d.mountPath+trashDir, 0744); err != nil {
+			return err
+		}
+		err := os.Rename(v.Device, d.trashPath(id))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		moved = err == nil
+	}
+	v.Deleted = time.Now()
+	if _, err := d.db.Put(d.trashKey(id), v, 0); err != nil {
+		if moved {
+			if rerr := os.Rename(d.trashPath(id), v.Device); rerr != nil {
+				log.Warnf("Failed to move %v back to %v: %v", d.trashPath(id), v.Device, rerr)
+			}
+		}
+		return err
+	}
+	d.del(id)
+	return nil
+}
+
+// Undelete moves a trashed volume back to its original directory.
+func (d *nfsDriver) Undelete(volumeID api.VolumeID) error {
+	if err := d.CheckWritable(); err != nil {
+		return err
+	}
+	defer d.volumeLocks.lock(volumeID)()
+	id := string(volumeID)
+	v, err := d.getTrashed(id)
+	if err != nil {
+		return err
+	}
+	if !v.Imported {
+		if _, err = os.Stat(v.Device); err == nil {
+			return fmt.Errorf("Cannot restore %v, %v is in use", volumeID, v.Device)
+		}
+		if err = os.Rename(d.trashPath(id), v.Device); err != nil {
+			return err
+		}
+	}
+	v.Deleted = time.Time{}
+	v.Mounted = false
+	v.Mountpath = ""
+	if err = d.put(id, v); err != nil {
+		return err
+	}
+	_, err = d.db.Delete(d.trashKey(id))
+	return err
+}
+
+// Purge removes a trashed volume and its data.
+func (d *nfsDriver) Purge(volumeID api.VolumeID) error {
+	return d.purge(volumeID, 0)
+}
+
+// purge removes volumeID if it has been in the trash for at least age. The
+// record is read under the volume lock, the volume may have been restored
+// and deleted again since it was listed.
+func (d *nfsDriver) purge(volumeID api.VolumeID, age time.Duration) error {
+	if err := d.CheckWritable(); err != nil {
+		return err
+	}
+	defer d.volumeLocks.lock(volumeID)()
+	id := string(volumeID)
+	v, err := d.getTrashed(id)
+	if err != nil {
+		return err
+	}
+	if time.Since(v.Deleted) < age {
+		return nil
+	}
+	if !v.Imported {
+		if err = os.RemoveAll(d.trashPath(id)); err != nil {
+			return err
+		}
+	}
+	_, err = d.db.Delete(d.trashKey(id))
+	return err
+}
+
+func (d *nfsDriver) enumerateTrash() ([]*nfsVolume, error) {
+	kvps, err := d.db.Enumerate(d.dbKey + ".trash/")
+	if err != nil {
+		return nil, err
+	}
+	vs := make([]*nfsVolume, 0, len(kvps))
+	for _, kvp := range kvps {
+		v := &nfsVolume{}
+		if err = json.Unmarshal(kvp.Value, v); err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+	return vs, nil
+}
+
+// EnumerateTrash lists trashed volumes in the VolumeDeleted state.
+func (d *nfsDriver) EnumerateTrash() ([]api.Volume, error) {
+	vs, err := d.enumerateTrash()
+	if err != nil {
+		return nil, err
+	}
+	volumes := make([]api.Volume, 0, len(vs))
+	for _, v := range vs {
+		vol := v.volume()
+		vol.State = api.VolumeDeleted
+		vol.DevicePath = d.trashPath(string(v.Id))
+		volumes = append(volumes, vol)
+	}
+	return volumes, nil
+}
+
+// reap purges trashed volumes older than the retention period.
+func (d *nfsDriver) reap() {
+	vs, err := d.enumerateTrash()
+	if err != nil {
+		log.Warnf("Failed to list trashed volumes: %v", err)
+		return
+	}
+	for _, v := range vs {
+		if time.Since(v.Deleted) < d.retention {
+			continue
+		}
+		err = d.purge(v.Id, d.retention)
+		if err != nil && err != volume.ErrReadOnlyMode && err != volume.ErrEnoEnt {
+			log.Warnf("Failed to purge volume %v: %v", v.Id, err)
+		}
+	}
+}
+
+func (d *nfsDriver) reaper() {
+	interval := d.retention
+	if interval > maxReapInterval {
+		interval = maxReapInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			d.reap()
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package nfs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// VersionParam requests an NFS protocol version, e.g. "3" or "4.1", when
+	// the export is mounted. The kernel default is used if not set.
+	VersionParam = "nfs-version"
+	procMounts   = "/proc/mounts"
+)
+
+// mountedVersion returns the vers option the export at mountpath was
+// mounted with, which is the version the kernel negotiated.
+func mountedVersion(mountpath string) (string, error) {
+	f, err := os.Open(procMounts)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	mountpath = strings.TrimSuffix(mountpath, "/")
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 4 || fields[1] != mountpath {
+			continue
+		}
+		if v := parseVersion(fields[3]); v != "" {
+			return v, nil
+		}
+	}
+	if err = s.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("No NFS version found for %v", mountpath)
+}
+
+// parseVersion returns the vers or nfsvers value in a mount option string.
+func parseVersion(options string) string {
+	for _, o := range strings.Split(options, ",") {
+		if strings.HasPrefix(o, "vers=") {
+			return strings.TrimPrefix(o, "vers=")
+		}
+		if strings.HasPrefix(o, "nfsvers=") {
+			return strings.TrimPrefix(o, "nfsvers=")
+		}
+	}
+	return ""
+}
+
+// sameVersion returns true if the negotiated version satisfies the request,
+// "4" is satisfied by any 4.x minor version.
+func sameVersion(requested, negotiated string) bool {
+	return requested == negotiated || strings.HasPrefix(negotiated, requested+".")
+}
+
+// versionAlerts returns an alert for volumeID if the export was mounted
+// with another version than the one requested.
+func (d *nfsDriver) versionAlerts(volumeID api.VolumeID) []api.Alert {
+	if d.vers == "" || d.negotiated == "" || sameVersion(d.vers, d.negotiated) {
+		return nil
+	}
+	return []api.Alert{{
+		Type:     api.AlertNfsVersionMismatch,
+		VolumeID: volumeID,
+		Time:     d.mounted,
+		Message: fmt.Sprintf("NFS version %v was requested but %v was negotiated",
+			d.vers, d.negotiated),
+	}}
+}
+
+// setVersion records the version the export was mounted with and warns if
+// it is not the one requested.
+func (d *nfsDriver) setVersion() {
+	d.mounted = time.Now()
+	v, err := mountedVersion(d.mountPath)
+	if err != nil {
+		log.Warnf("Cannot determine the NFS version of %s: %v", d.mountPath, err)
+		return
+	}
+	d.negotiated = v
+	if d.vers != "" && !sameVersion(d.vers, v) {
+		log.Warnf("NFS version %s was requested for %s but %s was negotiated",
+			d.vers, d.nfsServer, v)
+	}
+}
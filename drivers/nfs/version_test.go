@@ -0,0 +1,43 @@
+package nfs
+
+import (
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		options string
+		want    string
+	}{
+		{"rw,relatime,vers=4.1,rsize=1048576,wsize=1048576,proto=tcp", "4.1"},
+		{"rw,nfsvers=3,proto=udp", "3"},
+		{"rw,vers=4.2,nfsvers=4.2", "4.2"},
+		{"rw,relatime", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if v := parseVersion(tt.options); v != tt.want {
+			t.Errorf("parseVersion(%q) = %q, want %q", tt.options, v, tt.want)
+		}
+	}
+}
+
+func TestSameVersion(t *testing.T) {
+	tests := []struct {
+		requested, negotiated string
+		want                  bool
+	}{
+		{"4", "4.1", true},
+		{"4.1", "4.1", true},
+		{"3", "3", true},
+		{"4.1", "4.2", false},
+		{"4", "3", false},
+		{"4", "41", false},
+	}
+	for _, tt := range tests {
+		if s := sameVersion(tt.requested, tt.negotiated); s != tt.want {
+			t.Errorf("sameVersion(%q, %q) = %v, want %v",
+				tt.requested, tt.negotiated, s, tt.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package nfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/libopenstorage/openstorage/volume"
+)
+
+const (
+	// WarmLabel set to "true" on a volume reads its data into the client
+	// cache in the background after it is mounted.
+	WarmLabel = "warm"
+	// WarmRateParam limits the read rate of the warm phase in bytes per
+	// second, DefaultWarmRate if not set.
+	WarmRateParam = "warm-rate"
+	// DefaultWarmRate of 10MB/s.
+	DefaultWarmRate = 10 << 20
+
+	warmChunk = 1 << 20
+)
+
+// warmProgress of the warm phase of a volume. Files that cannot be read
+// are skipped.
+type warmProgress struct {
+	files uint64
+	bytes uint64
+	// state is "running", "done" or "stopped".
+	state string
+	stop  chan struct{}
+}
+
+var errWarmStopped = errors.New("Warm phase stopped")
+
+// warmer tracks the warm phases in progress and the last one of each
+// volume.
+type warmer struct {
+	sync.Mutex
+	rate     uint64
+	progress map[api.VolumeID]*warmProgress
+}
+
+// parseWarmRate returns the WarmRateParam in params, DefaultWarmRate if not
+// set.
+func parseWarmRate(params volume.DriverParams) (uint64, error) {
+	v, ok := params[WarmRateParam]
+	if !ok {
+		return DefaultWarmRate, nil
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("Invalid %s %q", WarmRateParam, v)
+	}
+	return n, nil
+}
+
+// startWarm reads the files under dir in the background if the volume has
+// WarmLabel set. A warm phase already running for the volume is stopped.
+func (d *nfsDriver) startWarm(v *nfsVolume, dir string) {
+	if warm, _ := strconv.ParseBool(v.Locator.VolumeLabels[WarmLabel]); !warm {
+		return
+	}
+	d.stopWarm(v.Id)
+	p := &warmProgress{state: "running", stop: make(chan struct{})}
+	d.warm.Lock()
+	if d.warm.progress == nil {
+		d.warm.progress = make(map[api.VolumeID]*warmProgress)
+	}
+	d.warm.progress[v.Id] = p
+	rate := d.warm.rate
+	d.warm.Unlock()
+	go d.warmVolume(v.Id, dir, rate, p)
+}
+
+// stopWarm stops the warm phase of volumeID if it is running.
+func (d *nfsDriver) stopWarm(volumeID api.VolumeID) {
+	d.warm.Lock()
+	defer d.warm.Unlock()
+	if p, ok := d.warm.progress[volumeID]; ok && p.state == "running" {
+		close(p.stop)
+		p.state = "stopped"
+	}
+}
+
+// clearWarm stops the warm phase of volumeID and forgets its progress.
+func (d *nfsDriver) clearWarm(volumeID api.VolumeID) {
+	d.stopWarm(volumeID)
+	d.warm.Lock()
+	delete(d.warm.progress, volumeID)
+	d.warm.Unlock()
+}
+
+// stopAllWarm stops all warm phases that are running.
+func (d *nfsDriver) stopAllWarm() {
+	d.warm.Lock()
+	defer d.warm.Unlock()
+	for _, p := range d.warm.progress {
+		if p.state == "running" {
+			close(p.stop)
+			p.state = "stopped"
+		}
+	}
+}
+
+// warmVolume reads every file under dir, at most rate bytes per second.
+func (d *nfsDriver) warmVolume(volumeID api.VolumeID, dir string, rate uint64, p *warmProgress) {
+	start := time.Now()
+	buf := make([]byte, warmChunk)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+		for {
+			n, rerr := f.Read(buf)
+			d.warm.Lock()
+			p.bytes += uint64(n)
+			read := p.bytes
+			d.warm.Unlock()
+			// Sleep until the average rate is back under the limit.
+			ahead := time.Duration(float64(read)/float64(rate)*float64(time.Second)) -
+				time.Since(start)
+			select {
+			case <-p.stop:
+				return errWarmStopped
+			case <-time.After(ahead):
+			}
+			if rerr == io.EOF {
+				break
+			}
+			if rerr != nil {
+				return nil
+			}
+		}
+		d.warm.Lock()
+		p.files++
+		d.warm.Unlock()
+		return nil
+	})
+
+	d.warm.Lock()
+	defer d.warm.Unlock()
+	if err == errWarmStopped {
+		log.Infof("Warming volume %v stopped after %d files", volumeID, p.files)
+		return
+	}
+	p.state = "done"
+	log.Infof("Warmed volume %v: %d files, %d bytes in %v",
+		volumeID, p.files, p.bytes, time.Since(start))
+}
+
+// warmStatus lists the progress of each volume's last warm phase.
+func (d *nfsDriver) warmStatus() [][2]string {
+	d.warm.Lock()
+	defer d.warm.Unlock()
+	status := make([][2]string, 0, len(d.warm.progress))
+	for id, p := range d.warm.progress {
+		status = append(status, [2]string{
+			"Warm " + string(id),
+			fmt.Sprintf("%d files, %d bytes, %s", p.files, p.bytes, p.state),
+		})
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i][0] < status[j][0] })
+	return status
+}
@@ -24,7 +24,7 @@ type Context struct {
 	mountPath  string
 	tgtPath    string
 	devicePath string
-	Filesystem string
+	Filesystem api.Filesystem
 }
 
 func NewContext(d volume.VolumeDriver) *Context {
@@ -32,7 +32,7 @@ func NewContext(d volume.VolumeDriver) *Context {
 		VolumeDriver: d,
 		volID:        api.BadVolumeID,
 		snapID:       api.BadSnapID,
-		Filesystem:   string(api.FsBtrfs),
+		Filesystem:   api.FsBtrfs,
 	}
 }
 
@@ -77,7 +77,7 @@ func create(t *testing.T, ctx *Context) {
 		&api.CreateOptions{FailIfExists: false},
 		&api.VolumeSpec{Size: 10240000,
 			HALevel: 1,
-			Format:  api.Filesystem(ctx.Filesystem),
+			Format:  ctx.Filesystem,
 		})
 
 	assert.NoError(t, err, "Failed in Create")
@@ -162,7 +162,7 @@ func mount(t *testing.T, ctx *Context) {
 	err = os.MkdirAll(tgtPath, 0755)
 	assert.NoError(t, err, "Failed in mkdir")
 
-	err = ctx.Mount(ctx.volID, tgtPath)
+	err = ctx.Mount(ctx.volID, tgtPath, nil)
 	assert.NoError(t, err, "Failed in mount")
 
 	ctx.mountPath = mountPath
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/codegangsta/cli"
 
@@ -57,6 +59,10 @@ func start(c *cli.Context) {
 		return
 	}
 
+	if len(cfg.Osd.TagKeys) > 0 {
+		volume.SetTagKeys(cfg.Osd.TagKeys)
+	}
+
 	// Start the volume drivers.
 	for d, v := range cfg.Osd.Drivers {
 
@@ -80,8 +86,16 @@ func start(c *cli.Context) {
 		}
 	}
 
-	// Daemon does not exit.
-	select {}
+	// Daemon runs until signalled, then drains in-flight requests before
+	// shutting down the drivers.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-sigs
+	fmt.Println("Received signal, shutting down: ", sig)
+	if err := apiserver.Shutdown(apiserver.ShutdownTimeout); err != nil {
+		fmt.Println("Failed to drain REST servers: ", err)
+	}
+	volume.Shutdown()
 }
 
 func main() {
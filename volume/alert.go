@@ -0,0 +1,130 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// AlertThresholdLabel in VolumeSpec.ConfigLabels sets the percentage of
+	// the volume size above which a capacity alert is raised.
+	AlertThresholdLabel = "alert-threshold"
+	// DefaultAlertCooldown between two capacity alerts on the same volume.
+	DefaultAlertCooldown = 10 * time.Minute
+)
+
+// AlertThreshold returns the capacity alert threshold of v in percent, or 0
+// if v has none.
+func AlertThreshold(v *api.Volume) (float64, error) {
+	if v.Spec == nil || v.Spec.ConfigLabels[AlertThresholdLabel] == "" {
+		return 0, nil
+	}
+	t, err := strconv.ParseFloat(v.Spec.ConfigLabels[AlertThresholdLabel], 64)
+	if err != nil || t <= 0 || t > 100 {
+		return 0, fmt.Errorf("Invalid %v %q: must be a percentage",
+			AlertThresholdLabel, v.Spec.ConfigLabels[AlertThresholdLabel])
+	}
+	return t, nil
+}
+
+// AlertSubscriber is implemented by drivers that stream alerts as they are
+// raised.
+type AlertSubscriber interface {
+	// SubscribeAlerts returns a channel receiving alerts raised from now on.
+	// The channel is closed once ctx is done.
+	SubscribeAlerts(ctx context.Context) (<-chan api.Alert, error)
+}
+
+// AlertBroker fans alerts out to subscribers. A subscriber that falls more
+// than alertBacklog alerts behind misses alerts rather than blocking the
+// publisher.
+type AlertBroker struct {
+	sync.Mutex
+	subs map[chan api.Alert]struct{}
+}
+
+const alertBacklog = 64
+
+// NewAlertBroker returns an AlertBroker with no subscribers.
+func NewAlertBroker() *AlertBroker {
+	return &AlertBroker{subs: make(map[chan api.Alert]struct{})}
+}
+
+// SubscribeAlerts implements AlertSubscriber.
+func (b *AlertBroker) SubscribeAlerts(ctx context.Context) (<-chan api.Alert, error) {
+	c := make(chan api.Alert, alertBacklog)
+	b.Lock()
+	b.subs[c] = struct{}{}
+	b.Unlock()
+	go func() {
+		<-ctx.Done()
+		b.Lock()
+		delete(b.subs, c)
+		close(c)
+		b.Unlock()
+	}()
+	return c, nil
+}
+
+// Publish sends alerts to all subscribers.
+func (b *AlertBroker) Publish(alerts ...api.Alert) {
+	b.Lock()
+	defer b.Unlock()
+	for c := range b.subs {
+		for _, a := range alerts {
+			select {
+			case c <- a:
+			default:
+			}
+		}
+	}
+}
+
+// CapacityAlerter raises capacity alerts on volumes whose usage crosses their
+// AlertThresholdLabel, at most once per Cooldown for each volume.
+type CapacityAlerter struct {
+	Cooldown time.Duration
+	sync.Mutex
+	last map[api.VolumeID]time.Time
+}
+
+// NewCapacityAlerter returns a CapacityAlerter with the given cooldown.
+func NewCapacityAlerter(cooldown time.Duration) *CapacityAlerter {
+	return &CapacityAlerter{
+		Cooldown: cooldown,
+		last:     make(map[api.VolumeID]time.Time),
+	}
+}
+
+// Check returns a capacity alert if usage bytes of v exceed its threshold.
+// The threshold is read from v on every call so label updates apply at once.
+func (a *CapacityAlerter) Check(v *api.Volume, usage uint64) ([]api.Alert, error) {
+	t, err := AlertThreshold(v)
+	if err != nil || t == 0 || v.Spec.Size == 0 {
+		return nil, err
+	}
+	pct := float64(usage) * 100 / float64(v.Spec.Size)
+
+	a.Lock()
+	defer a.Unlock()
+	if pct < t {
+		delete(a.last, v.ID)
+		return nil, nil
+	}
+	now := time.Now()
+	if last, ok := a.last[v.ID]; ok && now.Sub(last) < a.Cooldown {
+		return nil, nil
+	}
+	a.last[v.ID] = now
+	return []api.Alert{{
+		Type:     api.AlertCapacityUsage,
+		VolumeID: v.ID,
+		Time:     now,
+		Message:  fmt.Sprintf("Volume %v is %.1f%% full, threshold %v%%", v.ID, pct, t),
+	}}, nil
+}
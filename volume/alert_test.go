@@ -0,0 +1,63 @@
+package volume
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestCapacityAlerter(t *testing.T) {
+	v := &api.Volume{
+		ID:   "alertvol",
+		Spec: &api.VolumeSpec{Size: 100, ConfigLabels: api.Labels{}},
+	}
+	a := NewCapacityAlerter(time.Hour)
+
+	alerts, err := a.Check(v, 90)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(alerts), "No threshold means no alerts")
+
+	v.Spec.ConfigLabels[AlertThresholdLabel] = "80"
+	alerts, err = a.Check(v, 90)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(alerts), "Usage above threshold")
+	alerts, err = a.Check(v, 95)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(alerts), "Alert should be held back by the cooldown")
+
+	alerts, err = a.Check(v, 50)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(alerts), "Usage below threshold")
+	alerts, err = a.Check(v, 85)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(alerts), "Crossing again should raise a new alert")
+
+	v.Spec.ConfigLabels[AlertThresholdLabel] = "200"
+	_, err = a.Check(v, 85)
+	assert.Error(t, err, "Threshold above 100% is invalid")
+}
+
+func TestAlertBroker(t *testing.T) {
+	b := NewAlertBroker()
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	c1, err := b.SubscribeAlerts(ctx1)
+	assert.NoError(t, err)
+	c2, err := b.SubscribeAlerts(ctx2)
+	assert.NoError(t, err)
+
+	b.Publish(api.Alert{Type: api.AlertMountFailure, VolumeID: "v1"})
+	assert.Equal(t, api.VolumeID("v1"), (<-c1).VolumeID, "First subscriber")
+	assert.Equal(t, api.VolumeID("v1"), (<-c2).VolumeID, "Second subscriber")
+
+	cancel1()
+	_, ok := <-c1
+	assert.False(t, ok, "Channel should be closed after cancel")
+	b.Publish(api.Alert{VolumeID: "v2"})
+	assert.Equal(t, api.VolumeID("v2"), (<-c2).VolumeID, "Remaining subscriber")
+}
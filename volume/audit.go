@@ -0,0 +1,253 @@
+package volume
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/kvdb"
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const auditKeyPrefix = "openstorage/audit/"
+
+type actorKey struct{}
+
+// ContextWithActor returns a copy of ctx that carries the actor recorded in
+// audit entries.
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by ContextWithActor, if any.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// AuditLogger records audit entries. Implementations must not modify or
+// drop entries once logged.
+type AuditLogger interface {
+	Log(entry api.AuditEntry)
+}
+
+type auditDriver struct {
+	VolumeDriver
+	actor  string
+	logger AuditLogger
+}
+
+// WithAudit returns a VolumeDriver that logs every Create, Delete,
+// DeleteRecursive, Snapshot, SnapDelete, Format, Attach, Detach, Mount and
+// Unmount of d to l, with the actor taken from ctx.
+func WithAudit(ctx context.Context, d VolumeDriver, l AuditLogger) VolumeDriver {
+	return &auditDriver{VolumeDriver: d, actor: ActorFromContext(ctx), logger: l}
+}
+
+func (a *auditDriver) log(op string, volumeID api.VolumeID, err error) {
+	a.logSnap(op, volumeID, api.BadSnapID, err)
+}
+
+func (a *auditDriver) logSnap(op string, volumeID api.VolumeID, snapID api.SnapID, err error) {
+	entry := api.AuditEntry{
+		Time:      time.Now(),
+		Actor:     a.actor,
+		Operation: op,
+		VolumeID:  volumeID,
+		SnapID:    snapID,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	a.logger.Log(entry)
+}
+
+// Unwrap returns the driver passed to WithAudit.
+func (a *auditDriver) Unwrap() VolumeDriver {
+	return a.VolumeDriver
+}
+
+// Capabilities of the wrapped driver, so that fallbacks keyed on them still
+// apply.
+func (a *auditDriver) Capabilities() Capabilities {
+	return GetCapabilities(a.VolumeDriver)
+}
+
+func (a *auditDriver) Create(
+	locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (api.VolumeID, error) {
+
+	id, err := a.VolumeDriver.Create(locator, options, spec)
+	a.log(OpCreate, id, err)
+	return id, err
+}
+
+func (a *auditDriver) Delete(volumeID api.VolumeID) error {
+	err := a.VolumeDriver.Delete(volumeID)
+	a.log(OpDelete, volumeID, err)
+	return err
+}
+
+func (a *auditDriver) DeleteRecursive(volumeID api.VolumeID) error {
+	err := DeleteRecursive(a.VolumeDriver, volumeID)
+	a.log(OpDeleteRecursive, volumeID, err)
+	return err
+}
+
+func (a *auditDriver) Snapshot(volumeID api.VolumeID, labels api.Labels) (api.SnapID, error) {
+	id, err := a.VolumeDriver.Snapshot(volumeID, labels)
+	a.logSnap(OpSnapshot, volumeID, id, err)
+	return id, err
+}
+
+// SnapDelete is logged under the volume the snapshot was taken of, if the
+// snapshot can be found.
+func (a *auditDriver) SnapDelete(snapID api.SnapID) error {
+	volumeID := api.BadVolumeID
+	if snaps, err := a.VolumeDriver.SnapInspect([]api.SnapID{snapID}); err == nil && len(snaps) == 1 {
+		volumeID = snaps[0].VolumeID
+	}
+	err := a.VolumeDriver.SnapDelete(snapID)
+	a.logSnap(OpSnapDelete, volumeID, snapID, err)
+	return err
+}
+
+func (a *auditDriver) Format(volumeID api.VolumeID) error {
+	err := a.VolumeDriver.Format(volumeID)
+	a.log(OpFormat, volumeID, err)
+	return err
+}
+
+func (a *auditDriver) Attach(volumeID api.VolumeID) (string, error) {
+	path, err := a.VolumeDriver.Attach(volumeID)
+	a.log(OpAttach, volumeID, err)
+	return path, err
+}
+
+func (a *auditDriver) Detach(volumeID api.VolumeID) error {
+	err := a.VolumeDriver.Detach(volumeID)
+	a.log(OpDetach, volumeID, err)
+	return err
+}
+
+func (a *auditDriver) Mount(volumeID api.VolumeID, mountpath string, opts *api.MountOptions) error {
+	err := a.VolumeDriver.Mount(volumeID, mountpath, opts)
+	a.log(OpMount, volumeID, err)
+	return err
+}
+
+func (a *auditDriver) Unmount(volumeID api.VolumeID, mountpath string) error {
+	err := a.VolumeDriver.Unmount(volumeID, mountpath)
+	a.log(OpUnmount, volumeID, err)
+	return err
+}
+
+// KvdbAuditLog stores audit entries in kvdb, keyed by volume and time.
+type KvdbAuditLog struct {
+	kvdb kvdb.Kvdb
+}
+
+// NewKvdbAuditLog returns an audit log stored in kv.
+func NewKvdbAuditLog(kv kvdb.Kvdb) *KvdbAuditLog {
+	return &KvdbAuditLog{kvdb: kv}
+}
+
+func (k *KvdbAuditLog) prefix(volumeID api.VolumeID) string {
+	return auditKeyPrefix + string(volumeID) + "/"
+}
+
+// Log creates a new key for entry. Existing keys are never overwritten.
+func (k *KvdbAuditLog) Log(entry api.AuditEntry) {
+	key := fmt.Sprintf("%s%020d", k.prefix(entry.VolumeID), entry.Time.UnixNano())
+	for i := 0; ; i++ {
+		_, err := k.kvdb.Create(fmt.Sprintf("%s-%d", key, i), &entry, 0)
+		if err == nil {
+			return
+		}
+		if err != kvdb.ErrExist {
+			log.Warnf("Failed to record audit entry %+v: %v", entry, err)
+			return
+		}
+	}
+}
+
+// Query returns the entries for volumeID logged in [from, to), oldest first.
+func (k *KvdbAuditLog) Query(volumeID api.VolumeID, from, to time.Time) ([]api.AuditEntry, error) {
+	kvp, err := k.kvdb.Enumerate(k.prefix(volumeID))
+	if err != nil {
+		return nil, err
+	}
+	entries := []api.AuditEntry{}
+	for _, v := range kvp {
+		var entry api.AuditEntry
+		if err = json.Unmarshal(v.Value, &entry); err != nil {
+			return nil, err
+		}
+		if !entry.Time.Before(from) && entry.Time.Before(to) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Sort(auditEntries(entries))
+	return entries, nil
+}
+
+type auditEntries []api.AuditEntry
+
+func (a auditEntries) Len() int           { return len(a) }
+func (a auditEntries) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a auditEntries) Less(i, j int) bool { return a[i].Time.Before(a[j].Time) }
+
+// FileAuditLogger appends audit entries to a file as JSON lines.
+type FileAuditLogger struct {
+	sync.Mutex
+	f *os.File
+}
+
+// NewFileAuditLogger opens path for appending, creating it if needed.
+func NewFileAuditLogger(path string) (*FileAuditLogger, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditLogger{f: f}, nil
+}
+
+func (l *FileAuditLogger) Log(entry api.AuditEntry) {
+	l.Lock()
+	defer l.Unlock()
+	if err := json.NewEncoder(l.f).Encode(&entry); err != nil {
+		log.Warnf("Failed to record audit entry %+v: %v", entry, err)
+	}
+}
+
+// SyslogAuditLogger sends audit entries to the local syslog.
+type SyslogAuditLogger struct {
+	w *syslog.Writer
+}
+
+// NewSyslogAuditLogger connects to syslog, tagging entries with tag.
+func NewSyslogAuditLogger(tag string) (*SyslogAuditLogger, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogAuditLogger{w: w}, nil
+}
+
+func (l *SyslogAuditLogger) Log(entry api.AuditEntry) {
+	b, err := json.Marshal(&entry)
+	if err == nil {
+		err = l.w.Info(string(b))
+	}
+	if err != nil {
+		log.Warnf("Failed to record audit entry %+v: %v", entry, err)
+	}
+}
@@ -0,0 +1,80 @@
+package volume
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/kvdb"
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// auditSnapDriver is a flakyDriver that takes snapshots of "snapped".
+type auditSnapDriver struct {
+	flakyDriver
+}
+
+func (d *auditSnapDriver) Snapshot(volumeID api.VolumeID, labels api.Labels) (api.SnapID, error) {
+	return "snap", nil
+}
+
+func (d *auditSnapDriver) SnapInspect(ids []api.SnapID) ([]api.VolumeSnap, error) {
+	return []api.VolumeSnap{{ID: ids[0], VolumeID: "snapped"}}, nil
+}
+
+func (d *auditSnapDriver) SnapDelete(snapID api.SnapID) error {
+	return nil
+}
+
+func TestAuditLog(t *testing.T) {
+	audit := NewKvdbAuditLog(kvdb.Instance())
+	f := &flakyDriver{failures: 1, err: ErrVolAttached}
+	d := WithAudit(ContextWithActor(context.Background(), "alice"), f, audit)
+
+	start := time.Now()
+	err := d.Mount("audited", "/mnt", nil)
+	assert.Equal(t, ErrVolAttached, err, "First mount should fail")
+	err = d.Mount("audited", "/mnt", nil)
+	assert.NoError(t, err, "Second mount should succeed")
+
+	entries, err := audit.Query("audited", start, time.Now().Add(time.Second))
+	assert.NoError(t, err, "Failed in Query")
+	assert.Equal(t, 2, len(entries), "Number of audit entries")
+	if len(entries) == 2 {
+		assert.Equal(t, "alice", entries[0].Actor, "Actor")
+		assert.Equal(t, OpMount, entries[0].Operation, "Operation")
+		assert.Equal(t, ErrVolAttached.Error(), entries[0].Error, "Failed entry")
+		assert.Equal(t, "", entries[1].Error, "Successful entry")
+	}
+
+	err = d.Detach("detached")
+	assert.NoError(t, err, "Detach should succeed")
+	entries, err = audit.Query("detached", start, time.Now().Add(time.Second))
+	assert.NoError(t, err, "Failed in Query")
+	if assert.Equal(t, 1, len(entries), "Number of audit entries") {
+		assert.Equal(t, OpDetach, entries[0].Operation, "Operation")
+	}
+
+	d = WithAudit(context.Background(), &auditSnapDriver{}, audit)
+	snapID, err := d.Snapshot("snapped", nil)
+	assert.NoError(t, err, "Snapshot should succeed")
+	assert.NoError(t, d.SnapDelete(snapID), "SnapDelete should succeed")
+	entries, err = audit.Query("snapped", start, time.Now().Add(time.Second))
+	assert.NoError(t, err, "Failed in Query")
+	if assert.Equal(t, 2, len(entries), "Number of audit entries") {
+		assert.Equal(t, OpSnapshot, entries[0].Operation, "Operation")
+		assert.Equal(t, OpSnapDelete, entries[1].Operation, "Operation")
+		assert.Equal(t, snapID, entries[0].SnapID, "Created snapshot")
+		assert.Equal(t, snapID, entries[1].SnapID, "Deleted snapshot")
+	}
+
+	entries, err = audit.Query("audited", start.Add(-time.Hour), start)
+	assert.NoError(t, err, "Failed in Query")
+	assert.Equal(t, 0, len(entries), "Entries before the range")
+
+	entries, err = audit.Query(api.VolumeID("other"), start, time.Now())
+	assert.NoError(t, err, "Failed in Query")
+	assert.Equal(t, 0, len(entries), "Entries of another volume")
+}
@@ -0,0 +1,56 @@
+package volume
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+)
+
+// ApplyIOLimits throttles IO to device by all processes in cgroup. Zero
+// limits remove the throttle. ErrNotSupported is returned if device is not
+// a block device or cgroup has no IO controller.
+func ApplyIOLimits(cgroup, device string, l IOLimits) error {
+	var st syscall.Stat_t
+	if err := syscall.Stat(device, &st); err != nil {
+		return err
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFBLK {
+		return ErrNotSupported
+	}
+	rdev := uint64(st.Rdev)
+	dev := fmt.Sprintf("%d:%d",
+		(rdev>>8)&0xfff|(rdev>>32)&0xfffff000,
+		rdev&0xff|(rdev>>12)&0xffffff00)
+
+	// cgroup v2
+	if _, err := os.Stat(path.Join(cgroup, "io.max")); err == nil {
+		max := func(n uint64) string {
+			if n == 0 {
+				return "max"
+			}
+			return fmt.Sprint(n)
+		}
+		rule := fmt.Sprintf("%s riops=%s wiops=%s rbps=%s wbps=%s",
+			dev, max(l.Iops), max(l.Iops), max(l.Bps), max(l.Bps))
+		return ioutil.WriteFile(path.Join(cgroup, "io.max"), []byte(rule), 0644)
+	}
+
+	// cgroup v1
+	if _, err := os.Stat(path.Join(cgroup, "blkio.throttle.read_iops_device")); err != nil {
+		return ErrNotSupported
+	}
+	for file, limit := range map[string]uint64{
+		"blkio.throttle.read_iops_device":  l.Iops,
+		"blkio.throttle.write_iops_device": l.Iops,
+		"blkio.throttle.read_bps_device":   l.Bps,
+		"blkio.throttle.write_bps_device":  l.Bps,
+	} {
+		rule := fmt.Sprintf("%s %d", dev, limit)
+		if err := ioutil.WriteFile(path.Join(cgroup, file), []byte(rule), 0644); err != nil {
+			return fmt.Errorf("Failed to set %v on %v: %v", file, device, err)
+		}
+	}
+	return nil
+}
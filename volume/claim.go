@@ -0,0 +1,82 @@
+package volume
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/libopenstorage/kvdb"
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// claimRetries bounds the attempts to update a claim that keeps changing
+// underneath us.
+const claimRetries = 5
+
+// compareAndUpdate applies fn to the stored volume and writes it back only
+// if the record has not been modified in between.
+func (e *DefaultEnumerator) compareAndUpdate(volID api.VolumeID, fn func(v *api.Volume) (bool, error)) error {
+	if err := e.CheckWritable(); err != nil {
+		return err
+	}
+	for i := 0; i < claimRetries; i++ {
+		kvp, err := e.kvdb.Get(e.volKey(volID))
+		if err != nil {
+			return ErrEnoEnt
+		}
+		var v api.Volume
+		if err = json.Unmarshal(kvp.Value, &v); err != nil {
+			return err
+		}
+		if err = migrate(&v); err != nil {
+			return err
+		}
+		changed, err := fn(&v)
+		if err != nil || !changed {
+			return err
+		}
+		v.SchemaVersion = SchemaVersion
+		if kvp.Value, err = json.Marshal(&v); err != nil {
+			return err
+		}
+		_, err = e.kvdb.CompareAndSet(kvp, kvdb.KVModifiedIndex, nil)
+		if err != kvdb.ErrValueMismatch {
+			return err
+		}
+	}
+	return fmt.Errorf("Volume %v is being modified concurrently", volID)
+}
+
+// ClaimVolume records node as the node volID is attached on. Claiming a
+// volume already held by node succeeds.
+// Errors ErrEnoEnt, ErrVolumeAttachedElsewhere may be returned.
+func (e *DefaultEnumerator) ClaimVolume(volID api.VolumeID, node api.MachineID) error {
+	return e.compareAndUpdate(volID, func(v *api.Volume) (bool, error) {
+		switch v.AttachedOn {
+		case node:
+			return false, nil
+		case "":
+			v.AttachedOn = node
+			return true, nil
+		}
+		return false, ErrVolumeAttachedElsewhere
+	})
+}
+
+// ReleaseVolume clears the claim of node on volID so that another node can
+// claim it. The volume must be unmounted first.
+// Errors ErrEnoEnt, ErrVolumeAttachedElsewhere may be returned.
+func (e *DefaultEnumerator) ReleaseVolume(volID api.VolumeID, node api.MachineID) error {
+	return e.compareAndUpdate(volID, func(v *api.Volume) (bool, error) {
+		switch v.AttachedOn {
+		case "":
+			return false, nil
+		case node:
+			if v.AttachPath != "" {
+				return false, fmt.Errorf("Volume %v is mounted at %v", volID, v.AttachPath)
+			}
+			v.AttachedOn = ""
+			return true, nil
+		}
+		return false, ErrVolumeAttachedElsewhere
+	})
+}
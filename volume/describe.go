@@ -0,0 +1,39 @@
+package volume
+
+import (
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// Describe collects volumeID, its snapshots and stats from d in a single
+// VolumeDescription. Snapshots are empty and stats are left out if d does not
+// support them.
+func Describe(d VolumeDriver, volumeID api.VolumeID) (api.VolumeDescription, error) {
+	var desc api.VolumeDescription
+	vols, err := d.Inspect([]api.VolumeID{volumeID})
+	if err != nil {
+		return desc, err
+	}
+	if len(vols) != 1 {
+		return desc, ErrEnoEnt
+	}
+	desc.Volume = vols[0]
+
+	desc.Snapshots, err = d.SnapEnumerate([]api.VolumeID{volumeID}, nil)
+	switch err {
+	case nil:
+	case ErrNotSupported:
+		desc.Snapshots = []api.VolumeSnap{}
+	default:
+		return desc, err
+	}
+
+	stats, err := d.Stats(volumeID)
+	switch err {
+	case nil:
+		desc.Stats = &stats
+	case ErrNotSupported:
+	default:
+		return desc, err
+	}
+	return desc, nil
+}
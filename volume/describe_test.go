@@ -0,0 +1,34 @@
+package volume
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// bareDriver supports neither snapshots nor stats.
+type bareDriver struct {
+	VolumeDriver
+}
+
+func (b *bareDriver) Inspect(volumeIDs []api.VolumeID) ([]api.Volume, error) {
+	return []api.Volume{{ID: volumeIDs[0]}}, nil
+}
+
+func (b *bareDriver) SnapEnumerate(volIDs []api.VolumeID, snapLabels api.Labels) ([]api.VolumeSnap, error) {
+	return nil, ErrNotSupported
+}
+
+func (b *bareDriver) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
+	return api.VolumeStats{}, ErrNotSupported
+}
+
+func TestDescribeNotSupported(t *testing.T) {
+	desc, err := Describe(&bareDriver{}, api.VolumeID(volName))
+	assert.NoError(t, err, "Describe should degrade without snapshots and stats")
+	assert.Equal(t, api.VolumeID(volName), desc.Volume.ID)
+	assert.Equal(t, 0, len(desc.Snapshots))
+	assert.Nil(t, desc.Stats)
+}
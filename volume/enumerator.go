@@ -3,8 +3,13 @@ package volume
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
 	_ "sync"
 
+	log "github.com/Sirupsen/logrus"
+
 	"github.com/libopenstorage/kvdb"
 	"github.com/libopenstorage/openstorage/api"
 )
@@ -14,6 +19,8 @@ const (
 	locks     = "/locks/"
 	volumes   = "/volumes/"
 	snapshots = "/snapshots/"
+	devices   = "/devices/"
+	names     = "/names/"
 )
 
 type DefaultEnumeratorUpdate interface {
@@ -29,6 +36,9 @@ type DefaultEnumeratorUpdate interface {
 	// GetVol from volID.
 	GetVol(volID api.VolumeID) (*api.Volume, error)
 
+	// GetVolByDevice returns the volume whose DevicePath is devicePath.
+	GetVolByDevice(devicePath string) (*api.Volume, error)
+
 	// UpdateVol with vol
 	UpdateVol(vol *api.Volume) error
 
@@ -50,15 +60,24 @@ type DefaultEnumeratorUpdate interface {
 
 // DefaultEnumerator for volume information. Implements the Enumerator Interface
 type DefaultEnumerator struct {
+	// ReadOnlyMode rejects record updates while set.
+	ReadOnlyMode
 	kvdb          kvdb.Kvdb
 	driver        string
 	lockKeyPrefix string
 	volKeyPrefix  string
 	snapKeyPrefix string
+	devKeyPrefix  string
+	nameKeyPrefix string
+}
+
+// deviceIndex is the value of the DevicePath to VolumeID index.
+type deviceIndex struct {
+	VolumeID api.VolumeID
 }
 
 func (e *DefaultEnumerator) lockKey(volID api.VolumeID) string {
-	return e.volKeyPrefix + string(volID) + ".lock"
+	return e.lockKeyPrefix + string(volID)
 }
 
 func (e *DefaultEnumerator) snapKey(snapID api.SnapID) string {
@@ -69,6 +88,29 @@ func (e *DefaultEnumerator) volKey(volID api.VolumeID) string {
 	return e.volKeyPrefix + string(volID)
 }
 
+func (e *DefaultEnumerator) devKey(devicePath string) string {
+	return e.devKeyPrefix + url.QueryEscape(devicePath)
+}
+
+func (e *DefaultEnumerator) nameKey(name string) string {
+	return e.nameKeyPrefix + url.QueryEscape(name)
+}
+
+// updateDevIndex points the index entry of vol.DevicePath at vol and
+// removes the entry for oldPath if the device path changed.
+func (e *DefaultEnumerator) updateDevIndex(vol *api.Volume, oldPath string) error {
+	if oldPath != "" && oldPath != vol.DevicePath {
+		if _, err := e.kvdb.Delete(e.devKey(oldPath)); err != nil {
+			return err
+		}
+	}
+	if vol.DevicePath == "" || vol.DevicePath == oldPath {
+		return nil
+	}
+	_, err := e.kvdb.Put(e.devKey(vol.DevicePath), &deviceIndex{VolumeID: vol.ID}, 0)
+	return err
+}
+
 func hasSubset(set api.Labels, subset api.Labels) bool {
 	if subset == nil {
 		return true
@@ -93,7 +135,9 @@ func contains(volID api.VolumeID, set []api.VolumeID) bool {
 	return false
 }
 
-func match(v *api.Volume, locator api.VolumeLocator, configLabels api.Labels) bool {
+// Match returns true if v matches the locator and has all the configLabels.
+// An empty locator name matches any volume.
+func Match(v *api.Volume, locator api.VolumeLocator, configLabels api.Labels) bool {
 	if locator.Name != "" && v.Locator.Name != locator.Name {
 		return false
 	}
@@ -103,15 +147,119 @@ func match(v *api.Volume, locator api.VolumeLocator, configLabels api.Labels) bo
 	return hasSubset(v.Spec.ConfigLabels, configLabels)
 }
 
+// VolumeExists returns the ID of the volume with the same name and labels as
+// locator, if there is one. Drivers must hold a lock from this lookup until
+// the record of the new volume is written, so that concurrent retries of an
+// idempotent Create do not both create a volume.
+func VolumeExists(e Enumerator, locator api.VolumeLocator) (api.VolumeID, bool, error) {
+	vols, err := e.Enumerate(api.VolumeLocator{Name: locator.Name}, nil)
+	if err != nil {
+		return api.BadVolumeID, false, err
+	}
+	for _, v := range vols {
+		if v.Locator.Name == locator.Name &&
+			labelsEqual(v.Locator.VolumeLabels, locator.VolumeLabels) {
+			return v.ID, true, nil
+		}
+	}
+	return api.BadVolumeID, false, nil
+}
+
+func labelsEqual(a, b api.Labels) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
 // NewDefaultEnumerator initializes store with specified kvdb.
 func NewDefaultEnumerator(driver string, kvdb kvdb.Kvdb) *DefaultEnumerator {
+	return NewNamespacedEnumerator("", driver, kvdb)
+}
+
+// NewNamespacedEnumerator initializes store with records kept under
+// namespace, such as a cluster ID, so that several clusters can share a kvdb.
+// An empty namespace is the same as NewDefaultEnumerator.
+func NewNamespacedEnumerator(namespace, driver string, kvdb kvdb.Kvdb) *DefaultEnumerator {
+	prefix := keyPrefix(namespace, driver)
 	return &DefaultEnumerator{
 		kvdb:          kvdb,
 		driver:        driver,
-		lockKeyPrefix: keyBase + driver + locks,
-		volKeyPrefix:  keyBase + driver + volumes,
-		snapKeyPrefix: keyBase + driver + snapshots,
+		lockKeyPrefix: prefix + locks,
+		volKeyPrefix:  prefix + volumes,
+		snapKeyPrefix: prefix + snapshots,
+		devKeyPrefix:  prefix + devices,
+		nameKeyPrefix: prefix + names,
+	}
+}
+
+func keyPrefix(namespace, driver string) string {
+	if namespace == "" {
+		return keyBase + driver
+	}
+	return keyBase + namespace + "/" + driver
+}
+
+// MigrateNamespace moves the records of driver written by an enumerator
+// without namespace under namespace. It returns the number of records moved.
+func MigrateNamespace(kv kvdb.Kvdb, namespace, driver string) (int, error) {
+	if namespace == "" {
+		return 0, nil
+	}
+	from := keyPrefix("", driver) + "/"
+	to := keyPrefix(namespace, driver) + "/"
+	kvps, err := kv.Enumerate(from)
+	if err != nil {
+		return 0, err
+	}
+	moved := 0
+	for _, kvp := range kvps {
+		key := strings.TrimPrefix(kvp.Key, "/")
+		// Skip held locks and records already under the new prefix.
+		if strings.HasSuffix(key, ".lock") ||
+			strings.HasPrefix(key, strings.TrimSuffix(from, "/")+locks) ||
+			strings.HasPrefix(key, to) {
+			continue
+		}
+		newKey := to + strings.TrimPrefix(key, from)
+		if _, err = kv.Create(newKey, json.RawMessage(kvp.Value), 0); err != nil {
+			return moved, fmt.Errorf("Failed to move %v to %v: %v", key, newKey, err)
+		}
+		if _, err = kv.Delete(key); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// MigrateNamespaceOnRequest calls MigrateNamespace for the NamespaceParam of
+// params if MigrateNamespaceParam is set to true. Drivers call it from their
+// InitFunc before their enumerator is used.
+func MigrateNamespaceOnRequest(kv kvdb.Kvdb, params DriverParams, driver string) error {
+	v, ok := params[MigrateNamespaceParam]
+	if !ok {
+		return nil
+	}
+	migrate, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("Invalid %s %q: %v", MigrateNamespaceParam, v, err)
+	}
+	ns := params[NamespaceParam]
+	if !migrate || ns == "" {
+		return nil
+	}
+	n, err := MigrateNamespace(kv, ns, driver)
+	if err != nil {
+		return err
 	}
+	log.Infof("Moved %d %v records to namespace %q", n, driver, ns)
+	return nil
 }
 
 // Lock volume specified by volID.
@@ -130,28 +278,85 @@ func (e *DefaultEnumerator) Unlock(token interface{}) error {
 
 // CreateVol returns error if volume with the same ID already existe.
 func (e *DefaultEnumerator) CreateVol(vol *api.Volume) error {
+	if err := e.CheckWritable(); err != nil {
+		return err
+	}
+	vol.SchemaVersion = SchemaVersion
 	_, err := e.kvdb.Create(e.volKey(vol.ID), vol, 0)
-	return err
+	if err != nil {
+		return err
+	}
+	return e.updateDevIndex(vol, "")
 }
 
 // GetVol from volID.
 func (e *DefaultEnumerator) GetVol(volID api.VolumeID) (*api.Volume, error) {
 	var v api.Volume
 	_, err := e.kvdb.GetVal(e.volKey(volID), &v)
-
+	if err == nil {
+		err = migrate(&v)
+	}
 	return &v, err
 }
 
+// GetVolByDevice returns the volume whose DevicePath is devicePath.
+// Errors ErrEnoEnt may be returned.
+func (e *DefaultEnumerator) GetVolByDevice(devicePath string) (*api.Volume, error) {
+	var idx deviceIndex
+	if _, err := e.kvdb.GetVal(e.devKey(devicePath), &idx); err != nil {
+		return nil, ErrEnoEnt
+	}
+	v, err := e.GetVol(idx.VolumeID)
+	if err != nil {
+		return nil, err
+	}
+	// The index is updated after the volume, guard against a stale entry.
+	if v.DevicePath != devicePath {
+		return nil, ErrEnoEnt
+	}
+	return v, nil
+}
+
 // UpdateVol with vol
 func (e *DefaultEnumerator) UpdateVol(vol *api.Volume) error {
-	_, err := e.kvdb.Put(e.volKey(vol.ID), vol, 0)
-	return err
+	if err := e.CheckWritable(); err != nil {
+		return err
+	}
+	vol.SchemaVersion = SchemaVersion
+	// The record is swapped with compare-and-set so that oldPath is the
+	// device path of the record replaced, even with concurrent updates.
+	var oldPath string
+	err := e.compareAndUpdate(vol.ID, func(v *api.Volume) (bool, error) {
+		oldPath = v.DevicePath
+		*v = *vol
+		return true, nil
+	})
+	if err == ErrEnoEnt {
+		oldPath = ""
+		_, err = e.kvdb.Put(e.volKey(vol.ID), vol, 0)
+	}
+	if err != nil {
+		return err
+	}
+	return e.updateDevIndex(vol, oldPath)
 }
 
 // DeleteVol. Returns error if volume does not exist.
 func (e *DefaultEnumerator) DeleteVol(volID api.VolumeID) error {
-	_, err := e.kvdb.Delete(e.volKey(volID))
-	return err
+	if err := e.CheckWritable(); err != nil {
+		return err
+	}
+	vol, err := e.GetVol(volID)
+	if err != nil {
+		return err
+	}
+	if _, err = e.kvdb.Delete(e.volKey(volID)); err != nil {
+		return err
+	}
+	if vol.DevicePath != "" {
+		e.kvdb.Delete(e.devKey(vol.DevicePath))
+	}
+	return nil
 }
 
 // GetSnap from snapID
@@ -164,18 +369,27 @@ func (e *DefaultEnumerator) GetSnap(snapID api.SnapID) (*api.VolumeSnap, error)
 
 // Update snap with snap
 func (e *DefaultEnumerator) UpdateSnap(snap *api.VolumeSnap) error {
+	if err := e.CheckWritable(); err != nil {
+		return err
+	}
 	_, err := e.kvdb.Put(e.snapKey(snap.ID), snap, 0)
 	return err
 }
 
 // CreateSnap with new snap
 func (e *DefaultEnumerator) CreateSnap(snap *api.VolumeSnap) error {
+	if err := e.CheckWritable(); err != nil {
+		return err
+	}
 	_, err := e.kvdb.Create(e.snapKey(snap.ID), snap, 0)
 	return err
 }
 
 // DeleteSnap with new snap
 func (e *DefaultEnumerator) DeleteSnap(snapID api.SnapID) error {
+	if err := e.CheckWritable(); err != nil {
+		return err
+	}
 	_, err := e.kvdb.Delete(e.snapKey(snapID))
 	return err
 }
@@ -199,6 +413,9 @@ func (e *DefaultEnumerator) Inspect(ids []api.VolumeID) ([]api.Volume, error) {
 
 // Enumerate volumes that map to the volumeLocator. Locator fields may be regexp.
 // If locator fields are left blank, this will return all volumee.
+// The volumes are read with a single kvdb range read, never key by key, so
+// the listing is as consistent as the backend's Enumerate: a point-in-time
+// view on etcd and the in-memory kvdb.
 func (e *DefaultEnumerator) Enumerate(locator api.VolumeLocator,
 	labels api.Labels) ([]api.Volume, error) {
 
@@ -213,13 +430,57 @@ func (e *DefaultEnumerator) Enumerate(locator api.VolumeLocator,
 		if err != nil {
 			return nil, err
 		}
-		if match(&elem, locator, labels) {
+		if err = migrate(&elem); err != nil {
+			return nil, err
+		}
+		if Match(&elem, locator, labels) {
 			vols = append(vols, elem)
 		}
 	}
 	return vols, nil
 }
 
+// SelectorMatch returns true if labels satisfy selector. A selector entry
+// with an empty value requires the label to be present, any other entry
+// requires the label to have that value.
+func SelectorMatch(labels api.Labels, selector api.Labels) bool {
+	for k, v := range selector {
+		lv, ok := labels[k]
+		if !ok || (v != "" && lv != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// EnumerateByLabel returns the volumes whose labels satisfy selector,
+// see SelectorMatch, grouped by the value of their groupBy label. Volumes
+// without a groupBy label are grouped under "".
+func (e *DefaultEnumerator) EnumerateByLabel(selector api.Labels,
+	groupBy string) (map[string][]api.Volume, error) {
+
+	kvp, err := e.kvdb.Enumerate(e.volKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string][]api.Volume)
+	for _, v := range kvp {
+		var elem api.Volume
+		if err = json.Unmarshal(v.Value, &elem); err != nil {
+			return nil, err
+		}
+		if err = migrate(&elem); err != nil {
+			return nil, err
+		}
+		if !SelectorMatch(elem.Locator.VolumeLabels, selector) {
+			continue
+		}
+		g := elem.Locator.VolumeLabels[groupBy]
+		groups[g] = append(groups[g], elem)
+	}
+	return groups, nil
+}
+
 // SnapInspect provides details on this snapshot.
 // Errors ErrEnoEnt may be returned
 func (e *DefaultEnumerator) SnapInspect(ids []api.SnapID) ([]api.VolumeSnap, error) {
@@ -1,7 +1,13 @@
 package volume
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -12,7 +18,7 @@ import (
 )
 
 var (
-	store    *Store
+	store    *DefaultEnumerator
 	volName  = "TestVolume"
 	snapName = "SnapVolume"
 	labels   = api.Labels{"Foo": "DEADBEEF"}
@@ -74,6 +80,12 @@ func TestEnumerate(t *testing.T) {
 	assert.Equal(t, len(vols), 0, "Number of volumes returned in enumerate should be 0")
 }
 
+func TestLockKey(t *testing.T) {
+	key := store.lockKey(api.VolumeID(volName))
+	assert.False(t, strings.HasPrefix(key, store.volKeyPrefix),
+		"Locks must not be enumerated as volumes")
+}
+
 func TestSnapInspect(t *testing.T) {
 	snapID := api.SnapID(snapName)
 	id := api.VolumeID(volName)
@@ -94,10 +106,63 @@ func TestSnapInspect(t *testing.T) {
 
 	err = store.DeleteSnap(snapID)
 	assert.NoError(t, err, "Failed in Delete")
-	snaps, err = store.SnapEnumerate(api.VolumeLocator{Name: volName}, nil)
+	snaps, err = store.SnapEnumerate([]api.VolumeID{id}, nil)
 	assert.Equal(t, len(snaps), 0, "Number of snaps returned in enumerate should be 1")
 }
 
+func TestGetVolByDevice(t *testing.T) {
+	vol := api.Volume{ID: "devvol", DevicePath: "/dev/devvol", Spec: &api.VolumeSpec{}}
+	err := store.CreateVol(&vol)
+	assert.NoError(t, err, "Failed in CreateVol")
+	v, err := store.GetVolByDevice("/dev/devvol")
+	assert.NoError(t, err, "Failed in GetVolByDevice")
+	assert.Equal(t, vol.ID, v.ID)
+
+	vol.DevicePath = "/dev/other"
+	err = store.UpdateVol(&vol)
+	assert.NoError(t, err, "Failed in UpdateVol")
+	_, err = store.GetVolByDevice("/dev/devvol")
+	assert.Equal(t, ErrEnoEnt, err, "Old device path should be unindexed")
+	_, err = store.GetVolByDevice("/dev/other")
+	assert.NoError(t, err, "New device path should be indexed")
+
+	err = store.DeleteVol(vol.ID)
+	assert.NoError(t, err, "Failed in DeleteVol")
+	_, err = store.GetVolByDevice("/dev/other")
+	assert.Error(t, err, "Deleted volume should be unindexed")
+}
+
+func TestUpdateVolConcurrent(t *testing.T) {
+	vol := api.Volume{ID: "casvol", DevicePath: "/dev/cas", Spec: &api.VolumeSpec{}}
+	assert.NoError(t, store.CreateVol(&vol), "Failed in CreateVol")
+	defer store.DeleteVol(vol.ID)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v := vol
+			v.DevicePath = fmt.Sprintf("/dev/cas%d", i)
+			store.UpdateVol(&v)
+		}(i)
+	}
+	wg.Wait()
+
+	final, err := store.GetVol(vol.ID)
+	assert.NoError(t, err, "Failed in GetVol")
+	v, err := store.GetVolByDevice(final.DevicePath)
+	assert.NoError(t, err, "Current device path should be indexed")
+	assert.Equal(t, vol.ID, v.ID)
+	for i := 0; i < 8; i++ {
+		p := fmt.Sprintf("/dev/cas%d", i)
+		if p != final.DevicePath {
+			_, err = store.GetVolByDevice(p)
+			assert.Equal(t, ErrEnoEnt, err, "Stale device path %v", p)
+		}
+	}
+}
+
 func TestSnapEnumerate(t *testing.T) {
 	snapID := api.SnapID(snapName)
 	id := api.VolumeID(volName)
@@ -117,27 +182,27 @@ func TestSnapEnumerate(t *testing.T) {
 	err = store.CreateSnap(&snap)
 	assert.NoError(t, err, "Failed in CreateSnap")
 
-	snaps, err := store.SnapEnumerate(api.VolumeLocator{Name: volName}, nil)
+	snaps, err := store.SnapEnumerate([]api.VolumeID{id}, nil)
 	assert.NoError(t, err, "Failed in Enumerate")
 	assert.Equal(t, len(snaps), 1, "Number of snaps returned in enumerate should be 1")
 	if len(snaps) == 1 {
 		assert.Equal(t, snaps[0].ID, snap.ID, "Invalid snap returned in Enumerate")
 	}
-	snaps, err = store.SnapEnumerate(api.VolumeLocator{VolumeLabels: labels}, nil)
+	snaps, err = store.SnapEnumerate([]api.VolumeID{id}, labels)
 	assert.NoError(t, err, "Failed in Enumerate")
 	assert.Equal(t, len(snaps), 1, "Number of snaps returned in enumerate should be 1")
 	if len(snaps) == 1 {
 		assert.Equal(t, snaps[0].ID, snap.ID, "Invalid snap returned in Enumerate")
 	}
 
-	snaps, err = store.SnapEnumerate(api.VolumeLocator{}, labels)
+	snaps, err = store.SnapEnumerate(nil, labels)
 	assert.NoError(t, err, "Failed in Enumerate")
 	assert.True(t, len(snaps) >= 1, "Number of snaps returned in enumerate should be at least 1")
 	if len(snaps) == 1 {
 		assert.Equal(t, snaps[0].ID, snap.ID, "Invalid snap returned in Enumerate")
 	}
 
-	snaps, err = store.SnapEnumerate(api.VolumeLocator{}, nil)
+	snaps, err = store.SnapEnumerate(nil, nil)
 	assert.NoError(t, err, "Failed in Enumerate")
 	assert.True(t, len(snaps) >= 1, "Number of snaps returned in enumerate should be at least 1")
 	if len(snaps) == 1 {
@@ -146,7 +211,7 @@ func TestSnapEnumerate(t *testing.T) {
 
 	err = store.DeleteSnap(snapID)
 	assert.NoError(t, err, "Failed in Delete")
-	snaps, err = store.SnapEnumerate(api.VolumeLocator{Name: volName}, nil)
+	snaps, err = store.SnapEnumerate([]api.VolumeID{id}, nil)
 	assert.NotNil(t, snaps, "Inspect returned nil snaps")
 	assert.Equal(t, len(snaps), 0, "Number of snaps returned in enumerate should be 0")
 
@@ -154,6 +219,414 @@ func TestSnapEnumerate(t *testing.T) {
 	assert.NoError(t, err, "Failed in Delete")
 }
 
+func TestSchemaMigration(t *testing.T) {
+	id := api.VolumeID("v1volume")
+	// A version 1 record carries no SchemaVersion and may have no Spec.
+	v1 := map[string]interface{}{"ID": id, "Locator": api.VolumeLocator{Name: "v1"}}
+	_, err := store.kvdb.Put(store.volKey(id), v1, 0)
+	assert.NoError(t, err, "Failed to write v1 record")
+
+	vol, err := store.GetVol(id)
+	assert.NoError(t, err, "Failed in GetVol")
+	assert.Equal(t, SchemaVersion, vol.SchemaVersion, "Record should be upgraded")
+	assert.NotNil(t, vol.Spec, "Migration should set Spec")
+
+	err = store.UpdateVol(vol)
+	assert.NoError(t, err, "Failed in UpdateVol")
+	var stored api.Volume
+	_, err = store.kvdb.GetVal(store.volKey(id), &stored)
+	assert.NoError(t, err, "Failed to read record")
+	assert.Equal(t, SchemaVersion, stored.SchemaVersion, "Upgrade should be persisted")
+
+	err = store.DeleteVol(id)
+	assert.NoError(t, err, "Failed in Delete")
+}
+
+func TestMigrateNamespace(t *testing.T) {
+	driver := "namespace_test"
+	old := NewDefaultEnumerator(driver, store.kvdb)
+	vol := api.Volume{ID: "nsvolume", Spec: &api.VolumeSpec{}}
+	err := old.CreateVol(&vol)
+	assert.NoError(t, err, "Failed in CreateVol")
+
+	n, err := MigrateNamespace(store.kvdb, "cluster1", driver)
+	assert.NoError(t, err, "Failed in MigrateNamespace")
+	assert.Equal(t, 1, n, "Number of records moved")
+
+	_, err = old.GetVol(vol.ID)
+	assert.Error(t, err, "Record should be gone from the old prefix")
+	ns := NewNamespacedEnumerator("cluster1", driver, store.kvdb)
+	v, err := ns.GetVol(vol.ID)
+	assert.NoError(t, err, "Failed in GetVol")
+	assert.Equal(t, vol.ID, v.ID)
+	other := NewNamespacedEnumerator("cluster2", driver, store.kvdb)
+	_, err = other.GetVol(vol.ID)
+	assert.Error(t, err, "Namespaces should be isolated")
+
+	err = ns.DeleteVol(vol.ID)
+	assert.NoError(t, err, "Failed in Delete")
+}
+
+func TestMigrateNamespaceOnRequest(t *testing.T) {
+	driver := "namespace_request_test"
+	old := NewDefaultEnumerator(driver, store.kvdb)
+	vol := api.Volume{ID: "nsrequest", Spec: &api.VolumeSpec{}}
+	err := old.CreateVol(&vol)
+	assert.NoError(t, err, "Failed in CreateVol")
+	defer old.DeleteVol(vol.ID)
+
+	params := DriverParams{NamespaceParam: "cluster1"}
+	err = MigrateNamespaceOnRequest(store.kvdb, params, driver)
+	assert.NoError(t, err, "Failed in MigrateNamespaceOnRequest")
+	_, err = old.GetVol(vol.ID)
+	assert.NoError(t, err, "Records should only move on request")
+
+	params[MigrateNamespaceParam] = "yes please"
+	err = MigrateNamespaceOnRequest(store.kvdb, params, driver)
+	assert.Error(t, err, "Invalid boolean should be rejected")
+
+	params[MigrateNamespaceParam] = "true"
+	err = MigrateNamespaceOnRequest(store.kvdb, params, driver)
+	assert.NoError(t, err, "Failed in MigrateNamespaceOnRequest")
+	ns := NewNamespacedEnumerator("cluster1", driver, store.kvdb)
+	_, err = ns.GetVol(vol.ID)
+	assert.NoError(t, err, "Record should be in the namespace")
+	ns.DeleteVol(vol.ID)
+}
+
+func TestEnumerateByLabel(t *testing.T) {
+	vols := []api.Volume{
+		{ID: "db1", Locator: api.VolumeLocator{VolumeLabels: api.Labels{"app": "db", "node": "n1"}}},
+		{ID: "db2", Locator: api.VolumeLocator{VolumeLabels: api.Labels{"app": "db", "node": "n2"}}},
+		{ID: "db3", Locator: api.VolumeLocator{VolumeLabels: api.Labels{"app": "db", "node": "n1", "tier": "ssd"}}},
+		{ID: "web", Locator: api.VolumeLocator{VolumeLabels: api.Labels{"app": "web", "node": "n1", "tier": "ssd"}}},
+		{ID: "orphan", Locator: api.VolumeLocator{VolumeLabels: api.Labels{"app": "db"}}},
+	}
+	for i := range vols {
+		vols[i].Spec = &api.VolumeSpec{}
+		err := store.CreateVol(&vols[i])
+		assert.NoError(t, err, "Failed in CreateVol")
+	}
+
+	groups, err := store.EnumerateByLabel(api.Labels{"app": "db"}, "node")
+	assert.NoError(t, err, "Failed in EnumerateByLabel")
+	assert.Equal(t, 3, len(groups), "Number of groups")
+	assert.Equal(t, 2, len(groups["n1"]), "Volumes on n1")
+	assert.Equal(t, 1, len(groups["n2"]), "Volumes on n2")
+	assert.Equal(t, 1, len(groups[""]), "Volumes without a node label")
+
+	// Presence of tier matches both apps.
+	groups, err = store.EnumerateByLabel(api.Labels{"tier": ""}, "app")
+	assert.NoError(t, err, "Failed in EnumerateByLabel")
+	assert.Equal(t, 1, len(groups["db"]), "db volumes with a tier")
+	assert.Equal(t, 1, len(groups["web"]), "web volumes with a tier")
+
+	groups, err = store.EnumerateByLabel(api.Labels{"app": "db", "tier": "hdd"}, "node")
+	assert.NoError(t, err, "Failed in EnumerateByLabel")
+	assert.Equal(t, 0, len(groups), "No volume should match")
+
+	for _, v := range vols {
+		err = store.DeleteVol(v.ID)
+		assert.NoError(t, err, "Failed in Delete")
+	}
+}
+
+func TestVolumeExists(t *testing.T) {
+	vol := api.Volume{
+		ID:      "existing",
+		Locator: api.VolumeLocator{Name: "claim", VolumeLabels: api.Labels{"app": "db"}},
+		Spec:    &api.VolumeSpec{},
+	}
+	err := store.CreateVol(&vol)
+	assert.NoError(t, err, "Failed in CreateVol")
+
+	id, ok, err := VolumeExists(store, vol.Locator)
+	assert.NoError(t, err, "Failed in VolumeExists")
+	assert.True(t, ok, "Volume should exist")
+	assert.Equal(t, vol.ID, id, "Existing volume ID")
+
+	// A subset or superset of the labels is a different volume.
+	_, ok, err = VolumeExists(store, api.VolumeLocator{Name: "claim"})
+	assert.NoError(t, err, "Failed in VolumeExists")
+	assert.False(t, ok, "Volume without labels should not match")
+	_, ok, err = VolumeExists(store, api.VolumeLocator{Name: "claim",
+		VolumeLabels: api.Labels{"app": "db", "tier": "ssd"}})
+	assert.NoError(t, err, "Failed in VolumeExists")
+	assert.False(t, ok, "Volume with extra labels should not match")
+
+	err = store.DeleteVol(vol.ID)
+	assert.NoError(t, err, "Failed in Delete")
+}
+
+func TestTopBySize(t *testing.T) {
+	vols := []api.Volume{
+		{ID: "small", Spec: &api.VolumeSpec{Size: 1}},
+		{ID: "large-b", Spec: &api.VolumeSpec{Size: 3}},
+		{ID: "large-a", Spec: &api.VolumeSpec{Size: 3}},
+		{ID: "medium", Spec: &api.VolumeSpec{Size: 2}},
+	}
+	for i := range vols {
+		err := store.CreateVol(&vols[i])
+		assert.NoError(t, err, "Failed in CreateVol")
+	}
+
+	top, err := TopBySize(store, 3)
+	assert.NoError(t, err, "Failed in TopBySize")
+	ids := []api.VolumeID{}
+	for _, v := range top {
+		ids = append(ids, v.ID)
+	}
+	// Ties are ordered by ID.
+	assert.Equal(t, []api.VolumeID{"large-a", "large-b", "medium"}, ids, "Largest volumes")
+
+	for _, v := range vols {
+		err = store.DeleteVol(v.ID)
+		assert.NoError(t, err, "Failed in Delete")
+	}
+}
+
+// statsStore measures usage from a fixed table.
+type statsStore struct {
+	*DefaultEnumerator
+	used map[api.VolumeID]uint64
+}
+
+func (s *statsStore) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
+	used, ok := s.used[volumeID]
+	if !ok {
+		return api.VolumeStats{}, ErrNotSupported
+	}
+	return api.VolumeStats{LogicalBytes: used, PhysicalBytes: used}, nil
+}
+
+func TestSortByUsage(t *testing.T) {
+	vols := []api.Volume{
+		{ID: "big-idle", Spec: &api.VolumeSpec{Size: 100}},
+		{ID: "small-full", Spec: &api.VolumeSpec{Size: 10}},
+		{ID: "recorded", Spec: &api.VolumeSpec{Size: 1}, Usage: 5},
+	}
+	for i := range vols {
+		err := store.CreateVol(&vols[i])
+		assert.NoError(t, err, "Failed in CreateVol")
+		defer store.DeleteVol(vols[i].ID)
+	}
+
+	_, err := EnumerateSorted(store, api.VolumeLocator{}, nil,
+		EnumerateOptions{SortBy: SortBySize, Usage: true})
+	assert.Equal(t, ErrNotSupported, err, "Usage needs Stats")
+
+	s := &statsStore{store, map[api.VolumeID]uint64{"big-idle": 1, "small-full": 10}}
+	sorted, err := EnumerateSorted(s, api.VolumeLocator{}, nil,
+		EnumerateOptions{SortBy: SortBySize, Usage: true})
+	assert.NoError(t, err, "Failed in EnumerateSorted")
+	ids := []api.VolumeID{}
+	for _, v := range sorted {
+		ids = append(ids, v.ID)
+	}
+	assert.Equal(t, []api.VolumeID{"small-full", "recorded", "big-idle"}, ids, "Volumes by usage")
+}
+
+func TestClaimVolume(t *testing.T) {
+	vol := api.Volume{ID: "claimed", Spec: &api.VolumeSpec{}}
+	err := store.CreateVol(&vol)
+	assert.NoError(t, err, "Failed in CreateVol")
+
+	err = store.ClaimVolume(vol.ID, "node1")
+	assert.NoError(t, err, "Failed in ClaimVolume")
+	err = store.ClaimVolume(vol.ID, "node1")
+	assert.NoError(t, err, "Claim by the holder should succeed")
+	err = store.ClaimVolume(vol.ID, "node2")
+	assert.Equal(t, ErrVolumeAttachedElsewhere, err, "Claim by another node")
+	err = store.ReleaseVolume(vol.ID, "node2")
+	assert.Equal(t, ErrVolumeAttachedElsewhere, err, "Release by another node")
+
+	err = store.ReleaseVolume(vol.ID, "node1")
+	assert.NoError(t, err, "Failed in ReleaseVolume")
+	err = store.ClaimVolume(vol.ID, "node2")
+	assert.NoError(t, err, "Claim after release")
+
+	err = store.DeleteVol(vol.ID)
+	assert.NoError(t, err, "Failed in Delete")
+}
+
+func TestWaitForState(t *testing.T) {
+	waitPollInterval = time.Millisecond
+	vol := api.Volume{ID: "waiting", State: api.VolumePending, Spec: &api.VolumeSpec{}}
+	err := store.CreateVol(&vol)
+	assert.NoError(t, err, "Failed in CreateVol")
+
+	err = WaitForState(context.Background(), store, vol.ID, api.VolumeAttached, 10*time.Millisecond)
+	terr, ok := err.(*StateTimeoutError)
+	assert.True(t, ok, "Expected a timeout")
+	if ok {
+		assert.Equal(t, api.VolumePending, terr.Last, "Last state")
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		vol.State = api.VolumeAttached
+		store.UpdateVol(&vol)
+	}()
+	err = WaitForState(context.Background(), store, vol.ID, api.VolumeAttached, time.Second)
+	assert.NoError(t, err, "Failed in WaitForState")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = WaitForState(ctx, store, vol.ID, api.VolumeDetached, time.Second)
+	assert.Equal(t, context.Canceled, err, "Canceled wait")
+
+	err = store.DeleteVol(vol.ID)
+	assert.NoError(t, err, "Failed in Delete")
+}
+
+func TestEnumerateConsistent(t *testing.T) {
+	e := NewDefaultEnumerator("enumerate_consistent", kvdb.Instance())
+	stable := []api.VolumeID{"stable-1", "stable-2", "stable-3"}
+	for _, id := range stable {
+		err := e.CreateVol(&api.Volume{ID: id, Spec: &api.VolumeSpec{}})
+		assert.NoError(t, err, "Failed in CreateVol")
+	}
+
+	done := make(chan struct{})
+	churned := make(chan struct{})
+	go func() {
+		defer close(churned)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			id := api.VolumeID(fmt.Sprintf("churn-%d", i%4))
+			e.CreateVol(&api.Volume{ID: id, Spec: &api.VolumeSpec{}})
+			e.DeleteVol(id)
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		vols, err := e.Enumerate(api.VolumeLocator{}, nil)
+		assert.NoError(t, err, "Failed in Enumerate")
+		seen := make(map[api.VolumeID]bool)
+		for _, v := range vols {
+			assert.False(t, seen[v.ID], "Volume %v listed twice", v.ID)
+			seen[v.ID] = true
+		}
+		for _, id := range stable {
+			assert.True(t, seen[id], "Volume %v missing", id)
+		}
+	}
+	close(done)
+	<-churned
+
+	for _, id := range stable {
+		assert.NoError(t, e.DeleteVol(id), "Failed in Delete")
+	}
+}
+
+func TestRename(t *testing.T) {
+	a := api.Volume{ID: "rename-a", Locator: api.VolumeLocator{Name: "a"}, Spec: &api.VolumeSpec{}}
+	b := api.Volume{ID: "rename-b", Locator: api.VolumeLocator{Name: "b"}, Spec: &api.VolumeSpec{}}
+	assert.NoError(t, store.CreateVol(&a), "Failed in CreateVol")
+	assert.NoError(t, store.CreateVol(&b), "Failed in CreateVol")
+
+	assert.NoError(t, store.Rename(a.ID, "c"), "Failed in Rename")
+	v, err := store.GetVol(a.ID)
+	assert.NoError(t, err, "Failed in GetVol")
+	assert.Equal(t, "c", v.Locator.Name, "Renamed volume")
+
+	assert.Error(t, store.Rename(a.ID, "b"), "Rename to an existing name")
+	assert.Error(t, store.Rename(a.ID, "-bad"), "Rename to an invalid name")
+	assert.NoError(t, store.Rename(a.ID, "c"), "Rename to the current name")
+
+	assert.NoError(t, store.DeleteVol(a.ID), "Failed in Delete")
+	assert.NoError(t, store.DeleteVol(b.ID), "Failed in Delete")
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	vol := api.Volume{ID: "rovolume", Spec: &api.VolumeSpec{}}
+	err := store.CreateVol(&vol)
+	assert.NoError(t, err, "Failed in CreateVol")
+
+	store.SetReadOnly(true)
+	err = store.UpdateVol(&vol)
+	assert.Equal(t, ErrReadOnlyMode, err, "UpdateVol in read-only mode")
+	err = store.DeleteVol(vol.ID)
+	assert.Equal(t, ErrReadOnlyMode, err, "DeleteVol in read-only mode")
+	_, err = store.GetVol(vol.ID)
+	assert.NoError(t, err, "Reads should work in read-only mode")
+	err = store.CheckMount(nil)
+	assert.Equal(t, ErrReadOnlyMode, err, "Mount in read-only mode")
+	err = store.CheckMount(&api.MountOptions{ReadOnly: true})
+	assert.NoError(t, err, "Read-only mounts should work in read-only mode")
+
+	store.SetReadOnly(false)
+	err = store.DeleteVol(vol.ID)
+	assert.NoError(t, err, "Failed in Delete")
+}
+
+func TestManifest(t *testing.T) {
+	vol := api.Volume{ID: "manifest", Locator: api.VolumeLocator{Name: "manifest"},
+		Spec: &api.VolumeSpec{Size: 1}, DevicePath: "/dev/manifest"}
+	// The device node of an attached volume does not survive a restore.
+	attached := api.Volume{ID: "manifest-attached", Locator: api.VolumeLocator{Name: "manifest-attached"},
+		Spec: &api.VolumeSpec{Size: 1}, DevicePath: "/dev/null", AttachPath: "/manifest/mnt",
+		AttachedOn: "node", State: api.VolumeAttached}
+	snap := api.VolumeSnap{ID: "manifest-snap", VolumeID: vol.ID}
+	assert.NoError(t, store.CreateVol(&vol), "Failed in CreateVol")
+	defer store.DeleteVol(vol.ID)
+	assert.NoError(t, store.CreateVol(&attached), "Failed in CreateVol")
+	defer store.DeleteVol(attached.ID)
+	assert.NoError(t, store.CreateSnap(&snap), "Failed in CreateSnap")
+	defer store.DeleteSnap(snap.ID)
+
+	data, err := store.ExportManifest()
+	assert.NoError(t, err, "Failed in ExportManifest")
+
+	// A namespace stands in for a fresh kvdb.
+	restore := NewNamespacedEnumerator("restore", "enumerator_test", store.kvdb)
+	err = restore.ImportManifest(data, ImportManifestOptions{DryRun: true})
+	assert.NoError(t, err, "Failed in dry run")
+	_, err = restore.GetVol(vol.ID)
+	assert.Error(t, err, "Dry run should not write records")
+
+	err = restore.ImportManifest(data, ImportManifestOptions{})
+	assert.NoError(t, err, "Failed in ImportManifest")
+	defer restore.DeleteVol(vol.ID)
+	defer restore.DeleteVol(attached.ID)
+	defer restore.DeleteSnap(snap.ID)
+	v, err := restore.GetVolByDevice(vol.DevicePath)
+	assert.NoError(t, err, "Device index should be rebuilt")
+	assert.Equal(t, vol.Locator.Name, v.Locator.Name)
+	v, err = restore.GetVol(attached.ID)
+	assert.NoError(t, err, "Failed in GetVol")
+	assert.Equal(t, "", v.DevicePath, "Device node should be cleared")
+	assert.Equal(t, "", v.AttachPath, "Stale mount should be cleared")
+	assert.Equal(t, api.MachineID(""), v.AttachedOn)
+	assert.Equal(t, api.VolumeAvailable, v.State)
+	snaps, err := restore.SnapEnumerate([]api.VolumeID{vol.ID}, nil)
+	assert.NoError(t, err, "Failed in SnapEnumerate")
+	assert.Equal(t, 1, len(snaps), "Snapshots should be imported")
+
+	err = restore.ImportManifest(data, ImportManifestOptions{})
+	assert.Error(t, err, "Existing records should fail the import by default")
+	err = restore.ImportManifest(data, ImportManifestOptions{OnConflict: ConflictSkip})
+	assert.NoError(t, err, "Existing records should be skipped")
+
+	other := NewDefaultEnumerator("other_driver", store.kvdb)
+	err = other.ImportManifest(data, ImportManifestOptions{DryRun: true})
+	assert.Error(t, err, "Manifests are specific to a driver")
+
+	orphan, err := json.Marshal(&Manifest{
+		Version:   ManifestVersion,
+		Driver:    "enumerator_test",
+		Snapshots: []api.VolumeSnap{{ID: "orphan-snap", VolumeID: "orphan"}},
+	})
+	assert.NoError(t, err)
+	err = NewNamespacedEnumerator("orphan", "enumerator_test", store.kvdb).
+		ImportManifest(orphan, ImportManifestOptions{DryRun: true})
+	assert.Error(t, err, "Snapshots of volumes not in the manifest should be rejected")
+}
+
 func init() {
 	kv, err := kvdb.New(mem.Name, "driver_test", []string{}, nil)
 	if err != nil {
@@ -164,5 +637,5 @@ func init() {
 		log.Panicf("Failed to set KVDB instance")
 	}
 
-	store = NewStore("enumerator_test", kv)
+	store = NewDefaultEnumerator("enumerator_test", kv)
 }
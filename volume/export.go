@@ -0,0 +1,179 @@
+package volume
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// ExportVersion of the stream written by ExportSnapshot.
+const ExportVersion = 1
+
+// ExportMetadata describes the volume a snapshot export was taken from. It
+// is written as a single JSON line ahead of a tar stream of the contents.
+type ExportMetadata struct {
+	Version    int
+	SnapID     api.SnapID
+	Ctime      time.Time
+	SnapLabels api.Labels
+	Locator    api.VolumeLocator
+	Spec       *api.VolumeSpec
+}
+
+// snapSource returns the volume snapID was taken of and the snapshot
+// record, if the driver keeps one.
+func snapSource(d VolumeDriver, snapID api.SnapID) (*api.Volume, *api.VolumeSnap, error) {
+	var snap *api.VolumeSnap
+	volID := api.VolumeID(snapID)
+	if snaps, err := d.SnapInspect([]api.SnapID{snapID}); err == nil && len(snaps) == 1 {
+		snap = &snaps[0]
+		volID = snap.VolumeID
+	}
+	vols, err := d.Inspect([]api.VolumeID{volID})
+	if err != nil || len(vols) != 1 {
+		return nil, nil, ErrSnapNotFound
+	}
+	return &vols[0], snap, nil
+}
+
+// mountSnap mounts snapID read-only at dir, either through the driver's
+// SnapMounter or, for drivers whose snapshots are volumes, as a volume.
+// It returns the function that undoes the mount.
+func mountSnap(d VolumeDriver, snapID api.SnapID, snap *api.VolumeSnap, dir string) (func(), error) {
+	if m, ok := Unwrap(d).(SnapMounter); ok && snap != nil {
+		if err := m.MountSnap(snapID, dir); err != nil {
+			return nil, err
+		}
+		return func() { m.UnmountSnap(snapID, dir) }, nil
+	}
+	id := api.VolumeID(snapID)
+	if err := d.Mount(id, dir, &api.MountOptions{ReadOnly: true}); err != nil {
+		return nil, err
+	}
+	return func() { d.Unmount(id, dir) }, nil
+}
+
+func tarCmd(stdin io.Reader, stdout io.Writer, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("tar", args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("tar %v failed: %v: %s", args, err, stderr.String())
+	}
+	return nil
+}
+
+// ExportSnapshot returns a driver independent stream of snapID on d that
+// ImportSnapshot can restore on any driver.
+func ExportSnapshot(d VolumeDriver, snapID api.SnapID) (io.ReadCloser, error) {
+	vol, snap, err := snapSource(d, snapID)
+	if err != nil {
+		return nil, err
+	}
+	meta := ExportMetadata{
+		Version: ExportVersion,
+		SnapID:  snapID,
+		Ctime:   vol.Ctime,
+		Locator: vol.Locator,
+		Spec:    vol.Spec,
+	}
+	if snap != nil {
+		meta.Ctime = snap.Ctime
+		meta.SnapLabels = snap.SnapLabels
+	}
+
+	dir, err := ioutil.TempDir("", "osd-export")
+	if err != nil {
+		return nil, err
+	}
+	unmount, err := mountSnap(d, snapID, snap, dir)
+	if err != nil {
+		os.Remove(dir)
+		return nil, err
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		defer os.Remove(dir)
+		defer unmount()
+		err := json.NewEncoder(w).Encode(&meta)
+		if err == nil {
+			err = tarCmd(nil, w, "-c", "-C", dir, ".")
+		}
+		w.CloseWithError(err)
+	}()
+	return r, nil
+}
+
+// ImportSnapshot creates a volume on targetDriver from a stream written by
+// ExportSnapshot. The volume gets the original locator and spec, with the
+// name made unique and the format changed if the target does not support it.
+func ImportSnapshot(src io.Reader, targetDriver string) (api.VolumeID, error) {
+	d, err := Get(targetDriver)
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+	br := bufio.NewReader(src)
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return api.BadVolumeID, fmt.Errorf("Failed to read export metadata: %v", err)
+	}
+	var meta ExportMetadata
+	if err = json.Unmarshal(line, &meta); err != nil {
+		return api.BadVolumeID, fmt.Errorf("Failed to parse export metadata: %v", err)
+	}
+	if meta.Version > ExportVersion {
+		return api.BadVolumeID, fmt.Errorf("Export version %v is newer than %v",
+			meta.Version, ExportVersion)
+	}
+
+	spec := api.VolumeSpec{}
+	if meta.Spec != nil {
+		spec = *meta.Spec
+	}
+	if ValidateFormat(d, spec.Format) != nil {
+		if fs := SupportedFilesystems(d); len(fs) > 0 {
+			spec.Format = fs[0]
+		}
+	}
+	locator := meta.Locator
+	if locator.Name != "" {
+		name, release, err := UniqueName(d, locator.Name, time.Now())
+		if err != nil {
+			return api.BadVolumeID, err
+		}
+		defer release()
+		locator.Name = name
+	}
+	id, err := d.Create(locator, &api.CreateOptions{}, &spec)
+	if err != nil {
+		return api.BadVolumeID, err
+	}
+
+	dir, err := ioutil.TempDir("", "osd-import")
+	if err == nil {
+		defer os.Remove(dir)
+		err = d.Mount(id, dir, nil)
+	}
+	if err == nil {
+		err = tarCmd(br, nil, "-x", "-C", dir)
+		if uerr := d.Unmount(id, dir); err == nil {
+			err = uerr
+		}
+	}
+	if err != nil {
+		d.Delete(id)
+		return api.BadVolumeID, err
+	}
+	return id, nil
+}
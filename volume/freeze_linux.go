@@ -0,0 +1,129 @@
+package volume
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// DefaultFreezeTimeout after which a Freezer thaws a filesystem that was not
+// thawed by its caller.
+const DefaultFreezeTimeout = 30 * time.Second
+
+const (
+	ioctlFifreeze = 0xC0045877
+	ioctlFithaw   = 0xC0045878
+)
+
+type frozenFs struct {
+	path  string
+	timer *time.Timer
+}
+
+// Freezer freezes the filesystems of volumes as fsfreeze does. A frozen
+// filesystem is thawed by Thaw or once Timeout expires, so that a caller
+// that dies while holding it does not block IO forever.
+type Freezer struct {
+	sync.Mutex
+	Timeout time.Duration
+	frozen  map[api.VolumeID]*frozenFs
+}
+
+// NewFreezer returns a Freezer that thaws after timeout.
+func NewFreezer(timeout time.Duration) *Freezer {
+	return &Freezer{Timeout: timeout, frozen: make(map[api.VolumeID]*frozenFs)}
+}
+
+func fsIoctl(path string, req uintptr) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Freeze the filesystem mounted at path for volumeID. ErrNotSupported is
+// returned if the filesystem cannot be frozen.
+func (f *Freezer) Freeze(volumeID api.VolumeID, path string) error {
+	f.Lock()
+	defer f.Unlock()
+	if _, ok := f.frozen[volumeID]; ok {
+		return fmt.Errorf("Volume %v is already quiesced", volumeID)
+	}
+	if err := fsIoctl(path, ioctlFifreeze); err != nil {
+		if err == syscall.EOPNOTSUPP || err == syscall.ENOTTY {
+			return ErrNotSupported
+		}
+		return fmt.Errorf("Failed to freeze %v: %v", path, err)
+	}
+	fs := &frozenFs{path: path}
+	fs.timer = time.AfterFunc(f.Timeout, func() { f.expire(volumeID, fs) })
+	f.frozen[volumeID] = fs
+	log.Infof("Quiesced volume %v at %v", volumeID, path)
+	return nil
+}
+
+func (f *Freezer) expire(volumeID api.VolumeID, fs *frozenFs) {
+	f.Lock()
+	defer f.Unlock()
+	if f.frozen[volumeID] != fs {
+		return
+	}
+	delete(f.frozen, volumeID)
+	log.Warnf("Volume %v quiesced for more than %v, thawing %v", volumeID, f.Timeout, fs.path)
+	if err := fsIoctl(fs.path, ioctlFithaw); err != nil && err != syscall.EINVAL {
+		log.Warnf("Failed to thaw %v: %v", fs.path, err)
+	}
+}
+
+// Thaw the filesystem of volumeID. It is not an error if the volume is not
+// frozen, such as after the timeout expired.
+func (f *Freezer) Thaw(volumeID api.VolumeID) error {
+	f.Lock()
+	defer f.Unlock()
+	fs, ok := f.frozen[volumeID]
+	if !ok {
+		return nil
+	}
+	fs.timer.Stop()
+	delete(f.frozen, volumeID)
+	// EINVAL if it was thawed behind our back.
+	if err := fsIoctl(fs.path, ioctlFithaw); err != nil && err != syscall.EINVAL {
+		return fmt.Errorf("Failed to thaw %v: %v", fs.path, err)
+	}
+	log.Infof("Unquiesced volume %v at %v", volumeID, fs.path)
+	return nil
+}
+
+// Frozen returns true if the filesystem of volumeID is frozen.
+func (f *Freezer) Frozen(volumeID api.VolumeID) bool {
+	f.Lock()
+	defer f.Unlock()
+	_, ok := f.frozen[volumeID]
+	return ok
+}
+
+// ThawAll thaws every frozen filesystem.
+func (f *Freezer) ThawAll() {
+	f.Lock()
+	ids := make([]api.VolumeID, 0, len(f.frozen))
+	for id := range f.frozen {
+		ids = append(ids, id)
+	}
+	f.Unlock()
+	for _, id := range ids {
+		if err := f.Thaw(id); err != nil {
+			log.Warn(err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package volume
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"syscall"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// fsckCommand returns the command that checks, or repairs, format on
+// device.
+func fsckCommand(format api.Filesystem, device string, repair bool) (*exec.Cmd, error) {
+	switch format {
+	case api.FsExt4:
+		if repair {
+			return exec.Command("e2fsck", "-f", "-y", device), nil
+		}
+		return exec.Command("e2fsck", "-f", "-n", device), nil
+	case api.FsXfs:
+		if repair {
+			return exec.Command("xfs_repair", device), nil
+		}
+		return exec.Command("xfs_repair", "-n", device), nil
+	case api.FsBtrfs:
+		if repair {
+			return exec.Command("btrfs", "check", "--repair", device), nil
+		}
+		return exec.Command("btrfs", "check", "--readonly", device), nil
+	}
+	return nil, fmt.Errorf("Cannot check %v filesystems", format)
+}
+
+// Fsck checks the filesystem of the given format on device, which must not
+// be mounted, and repairs it if repair is set.
+func Fsck(format api.Filesystem, device string, repair bool) (api.FsckResult, error) {
+	if format == api.FsExt4 {
+		return runFsck(format, device, repair)
+	}
+	// xfs_repair and btrfs check --repair exit 0 whether or not they fixed
+	// anything, so errors are found by a check first and only repaired if
+	// there are any.
+	result, err := runFsck(format, device, false)
+	if err != nil || !result.ErrorsFound || !repair {
+		return result, err
+	}
+	fixed, err := runFsck(format, device, true)
+	result.Output += fixed.Output
+	result.Repaired = err == nil && !fixed.ErrorsFound
+	return result, err
+}
+
+// runFsck runs the check, or the repair, of format on device. A repair
+// only reports ErrorsFound for errors it left.
+func runFsck(format api.Filesystem, device string, repair bool) (api.FsckResult, error) {
+	cmd, err := fsckCommand(format, device, repair)
+	if err != nil {
+		return api.FsckResult{}, err
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err = cmd.Run()
+	result := api.FsckResult{Output: out.String()}
+	if err == nil {
+		return result, nil
+	}
+	exit, ok := err.(*exec.ExitError)
+	if !ok {
+		return result, err
+	}
+	status := exit.Sys().(syscall.WaitStatus).ExitStatus()
+	switch format {
+	case api.FsExt4:
+		// 1 and 2 errors corrected, 4 errors left uncorrected.
+		if status&^(1|2|4) != 0 {
+			return result, fmt.Errorf("e2fsck %v failed with status %d", device, status)
+		}
+		result.ErrorsFound = true
+		result.Repaired = repair && status&4 == 0
+	case api.FsXfs:
+		// 1 corruption found in check mode, 2 a dirty log that has to be
+		// replayed by mounting the filesystem first.
+		if repair || status != 1 {
+			return result, fmt.Errorf("xfs_repair %v failed with status %d", device, status)
+		}
+		result.ErrorsFound = true
+	case api.FsBtrfs:
+		// 1 errors found, or left after a repair.
+		if status != 1 {
+			return result, fmt.Errorf("btrfs check %v failed with status %d", device, status)
+		}
+		result.ErrorsFound = true
+	}
+	return result, nil
+}
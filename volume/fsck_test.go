@@ -0,0 +1,85 @@
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// fakeFsck puts xfs_repair and btrfs in PATH. They print their arguments
+// and exit with FSCK_CHECK_STATUS when checking, FSCK_REPAIR_STATUS when
+// repairing.
+func fakeFsck(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "fsck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := `#!/bin/sh
+printf "%s\n" "$*"
+case "$*" in
+*-n*|*--readonly*) exit $FSCK_CHECK_STATUS ;;
+esac
+exit $FSCK_REPAIR_STATUS
+`
+	for _, tool := range []string{"xfs_repair", "btrfs"} {
+		if err = ioutil.WriteFile(filepath.Join(dir, tool), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+":"+path)
+	return func() {
+		os.Setenv("PATH", path)
+		os.Unsetenv("FSCK_CHECK_STATUS")
+		os.Unsetenv("FSCK_REPAIR_STATUS")
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFsck(t *testing.T) {
+	defer fakeFsck(t)()
+	tests := []struct {
+		format         api.Filesystem
+		check, repair  string
+		repairMode     bool
+		want           api.FsckResult
+		fails, repairs bool
+	}{
+		{format: api.FsXfs, check: "0", repair: "0", repairMode: true},
+		{format: api.FsXfs, check: "1", repair: "0",
+			want: api.FsckResult{ErrorsFound: true}},
+		{format: api.FsXfs, check: "1", repair: "0", repairMode: true,
+			want: api.FsckResult{ErrorsFound: true, Repaired: true}, repairs: true},
+		{format: api.FsXfs, check: "1", repair: "2", repairMode: true,
+			want: api.FsckResult{ErrorsFound: true}, fails: true, repairs: true},
+		{format: api.FsXfs, check: "2", fails: true},
+		{format: api.FsBtrfs, check: "1", repair: "0", repairMode: true,
+			want: api.FsckResult{ErrorsFound: true, Repaired: true}, repairs: true},
+		{format: api.FsBtrfs, check: "1", repair: "1", repairMode: true,
+			want: api.FsckResult{ErrorsFound: true}, repairs: true},
+		{format: api.FsBtrfs, check: "0", repair: "0", repairMode: true},
+	}
+	for _, tt := range tests {
+		os.Setenv("FSCK_CHECK_STATUS", tt.check)
+		os.Setenv("FSCK_REPAIR_STATUS", tt.repair)
+		result, err := Fsck(tt.format, "/dev/fake", tt.repairMode)
+		assert.Equal(t, tt.fails, err != nil, "%+v: error %v", tt, err)
+		assert.Equal(t, tt.want.ErrorsFound, result.ErrorsFound, "%+v: errors found", tt)
+		assert.Equal(t, tt.want.Repaired, result.Repaired, "%+v: repaired", tt)
+		// The fake tools echo their arguments, only checks pass -n or
+		// --readonly.
+		repaired := false
+		for _, line := range strings.Split(strings.TrimSpace(result.Output), "\n") {
+			if !strings.Contains(line, "-n") && !strings.Contains(line, "--readonly") {
+				repaired = true
+			}
+		}
+		assert.Equal(t, tt.repairs, repaired, "%+v: repair run", tt)
+	}
+}
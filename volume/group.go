@@ -0,0 +1,151 @@
+package volume
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/libopenstorage/kvdb"
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	groups     = "/groups/"
+	groupSnaps = "/groupsnaps/"
+)
+
+// Quiescer is implemented by drivers that can flush and hold IO on a set of
+// volumes so that snapshots taken in between are consistent with each other.
+type Quiescer interface {
+	// Quiesce IO on volumeIDs until Unquiesce is called.
+	Quiesce(volumeIDs []api.VolumeID) error
+	// Unquiesce resumes IO on volumeIDs.
+	Unquiesce(volumeIDs []api.VolumeID) error
+}
+
+// Group is a named set of volumes that are snapshotted together.
+type Group struct {
+	ID      string
+	Volumes []api.VolumeID
+}
+
+// GroupSnap is one generation of snapshots of all members of a group.
+type GroupSnap struct {
+	ID      string
+	GroupID string
+	Ctime   time.Time
+	Snaps   map[api.VolumeID]api.SnapID
+}
+
+// ConsistencyGroup manages groups of volumes of a driver. Group membership
+// and snapshot generations are stored in kvdb.
+type ConsistencyGroup struct {
+	d      VolumeDriver
+	kvdb   kvdb.Kvdb
+	prefix string
+}
+
+// NewConsistencyGroup returns a ConsistencyGroup for driver d.
+func NewConsistencyGroup(d VolumeDriver, kv kvdb.Kvdb) *ConsistencyGroup {
+	return &ConsistencyGroup{d: d, kvdb: kv, prefix: keyBase + d.String()}
+}
+
+func (c *ConsistencyGroup) groupKey(groupID string) string {
+	return c.prefix + groups + groupID
+}
+
+func (c *ConsistencyGroup) groupSnapKey(groupID, snapID string) string {
+	return c.prefix + groupSnaps + groupID + "/" + snapID
+}
+
+// CreateGroup named name with volumeIDs as members. The name is the group ID.
+func (c *ConsistencyGroup) CreateGroup(name string, volumeIDs []api.VolumeID) (*Group, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	if len(volumeIDs) == 0 {
+		return nil, fmt.Errorf("Group %v has no volumes", name)
+	}
+	if _, err := c.d.Inspect(volumeIDs); err != nil {
+		return nil, err
+	}
+	g := &Group{ID: name, Volumes: volumeIDs}
+	if _, err := c.kvdb.Create(c.groupKey(name), g, 0); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// GetGroup from groupID.
+func (c *ConsistencyGroup) GetGroup(groupID string) (*Group, error) {
+	var g Group
+	_, err := c.kvdb.GetVal(c.groupKey(groupID), &g)
+	return &g, err
+}
+
+// DeleteGroup removes the group and its snapshot generations. The member
+// volumes and their snapshots are not deleted.
+func (c *ConsistencyGroup) DeleteGroup(groupID string) error {
+	if _, err := c.kvdb.Delete(c.groupKey(groupID)); err != nil {
+		return err
+	}
+	return c.kvdb.DeleteTree(c.prefix + groupSnaps + groupID)
+}
+
+// SnapshotGroup snapshots all members of groupID. If the driver is a Quiescer
+// IO is held on all members while the snapshots are taken. Either all members
+// are snapshotted or none are.
+func (c *ConsistencyGroup) SnapshotGroup(groupID string) ([]api.SnapID, error) {
+	g, err := c.GetGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+	if q, ok := Unwrap(c.d).(Quiescer); ok {
+		if err = q.Quiesce(g.Volumes); err != nil {
+			return nil, err
+		}
+		defer q.Unquiesce(g.Volumes)
+	}
+
+	now := time.Now()
+	gs := &GroupSnap{
+		ID:      now.UTC().Format("20060102T150405.000000000"),
+		GroupID: groupID,
+		Ctime:   now,
+		Snaps:   make(map[api.VolumeID]api.SnapID),
+	}
+	labels := api.Labels{"group": groupID, "generation": gs.ID}
+	snaps := make([]api.SnapID, 0, len(g.Volumes))
+	for _, v := range g.Volumes {
+		id, err := Snapshot(c.d, v, labels)
+		if err != nil {
+			for _, s := range snaps {
+				SnapDelete(c.d, s)
+			}
+			return nil, fmt.Errorf("Failed to snapshot %v in group %v: %v", v, groupID, err)
+		}
+		snaps = append(snaps, id)
+		gs.Snaps[v] = id
+	}
+	if _, err = c.kvdb.Create(c.groupSnapKey(groupID, gs.ID), gs, 0); err != nil {
+		return nil, err
+	}
+	return snaps, nil
+}
+
+// GroupSnapshots returns the snapshot generations of groupID.
+func (c *ConsistencyGroup) GroupSnapshots(groupID string) ([]GroupSnap, error) {
+	kvp, err := c.kvdb.Enumerate(c.prefix + groupSnaps + groupID + "/")
+	if err != nil {
+		return nil, err
+	}
+	gs := make([]GroupSnap, 0, len(kvp))
+	for _, v := range kvp {
+		var elem GroupSnap
+		if err = json.Unmarshal(v.Value, &elem); err != nil {
+			return nil, err
+		}
+		gs = append(gs, elem)
+	}
+	return gs, nil
+}
@@ -0,0 +1,88 @@
+package volume
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// snapDriver snapshots every volume except bad and tracks live snapshots.
+type snapDriver struct {
+	VolumeDriver
+	bad       api.VolumeID
+	snaps     map[api.SnapID]api.VolumeID
+	quiesced  bool
+	unquiesce bool
+}
+
+func (s *snapDriver) String() string {
+	return "group_test"
+}
+
+func (s *snapDriver) Inspect(ids []api.VolumeID) ([]api.Volume, error) {
+	return nil, nil
+}
+
+func (s *snapDriver) Snapshot(volumeID api.VolumeID, labels api.Labels) (api.SnapID, error) {
+	if volumeID == s.bad {
+		return api.BadSnapID, errors.New("snapshot failed")
+	}
+	id := api.SnapID("snap-" + string(volumeID))
+	s.snaps[id] = volumeID
+	return id, nil
+}
+
+func (s *snapDriver) SnapDelete(snapID api.SnapID) error {
+	delete(s.snaps, snapID)
+	return nil
+}
+
+func (s *snapDriver) Quiesce(volumeIDs []api.VolumeID) error {
+	s.quiesced = true
+	return nil
+}
+
+func (s *snapDriver) Unquiesce(volumeIDs []api.VolumeID) error {
+	s.unquiesce = true
+	return nil
+}
+
+func TestSnapshotGroup(t *testing.T) {
+	d := &snapDriver{snaps: make(map[api.SnapID]api.VolumeID)}
+	cg := NewConsistencyGroup(d, store.kvdb)
+	_, err := cg.CreateGroup("db", []api.VolumeID{"data", "wal"})
+	assert.NoError(t, err, "Failed in CreateGroup")
+	_, err = cg.CreateGroup("db", []api.VolumeID{"data"})
+	assert.Error(t, err, "Group names should be unique")
+
+	snaps, err := cg.SnapshotGroup("db")
+	assert.NoError(t, err, "Failed in SnapshotGroup")
+	assert.Equal(t, 2, len(snaps), "All members should be snapshotted")
+	assert.True(t, d.quiesced && d.unquiesce, "Members should be quiesced")
+	gs, err := cg.GroupSnapshots("db")
+	assert.NoError(t, err, "Failed in GroupSnapshots")
+	assert.Equal(t, 1, len(gs), "Number of generations")
+
+	d.snaps = make(map[api.SnapID]api.VolumeID)
+	d.bad = "wal"
+	_, err = cg.SnapshotGroup("db")
+	assert.Error(t, err, "SnapshotGroup should fail if a member fails")
+	assert.Equal(t, 0, len(d.snaps), "Partial snapshots should be deleted")
+
+	err = cg.DeleteGroup("db")
+	assert.NoError(t, err, "Failed in DeleteGroup")
+}
+
+func TestQuiescedSnapshot(t *testing.T) {
+	d := &snapDriver{snaps: make(map[api.SnapID]api.VolumeID)}
+	id, err := QuiescedSnapshot(d, "data", nil)
+	assert.NoError(t, err, "Failed in QuiescedSnapshot")
+	assert.Equal(t, api.SnapID("snap-data"), id)
+	assert.True(t, d.quiesced && d.unquiesce, "Volume should be quiesced")
+
+	err = Quiesce(&flakyDriver{}, "data")
+	assert.Equal(t, ErrNotSupported, err, "Quiesce without a Quiescer")
+}
@@ -0,0 +1,216 @@
+package volume
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// ManifestVersion of the manifests written by ExportManifest.
+const ManifestVersion = 1
+
+// Manifest is a portable copy of the volume and snapshot records of a
+// driver, used to rebuild them after the kvdb is lost.
+type Manifest struct {
+	Version   int
+	Driver    string
+	Ctime     time.Time
+	Volumes   []api.Volume
+	Snapshots []api.VolumeSnap
+	// Records of drivers that keep their own instead of using the
+	// DefaultEnumerator. Volumes is informational for those.
+	Records []json.RawMessage `json:",omitempty"`
+}
+
+// ManifestConflict is how ImportManifest handles records that exist already.
+type ManifestConflict string
+
+const (
+	// ConflictFail fails the import before anything is written.
+	ConflictFail = ManifestConflict("fail")
+	// ConflictSkip keeps the existing records.
+	ConflictSkip = ManifestConflict("skip")
+	// ConflictOverwrite replaces the existing records.
+	ConflictOverwrite = ManifestConflict("overwrite")
+)
+
+// ImportManifestOptions are passed in with an ImportManifest request.
+type ImportManifestOptions struct {
+	// DryRun validates the manifest and checks for conflicts without
+	// writing any record.
+	DryRun bool
+	// OnConflict defaults to ConflictFail.
+	OnConflict ManifestConflict
+}
+
+// Conflict returns how o handles existing records, ConflictFail by default.
+func (o ImportManifestOptions) Conflict() (ManifestConflict, error) {
+	switch o.OnConflict {
+	case "":
+		return ConflictFail, nil
+	case ConflictFail, ConflictSkip, ConflictOverwrite:
+		return o.OnConflict, nil
+	}
+	return "", fmt.Errorf("Unknown conflict handling %q", o.OnConflict)
+}
+
+// ParseManifest decodes data and checks that it is a manifest of driver
+// that this version can read.
+func ParseManifest(data []byte, driver string) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("Failed to parse manifest: %v", err)
+	}
+	if m.Version > ManifestVersion {
+		return nil, fmt.Errorf("Manifest version %v is newer than %v", m.Version, ManifestVersion)
+	}
+	if m.Driver != driver {
+		return nil, fmt.Errorf("Manifest of driver %v cannot be imported into %v", m.Driver, driver)
+	}
+	return &m, nil
+}
+
+// ExportManifest serializes all volume and snapshot records into a Manifest.
+func (e *DefaultEnumerator) ExportManifest() ([]byte, error) {
+	vols, err := e.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	snaps, err := e.SnapEnumerate(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&Manifest{
+		Version:   ManifestVersion,
+		Driver:    e.driver,
+		Ctime:     time.Now(),
+		Volumes:   vols,
+		Snapshots: snaps,
+	})
+}
+
+// parseManifest decodes data and checks that it can be imported into e.
+func (e *DefaultEnumerator) parseManifest(data []byte) (*Manifest, error) {
+	m, err := ParseManifest(data, e.driver)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Records) > 0 {
+		return nil, fmt.Errorf("Manifest has driver records that %v does not use", e.driver)
+	}
+	ids := make(map[api.VolumeID]bool, len(m.Volumes))
+	for i := range m.Volumes {
+		v := &m.Volumes[i]
+		if v.ID == api.BadVolumeID || ids[v.ID] {
+			return nil, fmt.Errorf("Manifest has an empty or duplicate volume ID %q", v.ID)
+		}
+		ids[v.ID] = true
+		if err := migrate(v); err != nil {
+			return nil, err
+		}
+		reconcileImported(v)
+	}
+	snapIDs := make(map[api.SnapID]bool, len(m.Snapshots))
+	for _, s := range m.Snapshots {
+		if s.ID == api.BadSnapID || snapIDs[s.ID] {
+			return nil, fmt.Errorf("Manifest has a snapshot of %v with an empty or duplicate ID %q", s.VolumeID, s.ID)
+		}
+		snapIDs[s.ID] = true
+		if !ids[s.VolumeID] {
+			return nil, fmt.Errorf("Snapshot %v is of volume %v, which is not in the manifest", s.ID, s.VolumeID)
+		}
+	}
+	return m, nil
+}
+
+// reconcileImported clears the attachment of v that did not survive the loss
+// of the kvdb. Loop and other device nodes are not kept across a restore,
+// they may be in use by other volumes by now.
+func reconcileImported(v *api.Volume) {
+	if v.AttachPath != "" {
+		if mounted, err := IsMountPoint(v.AttachPath); err != nil || !mounted {
+			v.AttachPath = ""
+		}
+	}
+	v.SubPathMounts = MountedPaths(v.SubPathMounts)
+	if v.DevicePath != "" && v.AttachPath == "" && len(v.SubPathMounts) == 0 {
+		if fi, err := os.Stat(v.DevicePath); err == nil && fi.Mode()&os.ModeDevice != 0 {
+			v.DevicePath = ""
+		}
+	}
+	if v.DevicePath == "" {
+		v.AttachedOn = ""
+		if v.State == api.VolumeAttached {
+			v.State = api.VolumeAvailable
+		}
+	}
+}
+
+// ImportManifest restores the records of a manifest written by
+// ExportManifest. With ConflictFail, nothing is written if any record exists.
+func (e *DefaultEnumerator) ImportManifest(data []byte, opts ImportManifestOptions) error {
+	if !opts.DryRun {
+		if err := e.CheckWritable(); err != nil {
+			return err
+		}
+	}
+	onConflict, err := opts.Conflict()
+	if err != nil {
+		return err
+	}
+	m, err := e.parseManifest(data)
+	if err != nil {
+		return err
+	}
+
+	volExists := make(map[api.VolumeID]bool)
+	for _, v := range m.Volumes {
+		if _, err := e.kvdb.Get(e.volKey(v.ID)); err == nil {
+			if onConflict == ConflictFail {
+				return fmt.Errorf("Volume %v already exists", v.ID)
+			}
+			volExists[v.ID] = true
+		}
+	}
+	snapExists := make(map[api.SnapID]bool)
+	for _, s := range m.Snapshots {
+		if _, err := e.kvdb.Get(e.snapKey(s.ID)); err == nil {
+			if onConflict == ConflictFail {
+				return fmt.Errorf("Snapshot %v already exists", s.ID)
+			}
+			snapExists[s.ID] = true
+		}
+	}
+	if opts.DryRun {
+		return nil
+	}
+
+	for i := range m.Volumes {
+		v := &m.Volumes[i]
+		switch {
+		case !volExists[v.ID]:
+			err = e.CreateVol(v)
+		case onConflict == ConflictOverwrite:
+			err = e.UpdateVol(v)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to import volume %v: %v", v.ID, err)
+		}
+	}
+	for i := range m.Snapshots {
+		s := &m.Snapshots[i]
+		switch {
+		case !snapExists[s.ID]:
+			err = e.CreateSnap(s)
+		case onConflict == ConflictOverwrite:
+			err = e.UpdateSnap(s)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to import snapshot %v: %v", s.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package volume
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	metricPrefix = "openstorage_"
+
+	OpCreate          = "create"
+	OpDelete          = "delete"
+	OpDeleteRecursive = "delete_recursive"
+	OpMount           = "mount"
+	OpUnmount         = "unmount"
+	OpSnapshot        = "snapshot"
+	OpSnapDelete      = "snap_delete"
+	OpAttach          = "attach"
+	OpDetach          = "detach"
+	OpFormat          = "format"
+)
+
+// Metricer is implemented by drivers that export metrics.
+type Metricer interface {
+	// Metrics returns the current value of all metrics for this driver.
+	Metrics() []api.Metric
+}
+
+// OpCounter counts driver operations and their failures. Drivers can
+// include it and report its Metrics as part of their own.
+type OpCounter struct {
+	mutex sync.Mutex
+	ops   map[string]uint64
+	errs  map[string]uint64
+}
+
+// NewOpCounter returns an OpCounter with all counts at zero.
+func NewOpCounter() *OpCounter {
+	return &OpCounter{
+		ops:  make(map[string]uint64),
+		errs: make(map[string]uint64),
+	}
+}
+
+// Record one invocation of op, counting it as failed if err is non nil.
+func (c *OpCounter) Record(op string, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.ops[op]++
+	if err != nil {
+		c.errs[op]++
+	}
+}
+
+// Metrics returns operation and error counters by operation.
+func (c *OpCounter) Metrics() []api.Metric {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	m := make([]api.Metric, 0, len(c.ops)+len(c.errs))
+	for op, v := range c.ops {
+		m = append(m, api.Metric{
+			Name:   "operations_total",
+			Help:   "Number of volume operations by type.",
+			Type:   api.MetricCounter,
+			Labels: api.Labels{"op": op},
+			Value:  float64(v),
+		})
+	}
+	for op, v := range c.errs {
+		m = append(m, api.Metric{
+			Name:   "operation_errors_total",
+			Help:   "Number of failed volume operations by type.",
+			Type:   api.MetricCounter,
+			Labels: api.Labels{"op": op},
+			Value:  float64(v),
+		})
+	}
+	return m
+}
+
+func formatLabels(labels api.Labels) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%q", k, labels[k])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// WriteMetrics writes the metrics of all driver instances that implement
+// Metricer to w in the Prometheus text exposition format.
+func WriteMetrics(w io.Writer) {
+	// Collect outside the registry lock, Metrics can read kvdb.
+	metricers := make(map[string]Metricer)
+	mutex.Lock()
+	for name, d := range instances {
+		if m, ok := Unwrap(d).(Metricer); ok {
+			metricers[name] = m
+		}
+	}
+	mutex.Unlock()
+
+	byName := make(map[string][]api.Metric)
+	for name, m := range metricers {
+		for _, v := range m.Metrics() {
+			labels := api.Labels{"driver": name}
+			for k, l := range v.Labels {
+				labels[k] = l
+			}
+			v.Labels = labels
+			byName[v.Name] = append(byName[v.Name], v)
+		}
+	}
+
+	names := make([]string, 0, len(byName))
+	for k := range byName {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		samples := byName[n]
+		fmt.Fprintf(w, "# HELP %s%s %s\n", metricPrefix, n, samples[0].Help)
+		fmt.Fprintf(w, "# TYPE %s%s %s\n", metricPrefix, n, samples[0].Type)
+		for _, v := range samples {
+			fmt.Fprintf(w, "%s%s%s %v\n", metricPrefix, n, formatLabels(v.Labels), v.Value)
+		}
+	}
+}
+
+// MetricsHandler serves metrics aggregated across all driver instances for
+// Prometheus scraping.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	WriteMetrics(w)
+}
+
+// CapacityMetrics returns gauges for the number of snapshots and the total
+// provisioned capacity of a driver.
+func CapacityMetrics(snapshots int, capacity uint64) []api.Metric {
+	return []api.Metric{
+		{
+			Name:  "snapshots",
+			Help:  "Number of snapshots.",
+			Type:  api.MetricGauge,
+			Value: float64(snapshots),
+		},
+		{
+			Name:  "capacity_bytes",
+			Help:  "Total provisioned capacity of all volumes in bytes.",
+			Type:  api.MetricGauge,
+			Value: float64(capacity),
+		},
+	}
+}
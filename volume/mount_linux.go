@@ -0,0 +1,115 @@
+package volume
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+var (
+	propagationFlags = map[api.MountPropagation]uintptr{
+		api.PropagationPrivate:  syscall.MS_PRIVATE,
+		api.PropagationRPrivate: syscall.MS_PRIVATE | syscall.MS_REC,
+		api.PropagationShared:   syscall.MS_SHARED,
+		api.PropagationRShared:  syscall.MS_SHARED | syscall.MS_REC,
+		api.PropagationSlave:    syscall.MS_SLAVE,
+		api.PropagationRSlave:   syscall.MS_SLAVE | syscall.MS_REC,
+	}
+	// optionFlags are generic options that are passed as mount flags rather
+	// than as filesystem data.
+	optionFlags = map[string]uintptr{
+		"nosuid":     syscall.MS_NOSUID,
+		"nodev":      syscall.MS_NODEV,
+		"noexec":     syscall.MS_NOEXEC,
+		"noatime":    syscall.MS_NOATIME,
+		"nodiratime": syscall.MS_NODIRATIME,
+		"relatime":   syscall.MS_RELATIME,
+		"sync":       syscall.MS_SYNCHRONOUS,
+	}
+)
+
+// MountFlags returns the flags and data to mount with once opts are applied
+// to the driver's own flags and data.
+func MountFlags(flags uintptr, data string, opts *api.MountOptions) (uintptr, string) {
+	if opts == nil {
+		return flags, data
+	}
+	if opts.ReadOnly {
+		flags |= syscall.MS_RDONLY
+	}
+	extra := []string{}
+	if data != "" {
+		extra = append(extra, data)
+	}
+	for _, o := range strings.Split(opts.Options, ",") {
+		if f, ok := optionFlags[o]; ok {
+			flags |= f
+		} else if o != "" {
+			extra = append(extra, o)
+		}
+	}
+	return flags, strings.Join(extra, ",")
+}
+
+// ForceUnmount lazily unmounts each of paths so that they are released even
+// if they are busy or their backing store hangs. Paths that are not mounted
+// are skipped. It goes on past failures and returns the first one.
+func ForceUnmount(volumeID api.VolumeID, paths ...string) error {
+	var first error
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		err := syscall.Unmount(p, syscall.MNT_DETACH)
+		switch err {
+		case nil:
+			log.Infof("Force released volume %v: detached mount %v", volumeID, p)
+		case syscall.EINVAL, syscall.ENOENT:
+			log.Infof("Force released volume %v: %v is not mounted", volumeID, p)
+		default:
+			log.Warnf("Force releasing volume %v: cannot detach %v: %v", volumeID, p, err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// MountWithOptions mounts source at target and applies opts. A nil opts
+// mounts with flags and data unchanged. Bind mounts ignore filesystem data,
+// and their flags only take effect on a remount, which is done here.
+func MountWithOptions(
+	source, target, fstype string,
+	flags uintptr,
+	data string,
+	opts *api.MountOptions) error {
+
+	var propagation uintptr
+	if opts != nil && opts.Propagation != "" {
+		var ok bool
+		if propagation, ok = propagationFlags[opts.Propagation]; !ok {
+			return fmt.Errorf("Unknown mount propagation %q", opts.Propagation)
+		}
+	}
+	mflags, mdata := MountFlags(flags, data, opts)
+	if err := syscall.Mount(source, target, fstype, mflags, mdata); err != nil {
+		return err
+	}
+	var err error
+	if mflags&syscall.MS_BIND != 0 && mflags != flags {
+		err = syscall.Mount("", target, "", mflags|syscall.MS_REMOUNT, "")
+	}
+	if err == nil && propagation != 0 {
+		err = syscall.Mount("", target, "", propagation, "")
+	}
+	if err != nil {
+		syscall.Unmount(target, 0)
+		return fmt.Errorf("Failed to apply mount options to %v: %v", target, err)
+	}
+	return nil
+}
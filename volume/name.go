@@ -0,0 +1,212 @@
+package volume
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/libopenstorage/kvdb"
+	"github.com/libopenstorage/openstorage/api"
+)
+
+var (
+	validName = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9_.-]*$")
+
+	// nameTokens maps strftime style tokens to Go time layouts.
+	nameTokens = map[byte]string{
+		'Y': "2006",
+		'y': "06",
+		'm': "01",
+		'd': "02",
+		'H': "15",
+		'M': "04",
+		'S': "05",
+		'b': "Jan",
+		'a': "Mon",
+	}
+)
+
+// IsNameTemplate returns true if name contains tokens expanded by ExpandName.
+func IsNameTemplate(name string) bool {
+	return strings.Contains(name, "%")
+}
+
+// ExpandName replaces the strftime style tokens %Y, %y, %m, %d, %H, %M, %S,
+// %b and %a in template with their value at time t. %% expands to %, unknown
+// tokens are left as is.
+func ExpandName(template string, t time.Time) string {
+	var b []byte
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if c != '%' || i == len(template)-1 {
+			b = append(b, c)
+			continue
+		}
+		i++
+		if template[i] == '%' {
+			b = append(b, '%')
+		} else if layout, ok := nameTokens[template[i]]; ok {
+			b = append(b, t.Format(layout)...)
+		} else {
+			b = append(b, '%', template[i])
+		}
+	}
+	return string(b)
+}
+
+// ValidateName checks that name only contains letters, digits, '_', '.'
+// and '-' and starts with a letter or digit.
+func ValidateName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("Invalid name %q: must match %v", name, validName)
+	}
+	return nil
+}
+
+// SnapNameLabel is the snapshot label that holds its name. A template in
+// it is expanded with UniqueSnapName.
+const SnapNameLabel = "name"
+
+// NameReserver is implemented by enumerators that can reserve a name until
+// the record that takes it is written.
+type NameReserver interface {
+	// ReserveName returns kvdb.ErrExist if key is reserved already.
+	ReserveName(key string) error
+	// ReleaseName drops a reservation made with ReserveName.
+	ReleaseName(key string)
+}
+
+func nameReserver(e Enumerator) NameReserver {
+	if d, ok := e.(VolumeDriver); ok {
+		e = Unwrap(d)
+	}
+	r, _ := e.(NameReserver)
+	return r
+}
+
+// uniqueName expands template at time t and appends a counter until a name
+// is found that can be reserved under prefix and for which taken is false.
+func uniqueName(
+	e Enumerator,
+	prefix string,
+	template string,
+	t time.Time,
+	taken func(name string) (bool, error)) (string, func(), error) {
+
+	base := ExpandName(template, t)
+	if err := ValidateName(base); err != nil {
+		return "", nil, err
+	}
+	r := nameReserver(e)
+	name := base
+	for i := 1; ; name, i = fmt.Sprintf("%s-%d", base, i), i+1 {
+		release := func() {}
+		if r != nil {
+			key := prefix + name
+			err := r.ReserveName(key)
+			if err == kvdb.ErrExist {
+				continue
+			} else if err != nil {
+				return "", nil, err
+			}
+			release = func() { r.ReleaseName(key) }
+		}
+		used, err := taken(name)
+		if err != nil {
+			release()
+			return "", nil, err
+		}
+		if !used {
+			return name, release, nil
+		}
+		release()
+	}
+}
+
+// UniqueName expands template at time t and appends a counter if a volume
+// with the resulting name already exists in e. If e is a NameReserver, the
+// name stays reserved until release is called, which must happen once the
+// volume is recorded.
+func UniqueName(e Enumerator, template string, t time.Time) (name string, release func(), err error) {
+	return uniqueName(e, "", template, t, func(name string) (bool, error) {
+		vols, err := e.Enumerate(api.VolumeLocator{Name: name}, nil)
+		return len(vols) > 0, err
+	})
+}
+
+// UniqueSnapName is UniqueName for the SnapNameLabel of the snapshots of
+// volumeID.
+func UniqueSnapName(
+	e Enumerator,
+	volumeID api.VolumeID,
+	template string,
+	t time.Time) (name string, release func(), err error) {
+
+	// '@' cannot appear in a volume name, so snapshot reservations never
+	// collide with volume ones.
+	prefix := string(volumeID) + "@"
+	return uniqueName(e, prefix, template, t, func(name string) (bool, error) {
+		snaps, err := e.SnapEnumerate([]api.VolumeID{volumeID}, nil)
+		for _, s := range snaps {
+			if s.SnapLabels[SnapNameLabel] == name {
+				return true, nil
+			}
+		}
+		return false, err
+	})
+}
+
+// ReserveName reserves key until ReleaseName is called.
+func (e *DefaultEnumerator) ReserveName(key string) error {
+	_, err := e.kvdb.Create(e.nameKey(key), &nameReservation{}, 0)
+	return err
+}
+
+// ReleaseName drops a reservation made with ReserveName.
+func (e *DefaultEnumerator) ReleaseName(key string) {
+	e.kvdb.Delete(e.nameKey(key))
+}
+
+// nameReservation is the value of the key that reserves a name while a
+// volume is renamed to it.
+type nameReservation struct {
+	VolumeID api.VolumeID
+}
+
+// Rename sets the locator name of volID to newName. The name is reserved in
+// kvdb for the duration of the rename so that two volumes cannot be renamed
+// to the same name at once, and the record is updated with a compare and
+// set so that concurrent updates are not lost.
+func (e *DefaultEnumerator) Rename(volID api.VolumeID, newName string) error {
+	if err := e.CheckWritable(); err != nil {
+		return err
+	}
+	if err := ValidateName(newName); err != nil {
+		return err
+	}
+	_, err := e.kvdb.Create(e.nameKey(newName), &nameReservation{VolumeID: volID}, 0)
+	if err == kvdb.ErrExist {
+		return fmt.Errorf("Volume %q is being renamed concurrently", newName)
+	} else if err != nil {
+		return err
+	}
+	defer e.kvdb.Delete(e.nameKey(newName))
+
+	vols, err := e.Enumerate(api.VolumeLocator{Name: newName}, nil)
+	if err != nil {
+		return err
+	}
+	for _, v := range vols {
+		if v.ID != volID {
+			return fmt.Errorf("Volume named %v already exists", newName)
+		}
+	}
+	return e.compareAndUpdate(volID, func(v *api.Volume) (bool, error) {
+		if v.Locator.Name == newName {
+			return false, nil
+		}
+		v.Locator.Name = newName
+		return true, nil
+	})
+}
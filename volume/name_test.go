@@ -0,0 +1,86 @@
+package volume
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestExpandName(t *testing.T) {
+	tm := time.Date(2024, time.June, 1, 12, 5, 9, 0, time.UTC)
+	assert.Equal(t, "db-2024-06-01T1205", ExpandName("db-%Y-%m-%dT%H%M", tm))
+	assert.Equal(t, "db-24.09", ExpandName("db-%y.%S", tm))
+	assert.Equal(t, "100%", ExpandName("100%%", tm))
+	assert.Equal(t, "a%qb%", ExpandName("a%qb%", tm))
+	assert.Equal(t, "plain", ExpandName("plain", tm))
+}
+
+func TestValidateName(t *testing.T) {
+	assert.NoError(t, ValidateName("db-2024.06_01"))
+	assert.Error(t, ValidateName("-db"))
+	assert.Error(t, ValidateName("db/01"))
+	assert.Error(t, ValidateName(""))
+}
+
+func TestUniqueName(t *testing.T) {
+	tm := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	vol := api.Volume{
+		ID:      api.VolumeID("uniq"),
+		Locator: api.VolumeLocator{Name: "uniq-2024"},
+		Spec:    &api.VolumeSpec{},
+	}
+	err := store.CreateVol(&vol)
+	assert.NoError(t, err, "Failed in CreateVol")
+
+	name, release, err := UniqueName(store, "uniq-%Y", tm)
+	assert.NoError(t, err, "Failed in UniqueName")
+	assert.Equal(t, "uniq-2024-1", name)
+
+	// The name stays reserved until released.
+	other, otherRelease, err := UniqueName(store, "uniq-%Y", tm)
+	assert.NoError(t, err, "Failed in UniqueName")
+	assert.Equal(t, "uniq-2024-2", other)
+	otherRelease()
+	release()
+
+	name, release, err = UniqueName(store, "uniq-%Y", tm)
+	assert.NoError(t, err, "Failed in UniqueName")
+	assert.Equal(t, "uniq-2024-1", name, "Released names can be reused")
+	release()
+
+	name, release, err = UniqueName(store, "other-%Y", tm)
+	assert.NoError(t, err, "Failed in UniqueName")
+	assert.Equal(t, "other-2024", name)
+	release()
+
+	_, _, err = UniqueName(store, "bad/%Y", tm)
+	assert.Error(t, err, "UniqueName should reject invalid names")
+
+	err = store.DeleteVol(vol.ID)
+	assert.NoError(t, err, "Failed in Delete")
+}
+
+func TestUniqueSnapName(t *testing.T) {
+	tm := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	snap := api.VolumeSnap{
+		ID:         api.SnapID("uniqsnap"),
+		VolumeID:   api.VolumeID("uniqvol"),
+		SnapLabels: api.Labels{SnapNameLabel: "daily-2024"},
+	}
+	err := store.CreateSnap(&snap)
+	assert.NoError(t, err, "Failed in CreateSnap")
+	defer store.DeleteSnap(snap.ID)
+
+	name, release, err := UniqueSnapName(store, snap.VolumeID, "daily-%Y", tm)
+	assert.NoError(t, err, "Failed in UniqueSnapName")
+	assert.Equal(t, "daily-2024-1", name)
+	release()
+
+	name, release, err = UniqueSnapName(store, "othervol", "daily-%Y", tm)
+	assert.NoError(t, err, "Failed in UniqueSnapName")
+	assert.Equal(t, "daily-2024", name, "Snapshot names are unique per volume")
+	release()
+}
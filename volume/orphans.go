@@ -0,0 +1,83 @@
+package volume
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// orphanReapInterval between attempts to delete queued orphans.
+var orphanReapInterval = time.Minute
+
+// orphanQueue holds volumes whose cleanup failed until a background reaper
+// manages to delete them. The queue is kept in memory, orphans left by a
+// restart still carry SnapSourceLabel.
+type orphanQueue struct {
+	sync.Mutex
+	volumes map[api.VolumeID]VolumeDriver
+	running bool
+}
+
+var orphans = &orphanQueue{volumes: make(map[api.VolumeID]VolumeDriver)}
+
+// add queues volumeID of d and starts the reaper if it is not running.
+func (q *orphanQueue) add(d VolumeDriver, volumeID api.VolumeID) {
+	q.Lock()
+	defer q.Unlock()
+	q.volumes[volumeID] = d
+	if !q.running {
+		q.running = true
+		go q.reaper()
+	}
+}
+
+// reap tries to delete every queued volume once.
+func (q *orphanQueue) reap() {
+	q.Lock()
+	queued := make(map[api.VolumeID]VolumeDriver, len(q.volumes))
+	for id, d := range q.volumes {
+		queued[id] = d
+	}
+	q.Unlock()
+
+	for id, d := range queued {
+		err := d.Delete(id)
+		if err != nil && err != ErrEnoEnt {
+			log.Warnf("Failed to delete orphaned volume %v: %v", id, err)
+			continue
+		}
+		q.Lock()
+		delete(q.volumes, id)
+		q.Unlock()
+	}
+}
+
+// reaper reaps the queue every orphanReapInterval until it is empty.
+func (q *orphanQueue) reaper() {
+	for {
+		time.Sleep(orphanReapInterval)
+		q.reap()
+		q.Lock()
+		if len(q.volumes) == 0 {
+			q.running = false
+			q.Unlock()
+			return
+		}
+		q.Unlock()
+	}
+}
+
+// Orphans returns the volumes queued for deletion after a failed cleanup, in
+// no particular order.
+func Orphans() []api.VolumeID {
+	orphans.Lock()
+	defer orphans.Unlock()
+	ids := make([]api.VolumeID, 0, len(orphans.volumes))
+	for id := range orphans.volumes {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -0,0 +1,69 @@
+package volume
+
+import (
+	"sync/atomic"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// ReadOnlySetter is implemented by drivers that support a read-only
+// maintenance mode, in which operations that modify volumes fail with
+// ErrReadOnlyMode while reads keep working.
+type ReadOnlySetter interface {
+	SetReadOnly(readOnly bool)
+	ReadOnly() bool
+}
+
+// SetReadOnly puts d in or out of read-only mode. It returns ErrNotSupported
+// if d has no read-only mode.
+func SetReadOnly(d VolumeDriver, readOnly bool) error {
+	if r, ok := Unwrap(d).(ReadOnlySetter); ok {
+		r.SetReadOnly(readOnly)
+		return nil
+	}
+	return ErrNotSupported
+}
+
+// ReadOnlyMode implements ReadOnlySetter and is meant to be embedded.
+type ReadOnlyMode struct {
+	readOnly int32
+}
+
+// SetReadOnly sets the mode.
+func (m *ReadOnlyMode) SetReadOnly(readOnly bool) {
+	var v int32
+	if readOnly {
+		v = 1
+	}
+	atomic.StoreInt32(&m.readOnly, v)
+}
+
+// ReadOnly returns true in read-only mode.
+func (m *ReadOnlyMode) ReadOnly() bool {
+	return atomic.LoadInt32(&m.readOnly) != 0
+}
+
+// CheckWritable returns ErrReadOnlyMode in read-only mode.
+func (m *ReadOnlyMode) CheckWritable() error {
+	if m.ReadOnly() {
+		return ErrReadOnlyMode
+	}
+	return nil
+}
+
+// CheckMount returns ErrReadOnlyMode for mounts with opts that are not
+// read-only in read-only mode.
+func (m *ReadOnlyMode) CheckMount(opts *api.MountOptions) error {
+	if opts != nil && opts.ReadOnly {
+		return nil
+	}
+	return m.CheckWritable()
+}
+
+// ModeStatus is the Status entry describing the mode.
+func (m *ReadOnlyMode) ModeStatus() [2]string {
+	if m.ReadOnly() {
+		return [2]string{"Mode", "read-only"}
+	}
+	return [2]string{"Mode", "read-write"}
+}
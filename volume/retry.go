@@ -0,0 +1,231 @@
+package volume
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/libopenstorage/kvdb"
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// RetryPolicy controls how a driver returned by WithRetry retries failed
+// operations.
+type RetryPolicy struct {
+	// InitialInterval to wait before the first retry.
+	InitialInterval time.Duration
+	// MaxInterval caps the wait between retries.
+	MaxInterval time.Duration
+	// Multiplier applied to the wait after every retry.
+	Multiplier float64
+	// Jitter randomizes every wait by up to this fraction of it.
+	Jitter float64
+	// MaxElapsedTime after which the last error is returned.
+	MaxElapsedTime time.Duration
+	// MaxAttempts after which the last error is returned, unlimited if 0.
+	MaxAttempts int
+	// Retryable classifies errors as worth retrying, IsTransient if nil.
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy retries for up to a minute with exponential backoff.
+var DefaultRetryPolicy = RetryPolicy{
+	InitialInterval: 500 * time.Millisecond,
+	MaxInterval:     10 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.2,
+	MaxElapsedTime:  time.Minute,
+}
+
+// TransientError wraps an error caused by a condition that is expected to
+// clear on its own, such as an unreachable server.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+// Temporary always true for a TransientError.
+func (e *TransientError) Temporary() bool {
+	return true
+}
+
+// MountError is returned by drivers when a mount fails. It keeps the system
+// error of the mount, which IsTransient classifies.
+type MountError struct {
+	Source string
+	Target string
+	Err    error
+}
+
+func (e *MountError) Error() string {
+	return fmt.Sprintf("Failed to mount %v at %v: %v", e.Source, e.Target, e.Err)
+}
+
+// transientErrnos are the system errors of mount, umount and exec'd tools
+// that usually clear on a retry.
+var transientErrnos = map[syscall.Errno]bool{
+	syscall.EAGAIN:       true,
+	syscall.EBUSY:        true,
+	syscall.EINTR:        true,
+	syscall.ETIMEDOUT:    true,
+	syscall.ECONNREFUSED: true,
+	syscall.ECONNRESET:   true,
+	syscall.EHOSTDOWN:    true,
+	syscall.EHOSTUNREACH: true,
+	syscall.ENETUNREACH:  true,
+}
+
+// IsTransient returns true if err is classified as temporary: a kvdb
+// compare-and-set that lost a race, a system error such as EBUSY or
+// ETIMEDOUT, possibly wrapped in an os, exec or MountError, or an error that
+// implements Temporary() bool, such as TransientError and net.Error.
+func IsTransient(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case *os.PathError:
+		return IsTransient(e.Err)
+	case *os.SyscallError:
+		return IsTransient(e.Err)
+	case *exec.Error:
+		return IsTransient(e.Err)
+	case *MountError:
+		return IsTransient(e.Err)
+	case syscall.Errno:
+		return transientErrnos[e] || e.Temporary()
+	case net.Error:
+		return e.Timeout() || e.Temporary()
+	}
+	if err == kvdb.ErrValueMismatch {
+		return true
+	}
+	t, ok := err.(interface {
+		Temporary() bool
+	})
+	return ok && t.Temporary()
+}
+
+type retryDriver struct {
+	VolumeDriver
+	policy RetryPolicy
+}
+
+// WithRetry returns a VolumeDriver that retries the idempotent operations
+// of d (Mount, Unmount, Inspect, Enumerate, SnapInspect, SnapEnumerate,
+// Stats and Alerts) according to policy. All other operations, such as
+// Create, are passed through and never retried.
+func WithRetry(d VolumeDriver, policy RetryPolicy) VolumeDriver {
+	return &retryDriver{VolumeDriver: d, policy: policy}
+}
+
+// Unwrap returns the driver passed to WithRetry.
+func (r *retryDriver) Unwrap() VolumeDriver {
+	return r.VolumeDriver
+}
+
+func (r *retryDriver) retry(fn func() error) error {
+	return retry(r.policy, fn)
+}
+
+// retry calls fn until it succeeds or policy gives up and returns its last
+// error.
+func retry(p RetryPolicy, fn func() error) error {
+	if p.Retryable == nil {
+		p.Retryable = IsTransient
+	}
+	start := time.Now()
+	interval := p.InitialInterval
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !p.Retryable(err) ||
+			(p.MaxAttempts > 0 && attempt >= p.MaxAttempts) {
+			return err
+		}
+		wait := interval
+		if p.Jitter > 0 {
+			delta := p.Jitter * float64(interval)
+			wait = time.Duration(float64(interval) - delta + rand.Float64()*2*delta)
+		}
+		if time.Since(start)+wait > p.MaxElapsedTime {
+			return err
+		}
+		time.Sleep(wait)
+		interval = time.Duration(float64(interval) * p.Multiplier)
+		if interval > p.MaxInterval {
+			interval = p.MaxInterval
+		}
+	}
+}
+
+func (r *retryDriver) Mount(volumeID api.VolumeID, mountpath string, opts *api.MountOptions) error {
+	return r.retry(func() error {
+		return r.VolumeDriver.Mount(volumeID, mountpath, opts)
+	})
+}
+
+func (r *retryDriver) Unmount(volumeID api.VolumeID, mountpath string) error {
+	return r.retry(func() error {
+		return r.VolumeDriver.Unmount(volumeID, mountpath)
+	})
+}
+
+func (r *retryDriver) Inspect(volumeIDs []api.VolumeID) ([]api.Volume, error) {
+	var vols []api.Volume
+	err := r.retry(func() (err error) {
+		vols, err = r.VolumeDriver.Inspect(volumeIDs)
+		return err
+	})
+	return vols, err
+}
+
+func (r *retryDriver) Enumerate(locator api.VolumeLocator, labels api.Labels) ([]api.Volume, error) {
+	var vols []api.Volume
+	err := r.retry(func() (err error) {
+		vols, err = r.VolumeDriver.Enumerate(locator, labels)
+		return err
+	})
+	return vols, err
+}
+
+func (r *retryDriver) SnapInspect(snapIDs []api.SnapID) ([]api.VolumeSnap, error) {
+	var snaps []api.VolumeSnap
+	err := r.retry(func() (err error) {
+		snaps, err = r.VolumeDriver.SnapInspect(snapIDs)
+		return err
+	})
+	return snaps, err
+}
+
+func (r *retryDriver) SnapEnumerate(volIDs []api.VolumeID, snapLabels api.Labels) ([]api.VolumeSnap, error) {
+	var snaps []api.VolumeSnap
+	err := r.retry(func() (err error) {
+		snaps, err = r.VolumeDriver.SnapEnumerate(volIDs, snapLabels)
+		return err
+	})
+	return snaps, err
+}
+
+func (r *retryDriver) Stats(volumeID api.VolumeID) (api.VolumeStats, error) {
+	var stats api.VolumeStats
+	err := r.retry(func() (err error) {
+		stats, err = r.VolumeDriver.Stats(volumeID)
+		return err
+	})
+	return stats, err
+}
+
+func (r *retryDriver) Alerts(volumeID api.VolumeID) (api.VolumeAlerts, error) {
+	var alerts api.VolumeAlerts
+	err := r.retry(func() (err error) {
+		alerts, err = r.VolumeDriver.Alerts(volumeID)
+		return err
+	})
+	return alerts, err
+}
@@ -0,0 +1,137 @@
+package volume
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/kvdb"
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// flakyDriver fails the first failures calls to Mount, Unmount and Create.
+type flakyDriver struct {
+	VolumeDriver
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakyDriver) fail() error {
+	f.calls++
+	if f.calls <= f.failures {
+		return f.err
+	}
+	return nil
+}
+
+func (f *flakyDriver) Mount(volumeID api.VolumeID, mountpath string, opts *api.MountOptions) error {
+	return f.fail()
+}
+
+func (f *flakyDriver) Unmount(volumeID api.VolumeID, mountpath string) error {
+	return f.fail()
+}
+
+func (f *flakyDriver) Detach(volumeID api.VolumeID) error {
+	return f.fail()
+}
+
+func (f *flakyDriver) Create(locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (api.VolumeID, error) {
+	return api.BadVolumeID, f.fail()
+}
+
+var testPolicy = RetryPolicy{
+	InitialInterval: time.Millisecond,
+	MaxInterval:     5 * time.Millisecond,
+	Multiplier:      2,
+	Jitter:          0.5,
+	MaxElapsedTime:  time.Second,
+}
+
+func TestRetryTransient(t *testing.T) {
+	f := &flakyDriver{failures: 3, err: &TransientError{errors.New("timeout")}}
+	err := WithRetry(f, testPolicy).Mount(api.VolumeID(volName), "/mnt", nil)
+	assert.NoError(t, err, "Mount should succeed after retries")
+	assert.Equal(t, 4, f.calls, "Mount should be called until it succeeds")
+}
+
+func TestRetryPermanent(t *testing.T) {
+	f := &flakyDriver{failures: 3, err: errors.New("permanent")}
+	err := WithRetry(f, testPolicy).Mount(api.VolumeID(volName), "/mnt", nil)
+	assert.Error(t, err, "Mount should fail on a permanent error")
+	assert.Equal(t, 1, f.calls, "Permanent errors should not be retried")
+}
+
+func TestRetryNotIdempotent(t *testing.T) {
+	f := &flakyDriver{failures: 3, err: &TransientError{errors.New("timeout")}}
+	_, err := WithRetry(f, testPolicy).Create(api.VolumeLocator{}, nil, nil)
+	assert.Error(t, err, "Create should fail")
+	assert.Equal(t, 1, f.calls, "Create should never be retried")
+}
+
+func TestRetryMaxElapsed(t *testing.T) {
+	policy := testPolicy
+	policy.MaxElapsedTime = 20 * time.Millisecond
+	f := &flakyDriver{failures: 1000, err: &TransientError{errors.New("timeout")}}
+	err := WithRetry(f, policy).Mount(api.VolumeID(volName), "/mnt", nil)
+	assert.Error(t, err, "Mount should give up after MaxElapsedTime")
+	assert.True(t, f.calls > 1, "Mount should be retried before giving up")
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err       error
+		transient bool
+	}{
+		{nil, false},
+		{errors.New("permanent"), false},
+		{&TransientError{errors.New("timeout")}, true},
+		{kvdb.ErrValueMismatch, true},
+		{kvdb.ErrNotFound, false},
+		{syscall.EBUSY, true},
+		{syscall.ETIMEDOUT, true},
+		{syscall.ENOENT, false},
+		{&os.PathError{Op: "mount", Path: "/mnt", Err: syscall.EBUSY}, true},
+		{&os.PathError{Op: "mount", Path: "/mnt", Err: syscall.EPERM}, false},
+		{os.NewSyscallError("fork", syscall.EAGAIN), true},
+		{fmt.Errorf("Failed: %v", syscall.EBUSY), false},
+		{&MountError{Source: "/dev/loop0", Target: "/mnt", Err: syscall.EBUSY}, true},
+		{&MountError{Source: "/dev/loop0", Target: "/mnt", Err: syscall.EPERM}, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.transient, IsTransient(tt.err), "IsTransient(%v)", tt.err)
+	}
+}
+
+func TestRetryBusy(t *testing.T) {
+	f := &flakyDriver{failures: 2, err: syscall.EBUSY}
+	err := WithRetry(f, testPolicy).Unmount(api.VolumeID(volName), "/mnt")
+	assert.NoError(t, err, "Unmount should be retried while busy")
+	assert.Equal(t, 3, f.calls, "Unmount should be called until it succeeds")
+}
+
+// trimDriver is a flakyDriver with the optional Trimmer interface.
+type trimDriver struct {
+	flakyDriver
+}
+
+func (d *trimDriver) Trim(volumeID api.VolumeID) (uint64, error) {
+	return 42, nil
+}
+
+func TestRetryUnwrap(t *testing.T) {
+	d := &trimDriver{}
+	r := WithRetry(d, testPolicy)
+	assert.Equal(t, VolumeDriver(d), Unwrap(r), "Unwrap should return the wrapped driver")
+	n, err := Trim(r, api.VolumeID(volName))
+	assert.NoError(t, err, "Optional interfaces should be visible through the wrapper")
+	assert.Equal(t, uint64(42), n)
+}
@@ -0,0 +1,77 @@
+package volume
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// SchemaVersion of volume records written by the DefaultEnumerator.
+	// Records written before versioning was introduced are version 1.
+	SchemaVersion = 2
+)
+
+// MigrateFunc upgrades a volume record in place.
+type MigrateFunc func(v *api.Volume) error
+
+type migration struct {
+	to int
+	fn MigrateFunc
+}
+
+var (
+	migrationLock sync.Mutex
+	migrations    = make(map[int]migration)
+)
+
+// RegisterMigration registers fn to upgrade records at version from to
+// version to. Records are upgraded when read and persisted on next write.
+func RegisterMigration(from, to int, fn MigrateFunc) error {
+	migrationLock.Lock()
+	defer migrationLock.Unlock()
+	if to <= from {
+		return fmt.Errorf("Invalid migration from version %v to %v", from, to)
+	}
+	if _, ok := migrations[from]; ok {
+		return fmt.Errorf("Migration from version %v already registered", from)
+	}
+	migrations[from] = migration{to: to, fn: fn}
+	return nil
+}
+
+// migrate upgrades v to SchemaVersion.
+func migrate(v *api.Volume) error {
+	if v.SchemaVersion == 0 {
+		v.SchemaVersion = 1
+	}
+	migrationLock.Lock()
+	defer migrationLock.Unlock()
+	for v.SchemaVersion < SchemaVersion {
+		m, ok := migrations[v.SchemaVersion]
+		if !ok {
+			return fmt.Errorf("No migration for volume %v from schema version %v",
+				v.ID, v.SchemaVersion)
+		}
+		if err := m.fn(v); err != nil {
+			return err
+		}
+		v.SchemaVersion = m.to
+	}
+	if v.SchemaVersion > SchemaVersion {
+		return fmt.Errorf("Volume %v has unsupported schema version %v",
+			v.ID, v.SchemaVersion)
+	}
+	return nil
+}
+
+func init() {
+	// Version 1 records may have no Spec.
+	RegisterMigration(1, 2, func(v *api.Volume) error {
+		if v.Spec == nil {
+			v.Spec = &api.VolumeSpec{}
+		}
+		return nil
+	})
+}
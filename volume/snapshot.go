@@ -0,0 +1,250 @@
+package volume
+
+import (
+	"fmt"
+	"os/exec"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// Capabilities advertised by a driver, see CapabilityReporter.
+type Capabilities uint32
+
+const (
+	// CapSnapshot driver implements Snapshot natively.
+	CapSnapshot Capabilities = 1 << iota
+	// CapBlock driver exposes volumes as block devices through Attach.
+	CapBlock
+)
+
+var capabilityNames = []string{"snapshot", "block"}
+
+// Names of the capabilities set in c.
+func (c Capabilities) Names() []string {
+	names := []string{}
+	for i, n := range capabilityNames {
+		if c&(1<<uint(i)) != 0 {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// cleanupRetries is the number of attempts to delete a partial snapshot.
+const cleanupRetries = 3
+
+// cleanupPolicy retries the delete of a partial snapshot on any error.
+var cleanupPolicy = RetryPolicy{
+	InitialInterval: 100 * time.Millisecond,
+	MaxInterval:     time.Second,
+	Multiplier:      2,
+	Jitter:          0.2,
+	MaxElapsedTime:  10 * time.Second,
+	MaxAttempts:     cleanupRetries,
+	Retryable:       func(error) bool { return true },
+}
+
+// SnapSourceLabel is set on volumes created by GenericSnapshotter to the ID
+// of the volume they were copied from.
+const SnapSourceLabel = "snapshot_of"
+
+// CapabilityReporter is implemented by drivers that advertise Capabilities.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// GetCapabilities returns the capabilities advertised by d, if any.
+func GetCapabilities(d VolumeDriver) Capabilities {
+	if c, ok := Unwrap(d).(CapabilityReporter); ok {
+		return c.Capabilities()
+	}
+	return 0
+}
+
+// Snapshot volumeID using the driver's native snapshot. Block drivers whose
+// Snapshot returns ErrNotSupported fall back to a copy with
+// GenericSnapshotter.
+func Snapshot(d VolumeDriver, volumeID api.VolumeID, labels api.Labels) (api.SnapID, error) {
+	id, err := d.Snapshot(volumeID, labels)
+	if err != ErrNotSupported || GetCapabilities(d)&CapBlock == 0 {
+		return id, err
+	}
+	return NewGenericSnapshotter(d).Snapshot(volumeID, labels)
+}
+
+// SnapDelete deletes snapID with the driver's native SnapDelete. Snapshots of
+// block drivers whose SnapDelete returns ErrNotSupported were taken by
+// GenericSnapshotter and are deleted by it.
+func SnapDelete(d VolumeDriver, snapID api.SnapID) error {
+	err := d.SnapDelete(snapID)
+	if err != ErrNotSupported || GetCapabilities(d)&CapBlock == 0 {
+		return err
+	}
+	return NewGenericSnapshotter(d).SnapDelete(snapID)
+}
+
+// QuiescedSnapshot snapshots volumeID with Snapshot while its IO is
+// quiesced. Volumes of drivers that cannot quiesce are snapshotted as is.
+func QuiescedSnapshot(d VolumeDriver, volumeID api.VolumeID, labels api.Labels) (api.SnapID, error) {
+	if err := Quiesce(d, volumeID); err == nil {
+		defer Unquiesce(d, volumeID)
+	} else if err != ErrNotSupported {
+		return api.BadSnapID, err
+	}
+	return Snapshot(d, volumeID, labels)
+}
+
+// GenericSnapshotter snapshots volumes of drivers that have no native
+// snapshot by copying the block device into a new volume. The snapshot is
+// recorded with the driver's enumerator, which must store snapshot records
+// like DefaultEnumerator, so that SnapInspect and SnapEnumerate list it.
+type GenericSnapshotter struct {
+	d VolumeDriver
+}
+
+// snapRecorder stores the snapshot records of a GenericSnapshotter.
+type snapRecorder interface {
+	CreateSnap(snap *api.VolumeSnap) error
+	DeleteSnap(snapID api.SnapID) error
+}
+
+func (g *GenericSnapshotter) records() (snapRecorder, error) {
+	if r, ok := Unwrap(g.d).(snapRecorder); ok {
+		return r, nil
+	}
+	return nil, ErrNotSupported
+}
+
+// NewGenericSnapshotter returns a GenericSnapshotter for d.
+func NewGenericSnapshotter(d VolumeDriver) *GenericSnapshotter {
+	return &GenericSnapshotter{d: d}
+}
+
+// Snapshot creates a volume with the spec of volumeID and copies its block
+// device into it. The volume is named after the SnapNameLabel template if
+// set. A snapshot of volumeID is recorded with the ID of the new volume.
+// IO to volumeID should be quiesced before calling this function.
+func (g *GenericSnapshotter) Snapshot(volumeID api.VolumeID, labels api.Labels) (api.SnapID, error) {
+	r, err := g.records()
+	if err != nil {
+		return api.BadSnapID, err
+	}
+	vols, err := g.d.Inspect([]api.VolumeID{volumeID})
+	if err != nil {
+		return api.BadSnapID, err
+	}
+	if len(vols) != 1 {
+		return api.BadSnapID, ErrEnoEnt
+	}
+	src := vols[0]
+
+	template := labels[SnapNameLabel]
+	if template == "" {
+		base := src.Locator.Name
+		if base == "" {
+			base = string(volumeID)
+		}
+		template = base + ".snap-%Y%m%d%H%M%S"
+	}
+	locator := api.VolumeLocator{VolumeLabels: api.Labels{}}
+	name, release, err := UniqueName(g.d, template, time.Now())
+	if err != nil {
+		return api.BadSnapID, err
+	}
+	defer release()
+	locator.Name = name
+	for k, v := range labels {
+		locator.VolumeLabels[k] = v
+	}
+	locator.VolumeLabels[SnapSourceLabel] = string(volumeID)
+	spec := api.VolumeSpec{}
+	if src.Spec != nil {
+		spec = *src.Spec
+	}
+
+	id, err := g.d.Create(locator, &api.CreateOptions{}, &spec)
+	if err != nil {
+		return api.BadSnapID, err
+	}
+	if err = g.copy(&src, id); err != nil {
+		g.cleanup(id)
+		return api.BadSnapID, err
+	}
+	snap := &api.VolumeSnap{
+		ID:         api.SnapID(id),
+		VolumeID:   volumeID,
+		SnapLabels: labels,
+		Ctime:      time.Now(),
+	}
+	if err = r.CreateSnap(snap); err != nil {
+		g.cleanup(id)
+		return api.BadSnapID, err
+	}
+	return snap.ID, nil
+}
+
+// SnapDelete deletes a snapshot taken by Snapshot and the volume that holds
+// its copy.
+func (g *GenericSnapshotter) SnapDelete(snapID api.SnapID) error {
+	r, err := g.records()
+	if err != nil {
+		return err
+	}
+	snaps, err := g.d.SnapInspect([]api.SnapID{snapID})
+	if err != nil || len(snaps) != 1 {
+		return ErrSnapNotFound
+	}
+	if err = g.d.Delete(api.VolumeID(snapID)); err != nil && err != ErrEnoEnt {
+		return err
+	}
+	return r.DeleteSnap(snapID)
+}
+
+// cleanup deletes the partially created snapshot volume id with backoff,
+// up to cleanupRetries times. If it is still there, it is queued for the
+// orphan reaper.
+func (g *GenericSnapshotter) cleanup(id api.VolumeID) {
+	err := retry(cleanupPolicy, func() error {
+		return g.d.Delete(id)
+	})
+	if err != nil && err != ErrEnoEnt {
+		log.Warnf("Failed to delete partial snapshot volume %v, queued for removal: %v",
+			id, err)
+		orphans.add(g.d, id)
+	}
+}
+
+// attach returns the device of volumeID and whether it should be detached
+// once done.
+func (g *GenericSnapshotter) attach(v *api.Volume) (string, bool, error) {
+	dev, err := g.d.Attach(v.ID)
+	if err == ErrVolAttached && v.DevicePath != "" {
+		return v.DevicePath, false, nil
+	}
+	return dev, err == nil, err
+}
+
+func (g *GenericSnapshotter) copy(src *api.Volume, dstID api.VolumeID) error {
+	srcDev, detach, err := g.attach(src)
+	if err != nil {
+		return err
+	}
+	if detach {
+		defer g.d.Detach(src.ID)
+	}
+	dstDev, err := g.d.Attach(dstID)
+	if err != nil {
+		return err
+	}
+	defer g.d.Detach(dstID)
+
+	out, err := exec.Command("dd", "if="+srcDev, "of="+dstDev,
+		"bs=1M", "conv=fsync").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Failed to copy %v to %v: %v: %s", srcDev, dstDev, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package volume
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// copyFailDriver creates volumes that cannot be attached, drops snapshot
+// records and fails the first deleteFailures deletes.
+type copyFailDriver struct {
+	VolumeDriver
+	deleteFailures int
+	deletes        int
+}
+
+var errAttach = errors.New("attach failed")
+
+func (c *copyFailDriver) Inspect(ids []api.VolumeID) ([]api.Volume, error) {
+	return []api.Volume{{ID: ids[0], Spec: &api.VolumeSpec{}}}, nil
+}
+
+func (c *copyFailDriver) Enumerate(locator api.VolumeLocator, labels api.Labels) ([]api.Volume, error) {
+	return nil, nil
+}
+
+func (c *copyFailDriver) Create(locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (api.VolumeID, error) {
+	return api.VolumeID("copy"), nil
+}
+
+func (c *copyFailDriver) Attach(volumeID api.VolumeID) (string, error) {
+	return "", errAttach
+}
+
+func (c *copyFailDriver) CreateSnap(snap *api.VolumeSnap) error {
+	return nil
+}
+
+func (c *copyFailDriver) DeleteSnap(snapID api.SnapID) error {
+	return nil
+}
+
+func (c *copyFailDriver) Delete(volumeID api.VolumeID) error {
+	c.deletes++
+	if c.deletes <= c.deleteFailures {
+		return errors.New("delete failed")
+	}
+	return nil
+}
+
+func TestGenericSnapshotCleanup(t *testing.T) {
+	policy := cleanupPolicy
+	defer func() { cleanupPolicy = policy }()
+	cleanupPolicy.InitialInterval = time.Millisecond
+	cleanupPolicy.MaxInterval = time.Millisecond
+	interval := orphanReapInterval
+	defer func() { orphanReapInterval = interval }()
+	orphanReapInterval = time.Hour
+
+	d := &copyFailDriver{deleteFailures: 1}
+	_, err := NewGenericSnapshotter(d).Snapshot("source", nil)
+	assert.Equal(t, errAttach, err, "The copy error should be returned")
+	assert.Equal(t, 2, d.deletes, "Delete should be retried until it succeeds")
+
+	d = &copyFailDriver{deleteFailures: cleanupRetries}
+	_, err = NewGenericSnapshotter(d).Snapshot("source", nil)
+	assert.Equal(t, errAttach, err, "The copy error should be returned")
+	assert.Equal(t, cleanupRetries, d.deletes, "Delete should give up after retries")
+	assert.Equal(t, []api.VolumeID{"copy"}, Orphans(), "The orphan should be queued")
+
+	orphans.reap()
+	assert.Equal(t, cleanupRetries+1, d.deletes, "The reaper should delete the orphan")
+	assert.Equal(t, 0, len(Orphans()), "The orphan should be dequeued")
+}
+
+// fileDriver keeps its volumes in files of dir, attached as themselves.
+type fileDriver struct {
+	*DefaultEnumerator
+	ProtoDriver
+	dir string
+}
+
+func (f *fileDriver) Create(locator api.VolumeLocator,
+	options *api.CreateOptions,
+	spec *api.VolumeSpec) (api.VolumeID, error) {
+	id := api.VolumeID("file-" + locator.Name)
+	if err := ioutil.WriteFile(filepath.Join(f.dir, string(id)), nil, 0644); err != nil {
+		return api.BadVolumeID, err
+	}
+	return id, f.CreateVol(&api.Volume{ID: id, Locator: locator, Spec: spec})
+}
+
+func (f *fileDriver) Attach(volumeID api.VolumeID) (string, error) {
+	return filepath.Join(f.dir, string(volumeID)), nil
+}
+
+func (f *fileDriver) Format(volumeID api.VolumeID) error {
+	return nil
+}
+
+func (f *fileDriver) Detach(volumeID api.VolumeID) error {
+	return nil
+}
+
+func (f *fileDriver) Delete(volumeID api.VolumeID) error {
+	os.Remove(filepath.Join(f.dir, string(volumeID)))
+	return f.DeleteVol(volumeID)
+}
+
+func (f *fileDriver) Capabilities() Capabilities {
+	return CapBlock
+}
+
+func (f *fileDriver) Snapshot(volumeID api.VolumeID, labels api.Labels) (api.SnapID, error) {
+	return api.BadSnapID, ErrNotSupported
+}
+
+func (f *fileDriver) SnapDelete(snapID api.SnapID) error {
+	return ErrNotSupported
+}
+
+func TestGenericSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generic")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	d := &fileDriver{DefaultEnumerator: NewDefaultEnumerator("generic_test", store.kvdb), dir: dir}
+	src, err := d.Create(api.VolumeLocator{Name: "src"}, nil, &api.VolumeSpec{})
+	assert.NoError(t, err, "Failed in Create")
+	defer d.Delete(src)
+	err = ioutil.WriteFile(filepath.Join(dir, string(src)), []byte("data"), 0644)
+	assert.NoError(t, err)
+
+	id, err := Snapshot(d, src, api.Labels{SnapNameLabel: "nightly"})
+	assert.NoError(t, err, "Failed in Snapshot")
+	snaps, err := d.SnapEnumerate([]api.VolumeID{src}, nil)
+	assert.NoError(t, err, "Failed in SnapEnumerate")
+	if assert.Equal(t, 1, len(snaps), "The snapshot should be recorded") {
+		assert.Equal(t, id, snaps[0].ID)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, string(id)))
+	assert.NoError(t, err, "The copy should be kept in a volume")
+	assert.Equal(t, "data", string(data))
+
+	err = SnapDelete(d, id)
+	assert.NoError(t, err, "Failed in SnapDelete")
+	snaps, err = d.SnapEnumerate([]api.VolumeID{src}, nil)
+	assert.NoError(t, err, "Failed in SnapEnumerate")
+	assert.Equal(t, 0, len(snaps), "The snapshot record should be deleted")
+	_, err = d.GetVol(api.VolumeID(id))
+	assert.Error(t, err, "The copy should be deleted")
+}
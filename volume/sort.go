@@ -0,0 +1,131 @@
+package volume
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// SortKey selects the volume attribute EnumerateSorted orders by.
+type SortKey string
+
+const (
+	// SortBySize orders by Spec.Size, or by the usage measured with Stats if
+	// EnumerateOptions.Usage is set. Largest first.
+	SortBySize = SortKey("size")
+	// SortByCtime orders by creation time, newest first.
+	SortByCtime = SortKey("ctime")
+	// SortByName orders by locator name, alphabetically.
+	SortByName = SortKey("name")
+)
+
+// EnumerateOptions control the order and number of volumes returned by
+// EnumerateSorted.
+type EnumerateOptions struct {
+	// SortBy attribute, unsorted if empty.
+	SortBy SortKey
+	// Limit number of volumes returned, all if 0.
+	Limit int
+	// Usage sorts by the bytes used on disk, as measured by Stats, instead
+	// of the provisioned size. The enumerator must implement Stats.
+	Usage bool
+}
+
+// statser is implemented by drivers that measure the usage of volumes.
+type statser interface {
+	Stats(volumeID api.VolumeID) (api.VolumeStats, error)
+}
+
+type volumeSorter struct {
+	vols []api.Volume
+	less func(a, b *api.Volume) bool
+}
+
+func (s *volumeSorter) Len() int      { return len(s.vols) }
+func (s *volumeSorter) Swap(i, j int) { s.vols[i], s.vols[j] = s.vols[j], s.vols[i] }
+func (s *volumeSorter) Less(i, j int) bool {
+	a, b := &s.vols[i], &s.vols[j]
+	if s.less(a, b) {
+		return true
+	}
+	if s.less(b, a) {
+		return false
+	}
+	return a.ID < b.ID
+}
+
+// volumeSizes returns the size of each volume by ID, measured with Stats if
+// usage is set. The recorded Usage is used for volumes without Stats.
+func volumeSizes(e Enumerator, vols []api.Volume, usage bool) (map[api.VolumeID]uint64, error) {
+	sizes := make(map[api.VolumeID]uint64, len(vols))
+	var s statser
+	if usage {
+		var ok bool
+		if s, ok = e.(statser); !ok {
+			return nil, ErrNotSupported
+		}
+	}
+	for i := range vols {
+		v := &vols[i]
+		switch {
+		case usage:
+			stats, err := s.Stats(v.ID)
+			switch err {
+			case nil:
+				sizes[v.ID] = stats.PhysicalBytes
+			case ErrNotSupported:
+				sizes[v.ID] = v.Usage
+			default:
+				return nil, err
+			}
+		case v.Spec != nil:
+			sizes[v.ID] = v.Spec.Size
+		}
+	}
+	return sizes, nil
+}
+
+// EnumerateSorted enumerates volumes matching locator and labels, ordered
+// and limited by opts. Volumes that compare equal are ordered by ID so the
+// result is stable across calls.
+func EnumerateSorted(
+	e Enumerator,
+	locator api.VolumeLocator,
+	labels api.Labels,
+	opts EnumerateOptions) ([]api.Volume, error) {
+
+	vols, err := e.Enumerate(locator, labels)
+	if err != nil {
+		return nil, err
+	}
+	s := &volumeSorter{vols: vols}
+	switch opts.SortBy {
+	case "":
+	case SortBySize:
+		sizes, err := volumeSizes(e, vols, opts.Usage)
+		if err != nil {
+			return nil, err
+		}
+		s.less = func(a, b *api.Volume) bool { return sizes[a.ID] > sizes[b.ID] }
+	case SortByCtime:
+		s.less = func(a, b *api.Volume) bool { return a.Ctime.After(b.Ctime) }
+	case SortByName:
+		s.less = func(a, b *api.Volume) bool { return a.Locator.Name < b.Locator.Name }
+	default:
+		return nil, fmt.Errorf("Unknown sort key %q", opts.SortBy)
+	}
+	if s.less != nil {
+		sort.Sort(s)
+	}
+	if opts.Limit > 0 && len(vols) > opts.Limit {
+		vols = vols[:opts.Limit]
+	}
+	return vols, nil
+}
+
+// TopBySize returns the n largest volumes by provisioned size.
+func TopBySize(e Enumerator, n int) ([]api.Volume, error) {
+	return EnumerateSorted(e, api.VolumeLocator{}, nil,
+		EnumerateOptions{SortBy: SortBySize, Limit: n})
+}
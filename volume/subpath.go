@@ -0,0 +1,142 @@
+package volume
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// ResolveSubPath returns the directory to mount for opts given the volume
+// is rooted at root. The root is returned if opts has no SubPath. The
+// subpath is created if it is missing and opts.CreateSubPath is set. A
+// subpath that resolves outside of root, through ".." or a symlink, is an
+// error.
+func ResolveSubPath(root string, opts *api.MountOptions) (string, error) {
+	if opts == nil || opts.SubPath == "" {
+		return root, nil
+	}
+	dir := filepath.Join(root, filepath.Clean("/"+opts.SubPath))
+	if _, err := os.Stat(dir); os.IsNotExist(err) && opts.CreateSubPath {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("Invalid subpath %q: %v", opts.SubPath, err)
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	if real != realRoot && !strings.HasPrefix(real, realRoot+string(filepath.Separator)) {
+		return "", fmt.Errorf("Subpath %q is outside of the volume", opts.SubPath)
+	}
+	if fi, err := os.Stat(real); err != nil || !fi.IsDir() {
+		return "", fmt.Errorf("Subpath %q is not a directory", opts.SubPath)
+	}
+	return real, nil
+}
+
+// AddMountPath returns paths with mountpath added unless it is already in
+// paths. Drivers keep the subpath mounts of a volume in its record with it.
+func AddMountPath(paths []string, mountpath string) []string {
+	for _, p := range paths {
+		if p == mountpath {
+			return paths
+		}
+	}
+	return append(paths, mountpath)
+}
+
+// RemoveMountPath returns paths without mountpath, and false if mountpath
+// is not in paths.
+func RemoveMountPath(paths []string, mountpath string) ([]string, bool) {
+	for i, p := range paths {
+		if p == mountpath {
+			return append(paths[:i:i], paths[i+1:]...), true
+		}
+	}
+	return paths, false
+}
+
+// MountedPaths returns the paths that are still mount points, for records
+// that outlived their mounts across a reboot. Paths that cannot be checked
+// are kept.
+func MountedPaths(paths []string) []string {
+	var mounted []string
+	for _, p := range paths {
+		if ok, err := IsMountPoint(p); err != nil || ok {
+			mounted = append(mounted, p)
+		}
+	}
+	return mounted
+}
+
+// SubPathMounts tracks the paths volumes are mounted at apart from their
+// records, so unmounting one leaves the others and the volume's own mount
+// alone.
+type SubPathMounts struct {
+	sync.Mutex
+	paths map[api.VolumeID]map[string]bool
+}
+
+// Add records volumeID mounted at mountpath and returns the number of
+// subpath mounts of the volume.
+func (s *SubPathMounts) Add(volumeID api.VolumeID, mountpath string) int {
+	s.Lock()
+	defer s.Unlock()
+	if s.paths == nil {
+		s.paths = make(map[api.VolumeID]map[string]bool)
+	}
+	if s.paths[volumeID] == nil {
+		s.paths[volumeID] = make(map[string]bool)
+	}
+	s.paths[volumeID][mountpath] = true
+	return len(s.paths[volumeID])
+}
+
+// Remove forgets the mount of volumeID at mountpath. It returns false if
+// mountpath is not a subpath mount of the volume.
+func (s *SubPathMounts) Remove(volumeID api.VolumeID, mountpath string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if !s.paths[volumeID][mountpath] {
+		return false
+	}
+	delete(s.paths[volumeID], mountpath)
+	if len(s.paths[volumeID]) == 0 {
+		delete(s.paths, volumeID)
+	}
+	return true
+}
+
+// Has returns true if volumeID has a subpath mounted at mountpath.
+func (s *SubPathMounts) Has(volumeID api.VolumeID, mountpath string) bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.paths[volumeID][mountpath]
+}
+
+// Clear forgets all subpath mounts of volumeID and returns their paths.
+func (s *SubPathMounts) Clear(volumeID api.VolumeID) []string {
+	s.Lock()
+	defer s.Unlock()
+	paths := make([]string, 0, len(s.paths[volumeID]))
+	for p := range s.paths[volumeID] {
+		paths = append(paths, p)
+	}
+	delete(s.paths, volumeID)
+	return paths
+}
+
+// Count returns the number of subpath mounts of volumeID.
+func (s *SubPathMounts) Count(volumeID api.VolumeID) int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.paths[volumeID])
+}
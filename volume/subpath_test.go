@@ -0,0 +1,67 @@
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestResolveSubPath(t *testing.T) {
+	root, err := ioutil.TempDir("", "subpath")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	root, err = filepath.EvalSymlinks(root)
+	assert.NoError(t, err)
+
+	dir, err := ResolveSubPath(root, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, root, dir)
+
+	_, err = ResolveSubPath(root, &api.MountOptions{SubPath: "a/b"})
+	assert.Error(t, err)
+	dir, err = ResolveSubPath(root, &api.MountOptions{SubPath: "a/b", CreateSubPath: true})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "a/b"), dir)
+
+	dir, err = ResolveSubPath(root, &api.MountOptions{SubPath: "../../a"})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "a"), dir)
+
+	assert.NoError(t, os.Symlink("/", filepath.Join(root, "escape")))
+	_, err = ResolveSubPath(root, &api.MountOptions{SubPath: "escape"})
+	assert.Error(t, err)
+}
+
+func TestSubPathMounts(t *testing.T) {
+	var s SubPathMounts
+	assert.Equal(t, 1, s.Add("v1", "/mnt/a"))
+	assert.Equal(t, 2, s.Add("v1", "/mnt/b"))
+	assert.True(t, s.Remove("v1", "/mnt/a"))
+	assert.False(t, s.Remove("v1", "/mnt/a"))
+	assert.True(t, s.Has("v1", "/mnt/b"))
+	assert.Equal(t, 1, s.Count("v1"))
+}
+
+func TestMountPaths(t *testing.T) {
+	paths := AddMountPath(nil, "/mnt/a")
+	paths = AddMountPath(paths, "/mnt/b")
+	paths = AddMountPath(paths, "/mnt/a")
+	assert.Equal(t, []string{"/mnt/a", "/mnt/b"}, paths)
+
+	rest, ok := RemoveMountPath(paths, "/mnt/a")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"/mnt/b"}, rest)
+	assert.Equal(t, []string{"/mnt/a", "/mnt/b"}, paths, "Input should be unchanged")
+	_, ok = RemoveMountPath(rest, "/mnt/a")
+	assert.False(t, ok)
+
+	dir, err := ioutil.TempDir("", "mountpaths")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.Empty(t, MountedPaths([]string{dir}), "A plain directory is not mounted")
+}
@@ -0,0 +1,85 @@
+package volume
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+var (
+	tagKeysLock sync.Mutex
+	// DefaultTagKeys are the tag keys allowed unless SetTagKeys is called.
+	DefaultTagKeys = []string{"cost-center", "project"}
+	tagKeys        = DefaultTagKeys
+)
+
+// SetTagKeys replaces the keys allowed in volume tags.
+func SetTagKeys(keys []string) {
+	tagKeysLock.Lock()
+	defer tagKeysLock.Unlock()
+	tagKeys = append([]string{}, keys...)
+}
+
+// TagKeys returns the keys allowed in volume tags.
+func TagKeys() []string {
+	tagKeysLock.Lock()
+	defer tagKeysLock.Unlock()
+	return append([]string{}, tagKeys...)
+}
+
+// ValidateTags returns an error if a key of tags is not allowed or a value
+// is empty.
+func ValidateTags(tags api.Labels) error {
+	allowed := TagKeys()
+	for k, v := range tags {
+		found := false
+		for _, a := range allowed {
+			if k == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Tag %q is not one of %v", k, allowed)
+		}
+		if v == "" {
+			return fmt.Errorf("Tag %q has no value", k)
+		}
+	}
+	return nil
+}
+
+// ReportUsageByTag sums the volumes of d and their capacity by the value of
+// tag. Volumes without the tag are counted under "".
+func ReportUsageByTag(d Enumerator, tag string) (map[string]api.UsageSummary, error) {
+	vols, err := d.Enumerate(api.VolumeLocator{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	report := make(map[string]api.UsageSummary)
+	for _, v := range vols {
+		s := report[v.Tags[tag]]
+		s.Volumes++
+		if v.Spec != nil {
+			s.Capacity += v.Spec.Size
+		}
+		s.Usage += v.Usage
+		report[v.Tags[tag]] = s
+	}
+	return report, nil
+}
+
+// UpdateTags replaces the tags of volID.
+func (e *DefaultEnumerator) UpdateTags(volID api.VolumeID, tags api.Labels) error {
+	if err := e.CheckWritable(); err != nil {
+		return err
+	}
+	if err := ValidateTags(tags); err != nil {
+		return err
+	}
+	return e.compareAndUpdate(volID, func(v *api.Volume) (bool, error) {
+		v.Tags = tags
+		return true, nil
+	})
+}
@@ -0,0 +1,49 @@
+package volume
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestValidateTags(t *testing.T) {
+	assert.NoError(t, ValidateTags(nil))
+	assert.NoError(t, ValidateTags(api.Labels{"project": "db"}))
+	assert.Error(t, ValidateTags(api.Labels{"owner": "me"}), "Unknown tag key")
+	assert.Error(t, ValidateTags(api.Labels{"project": ""}), "Empty tag value")
+
+	SetTagKeys([]string{"owner"})
+	defer SetTagKeys(DefaultTagKeys)
+	assert.NoError(t, ValidateTags(api.Labels{"owner": "me"}))
+	assert.Error(t, ValidateTags(api.Labels{"project": "db"}), "Tag key no longer allowed")
+}
+
+func TestReportUsageByTag(t *testing.T) {
+	vols := []api.Volume{
+		{ID: "a", Spec: &api.VolumeSpec{Size: 10}, Usage: 1,
+			Tags: api.Labels{"project": "db"}},
+		{ID: "b", Spec: &api.VolumeSpec{Size: 20}, Usage: 2,
+			Tags: api.Labels{"project": "db"}},
+		{ID: "c", Spec: &api.VolumeSpec{Size: 5}},
+	}
+	for i := range vols {
+		assert.NoError(t, store.CreateVol(&vols[i]), "Failed in CreateVol")
+		defer store.DeleteVol(vols[i].ID)
+	}
+
+	err := store.UpdateTags("c", api.Labels{"project": "web"})
+	assert.NoError(t, err, "Failed in UpdateTags")
+	err = store.UpdateTags("c", api.Labels{"owner": "me"})
+	assert.Error(t, err, "UpdateTags should validate tags")
+
+	report, err := ReportUsageByTag(store, "project")
+	assert.NoError(t, err, "Failed in ReportUsageByTag")
+	assert.Equal(t, api.UsageSummary{Volumes: 2, Capacity: 30, Usage: 3}, report["db"])
+	assert.Equal(t, api.UsageSummary{Volumes: 1, Capacity: 5}, report["web"])
+
+	report, err = ReportUsageByTag(store, "cost-center")
+	assert.NoError(t, err, "Failed in ReportUsageByTag")
+	assert.Equal(t, 3, report[""].Volumes, "Untagged volumes")
+}
@@ -0,0 +1,109 @@
+package volume
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const (
+	// IopsLimitLabel in VolumeSpec.ConfigLabels limits the read and the
+	// write operations per second of a volume, each.
+	IopsLimitLabel = "iops-limit"
+	// BpsLimitLabel in VolumeSpec.ConfigLabels limits the bytes read and
+	// the bytes written per second of a volume, each.
+	BpsLimitLabel = "bps-limit"
+	// IOCgroupLabel in VolumeSpec.ConfigLabels names the cgroup, under
+	// /sys/fs/cgroup, the IO limits of a volume are applied in instead of
+	// the one configured for the driver. Limits only throttle the processes
+	// in that cgroup: the blkio cgroup of the workload on cgroup v1, a
+	// cgroup that is not the root on cgroup v2.
+	IOCgroupLabel = "io-cgroup"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// IOLimits of a volume, 0 is unlimited.
+type IOLimits struct {
+	Iops uint64
+	Bps  uint64
+}
+
+// Limited returns true if any limit is set.
+func (l IOLimits) Limited() bool {
+	return l.Iops != 0 || l.Bps != 0
+}
+
+// GetIOLimits returns the limits set by the labels of spec.
+func GetIOLimits(spec *api.VolumeSpec) (IOLimits, error) {
+	var l IOLimits
+	if spec == nil {
+		return l, nil
+	}
+	for label, limit := range map[string]*uint64{
+		IopsLimitLabel: &l.Iops,
+		BpsLimitLabel:  &l.Bps,
+	} {
+		v, ok := spec.ConfigLabels[label]
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return IOLimits{}, fmt.Errorf("Invalid %v %q", label, v)
+		}
+		*limit = n
+	}
+	return l, nil
+}
+
+// GetIOCgroup returns the cgroup set by the labels of spec, or dflt if
+// none is set. An empty result means there is no cgroup to throttle in.
+func GetIOCgroup(spec *api.VolumeSpec, dflt string) (string, error) {
+	if spec == nil {
+		return dflt, nil
+	}
+	cgroup, ok := spec.ConfigLabels[IOCgroupLabel]
+	if !ok {
+		return dflt, nil
+	}
+	clean := path.Clean(cgroup)
+	if clean != cgroup || !strings.HasPrefix(clean, cgroupRoot+"/") {
+		return "", fmt.Errorf("Invalid %v %q, must be a clean path under %v",
+			IOCgroupLabel, cgroup, cgroupRoot)
+	}
+	return clean, nil
+}
+
+// SetIOLimitLabels stores l in the labels of spec.
+func SetIOLimitLabels(spec *api.VolumeSpec, l IOLimits) {
+	if spec.ConfigLabels == nil {
+		spec.ConfigLabels = make(api.Labels)
+	}
+	for label, limit := range map[string]uint64{
+		IopsLimitLabel: l.Iops,
+		BpsLimitLabel:  l.Bps,
+	} {
+		if limit == 0 {
+			delete(spec.ConfigLabels, label)
+		} else {
+			spec.ConfigLabels[label] = strconv.FormatUint(limit, 10)
+		}
+	}
+}
+
+// CheckNoIOLimits returns ErrNotSupported if spec sets IO limits, for
+// drivers whose volumes are not block devices that can be throttled.
+func CheckNoIOLimits(spec *api.VolumeSpec) error {
+	l, err := GetIOLimits(spec)
+	if err != nil {
+		return err
+	}
+	if l.Limited() {
+		return ErrNotSupported
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package volume
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestIOLimits(t *testing.T) {
+	spec := &api.VolumeSpec{ConfigLabels: api.Labels{IopsLimitLabel: "500"}}
+	l, err := GetIOLimits(spec)
+	assert.NoError(t, err)
+	assert.Equal(t, IOLimits{Iops: 500}, l)
+	assert.Equal(t, ErrNotSupported, CheckNoIOLimits(spec))
+
+	SetIOLimitLabels(spec, IOLimits{Bps: 1 << 20})
+	l, err = GetIOLimits(spec)
+	assert.NoError(t, err)
+	assert.Equal(t, IOLimits{Bps: 1 << 20}, l)
+
+	spec.ConfigLabels[BpsLimitLabel] = "fast"
+	_, err = GetIOLimits(spec)
+	assert.Error(t, err)
+	assert.NoError(t, CheckNoIOLimits(nil))
+}
+
+func TestIOCgroup(t *testing.T) {
+	cgroup, err := GetIOCgroup(nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "", cgroup, "No cgroup by default")
+
+	spec := &api.VolumeSpec{}
+	cgroup, err = GetIOCgroup(spec, "/sys/fs/cgroup/blkio/db")
+	assert.NoError(t, err)
+	assert.Equal(t, "/sys/fs/cgroup/blkio/db", cgroup, "Driver cgroup")
+
+	spec.ConfigLabels = api.Labels{IOCgroupLabel: "/sys/fs/cgroup/tenant.slice"}
+	cgroup, err = GetIOCgroup(spec, "/sys/fs/cgroup/blkio/db")
+	assert.NoError(t, err)
+	assert.Equal(t, "/sys/fs/cgroup/tenant.slice", cgroup, "Volume cgroup")
+
+	for _, bad := range []string{"/sys/fs/cgroup", "/etc", "/sys/fs/cgroup/../../etc", "tenant"} {
+		spec.ConfigLabels[IOCgroupLabel] = bad
+		_, err = GetIOCgroup(spec, "")
+		assert.Error(t, err, "Cgroup %q should be rejected", bad)
+	}
+}
@@ -0,0 +1,95 @@
+package volume
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+const mountInfo = "/proc/self/mountinfo"
+
+// IsMountPoint returns true if path is currently a mount point.
+func IsMountPoint(path string) (bool, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	f, err := os.Open(mountInfo)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) > 4 && unescapeMountPath(fields[4]) == path {
+			return true, nil
+		}
+	}
+	return false, s.Err()
+}
+
+// unescapeMountPath decodes the octal escapes used in mountinfo.
+func unescapeMountPath(p string) string {
+	if !strings.Contains(p, "\\") {
+		return p
+	}
+	var b []byte
+	for i := 0; i < len(p); i++ {
+		if p[i] == '\\' && i+3 < len(p) {
+			if c, err := strconv.ParseUint(p[i+1:i+4], 8, 8); err == nil {
+				b = append(b, byte(c))
+				i += 3
+				continue
+			}
+		}
+		b = append(b, p[i])
+	}
+	return string(b)
+}
+
+// GetVolVerified reads volID like GetVol and reconciles the record with the
+// host. An AttachPath that is no longer mounted is cleared. If DevicePath is
+// gone the volume is marked NotPresent and ErrVolBackingGone is returned with
+// the volume. Corrections are persisted unless in read-only mode.
+func (e *DefaultEnumerator) GetVolVerified(volID api.VolumeID) (*api.Volume, error) {
+	v, err := e.GetVol(volID)
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	gone := false
+	if v.DevicePath != "" {
+		if _, err = os.Stat(v.DevicePath); os.IsNotExist(err) {
+			gone = true
+			if v.Status != api.NotPresent || v.State != api.VolumeError {
+				v.Status = api.NotPresent
+				v.State = api.VolumeError
+				changed = true
+			}
+		}
+	}
+	if v.AttachPath != "" {
+		if mounted, err := IsMountPoint(v.AttachPath); err == nil && !mounted {
+			v.AttachPath = ""
+			changed = true
+		}
+	}
+	if mounted := MountedPaths(v.SubPathMounts); len(mounted) != len(v.SubPathMounts) {
+		v.SubPathMounts = mounted
+		changed = true
+	}
+	if changed && !e.ReadOnly() {
+		if err = e.UpdateVol(v); err != nil {
+			return nil, err
+		}
+	}
+	if gone {
+		return v, ErrVolBackingGone
+	}
+	return v, nil
+}
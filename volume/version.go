@@ -0,0 +1,69 @@
+package volume
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// VersionMismatchError is returned when data written by one driver version
+// cannot be used by another.
+type VersionMismatchError struct {
+	Local  api.DriverVersion
+	Remote api.DriverVersion
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("Driver version mismatch: %v with features %v cannot read data from %v with features %v",
+		e.Local, e.Local.Features, e.Remote, e.Remote.Features)
+}
+
+// GetDriverVersion returns the version of d if it is a Versioner, otherwise
+// returns ErrNotSupported.
+func GetDriverVersion(d VolumeDriver) (api.DriverVersion, error) {
+	if v, ok := Unwrap(d).(Versioner); ok {
+		return v.Version(), nil
+	}
+	return api.DriverVersion{}, ErrNotSupported
+}
+
+// VersionStatus is the Status entry describing a driver version.
+func VersionStatus(v api.DriverVersion) [2]string {
+	return [2]string{"Driver Version", v.String()}
+}
+
+func majorVersion(v string) string {
+	return strings.SplitN(strings.TrimPrefix(v, "v"), ".", 2)[0]
+}
+
+// CompatibleWith returns true if a driver at version local can use data
+// written at version other: the drivers and their major versions match and
+// local has every feature of other.
+func CompatibleWith(local, other api.DriverVersion) bool {
+	if local.Driver != other.Driver || majorVersion(local.Version) != majorVersion(other.Version) {
+		return false
+	}
+	for _, f := range other.Features {
+		found := false
+		for _, lf := range local.Features {
+			if lf == f {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckCompatible returns a VersionMismatchError if local cannot use data
+// written at version other.
+func CheckCompatible(local, other api.DriverVersion) error {
+	if !CompatibleWith(local, other) {
+		return &VersionMismatchError{Local: local, Remote: other}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package volume
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+func TestCompatibleWith(t *testing.T) {
+	local := api.DriverVersion{Driver: "btrfs", Version: "1.2.0", Features: []string{"a", "b"}}
+	assert.True(t, CompatibleWith(local, api.DriverVersion{Driver: "btrfs", Version: "1.0.3"}))
+	assert.True(t, CompatibleWith(local, api.DriverVersion{Driver: "btrfs", Version: "v1.3", Features: []string{"b"}}))
+	assert.False(t, CompatibleWith(local, api.DriverVersion{Driver: "btrfs", Version: "2.0.0"}))
+	assert.False(t, CompatibleWith(local, api.DriverVersion{Driver: "nfs", Version: "1.2.0"}))
+	assert.False(t, CompatibleWith(local, api.DriverVersion{Driver: "btrfs", Version: "1.2.0", Features: []string{"c"}}))
+
+	err := CheckCompatible(local, api.DriverVersion{Driver: "btrfs", Version: "2.0.0"})
+	_, ok := err.(*VersionMismatchError)
+	assert.True(t, ok, "Expected a VersionMismatchError, got %v", err)
+}
+
+// infoDriver reports a version and capabilities.
+type infoDriver struct {
+	VolumeDriver
+}
+
+func (i *infoDriver) Version() api.DriverVersion {
+	return api.DriverVersion{Driver: "infotest", Version: "1.0.0"}
+}
+
+func (i *infoDriver) Capabilities() Capabilities {
+	return CapSnapshot | CapBlock
+}
+
+func (i *infoDriver) Status() [][2]string {
+	return [][2]string{{"Home", "/tmp"}}
+}
+
+func TestInfo(t *testing.T) {
+	err := Register("infotest", Block, func(params DriverParams) (VolumeDriver, error) {
+		return &infoDriver{}, nil
+	})
+	assert.NoError(t, err, "Failed in Register")
+	_, err = New("infotest-a", nil)
+	assert.NoError(t, err, "Failed in New")
+	assert.Contains(t, Instances(), "infotest-a")
+
+	info, err := Info("infotest-a", false)
+	assert.NoError(t, err, "Failed in Info")
+	assert.Equal(t, string(Block), info.Type)
+	assert.Equal(t, []string{"snapshot", "block"}, info.Capabilities)
+	assert.Equal(t, "1.0.0", info.Version.Version)
+	assert.Nil(t, info.Status, "Status should only be set on request")
+
+	info, err = Info("infotest-a", true)
+	assert.NoError(t, err, "Failed in Info")
+	assert.Equal(t, 1, len(info.Status))
+
+	_, err = Info("infotest-b", false)
+	assert.Equal(t, ErrDriverNotFound, err)
+}
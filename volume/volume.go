@@ -2,26 +2,105 @@ package volume
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/libopenstorage/openstorage/api"
 )
 
 var (
-	instances         map[string]VolumeDriver
-	drivers           map[string]InitFunc
-	mutex             sync.Mutex
-	ErrExist          = errors.New("Driver already exists")
-	ErrDriverNotFound = errors.New("Driver implementation not found")
-	ErrEnoEnt         = errors.New("Volume does not exist.")
-	ErrVolDetached    = errors.New("Volume is detached")
-	ErrVolAttached    = errors.New("Volume is attached")
-	ErrVolHasSnaps    = errors.New("Volume has snapshots associated")
-	ErrNotSupported   = errors.New("Operation not supported")
+	instances                  map[string]VolumeDriver
+	drivers                    map[string]InitFunc
+	driverTypes                map[string]DriverType
+	mutex                      sync.Mutex
+	ErrExist                   = errors.New("Driver already exists")
+	ErrDriverNotFound          = errors.New("Driver implementation not found")
+	ErrEnoEnt                  = errors.New("Volume does not exist.")
+	ErrVolDetached             = errors.New("Volume is detached")
+	ErrVolAttached             = errors.New("Volume is attached")
+	ErrVolHasSnaps             = errors.New("Volume has snapshots associated")
+	ErrNotSupported            = errors.New("Operation not supported")
+	ErrFsNotSupported          = errors.New("Filesystem format not supported")
+	ErrSnapNotFound            = errors.New("Snapshot does not exist")
+	ErrReadOnlyMode            = errors.New("Driver is in read-only mode")
+	ErrVolBackingGone          = errors.New("Volume backing store does not exist")
+	ErrVolumeAttachedElsewhere = errors.New("Volume is attached on another node")
+	ErrQuotaExceeded           = errors.New("Volume quota exceeded")
+	ErrVolumeBusy              = errors.New("Volume is mounted")
 )
 
+// ErrorKinds names the errors above so that they can be told apart by the
+// clients of a remote driver.
+var ErrorKinds = map[string]error{
+	"VolumeNotFound":          ErrEnoEnt,
+	"SnapshotNotFound":        ErrSnapNotFound,
+	"DriverNotFound":          ErrDriverNotFound,
+	"Exists":                  ErrExist,
+	"VolumeAttached":          ErrVolAttached,
+	"VolumeDetached":          ErrVolDetached,
+	"VolumeHasSnapshots":      ErrVolHasSnaps,
+	"NotSupported":            ErrNotSupported,
+	"FilesystemNotSupported":  ErrFsNotSupported,
+	"ReadOnlyMode":            ErrReadOnlyMode,
+	"VolumeBackingGone":       ErrVolBackingGone,
+	"VolumeAttachedElsewhere": ErrVolumeAttachedElsewhere,
+	"QuotaExceeded":           ErrQuotaExceeded,
+	"VolumeBusy":              ErrVolumeBusy,
+}
+
+// kindErr is an error of one of the ErrorKinds with a more specific message.
+type kindErr struct {
+	kind error
+	msg  string
+}
+
+func (e *kindErr) Error() string {
+	return e.msg
+}
+
+// KindErrorf formats an error that keeps the kind of the error kind, one of
+// the errors above.
+func KindErrorf(kind error, format string, a ...interface{}) error {
+	return &kindErr{kind: kind, msg: fmt.Sprintf(format, a...)}
+}
+
+// ErrorKind returns the name of err in ErrorKinds, "" if it has none.
+func ErrorKind(err error) string {
+	if k, ok := err.(*kindErr); ok {
+		err = k.kind
+	}
+	for kind, e := range ErrorKinds {
+		if e == err {
+			return kind
+		}
+	}
+	return ""
+}
+
 type DriverParams map[string]string
 
+// InstanceParam is set in the DriverParams passed to an InitFunc to the
+// name the instance is created under. A driver registered as "nfs" can be
+// instantiated several times with names such as "nfs-fast" and "nfs-archive".
+const InstanceParam = "instance"
+
+// NamespaceParam optionally names the namespace, such as a cluster ID, that
+// a driver keeps its kvdb records under. See NewNamespacedEnumerator.
+const NamespaceParam = "namespace"
+
+// MigrateNamespaceParam set to "true" makes a driver started with a
+// NamespaceParam move the records it wrote without a namespace into it. See
+// MigrateNamespaceOnRequest, records are never moved otherwise.
+const MigrateNamespaceParam = "migrate_namespace"
+
+// TrashRetentionParam enables soft delete on drivers that support it. It is
+// a duration, such as "72h", that deleted volumes are kept before they are
+// purged. See Trasher.
+const TrashRetentionParam = "trash_retention"
+
 type InitFunc func(params DriverParams) (VolumeDriver, error)
 
 type DriverType string
@@ -57,9 +136,9 @@ type ProtoDriver interface {
 	// Errors ErrEnoEnt, ErrVolHasSnaps may be returned.
 	Delete(volumeID api.VolumeID) error
 
-	// Mount volume at specified path
+	// Mount volume at specified path with opts, defaults if opts is nil.
 	// Errors ErrEnoEnt, ErrVolDetached may be returned.
-	Mount(volumeID api.VolumeID, mountpath string) error
+	Mount(volumeID api.VolumeID, mountpath string, opts *api.MountOptions) error
 
 	// Unmount volume at specified path
 	// Errors ErrEnoEnt, ErrVolDetached may be returned.
@@ -125,6 +204,347 @@ type BlockDriver interface {
 	Detach(volumeID api.VolumeID) error
 }
 
+// Wrapper is implemented by drivers that add behaviour to another driver,
+// such as the ones returned by WithRetry and WithAudit.
+type Wrapper interface {
+	// Unwrap returns the wrapped driver.
+	Unwrap() VolumeDriver
+}
+
+// Unwrap returns the innermost driver wrapped by d, or d itself. The
+// optional interfaces below are looked up on it, so that wrapping a driver
+// does not hide them.
+func Unwrap(d VolumeDriver) VolumeDriver {
+	for {
+		w, ok := d.(Wrapper)
+		if !ok {
+			return d
+		}
+		d = w.Unwrap()
+	}
+}
+
+// FsSupporter is implemented by drivers that restrict the filesystem formats
+// accepted by Create.
+type FsSupporter interface {
+	// SupportedFilesystems lists the formats this driver can create.
+	SupportedFilesystems() []api.Filesystem
+}
+
+// SupportedFilesystems returns the filesystem formats accepted by driver d.
+// Drivers that do not implement FsSupporter accept any valid format.
+func SupportedFilesystems(d VolumeDriver) []api.Filesystem {
+	if fs, ok := Unwrap(d).(FsSupporter); ok {
+		return fs.SupportedFilesystems()
+	}
+	return []api.Filesystem{
+		api.FsXfs, api.FsExt4, api.FsZfs, api.FsBtrfs, api.FsNfs, api.FsNone,
+	}
+}
+
+// ValidateFormat checks that format is a known filesystem and that driver d
+// supports it.
+func ValidateFormat(d VolumeDriver, format api.Filesystem) error {
+	if !format.Valid() {
+		return KindErrorf(ErrFsNotSupported, "Unknown filesystem format %q", format)
+	}
+	for _, v := range SupportedFilesystems(d) {
+		if v == format {
+			return nil
+		}
+	}
+	return KindErrorf(ErrFsNotSupported, "%v: %q, %v supports %v",
+		ErrFsNotSupported, format, d, SupportedFilesystems(d))
+}
+
+// Trimmer is implemented by drivers that can discard unused blocks of a
+// thinly provisioned volume.
+type Trimmer interface {
+	// Trim releases freed blocks of volumeID back to the backing store and
+	// returns the number of bytes reclaimed. It does not require the volume
+	// to be mounted. Drivers whose volumes share a filesystem may trim, and
+	// count, the free space of the whole filesystem.
+	Trim(volumeID api.VolumeID) (uint64, error)
+}
+
+// Trim calls Trim on d if it is a Trimmer, otherwise returns ErrNotSupported.
+func Trim(d VolumeDriver, volumeID api.VolumeID) (uint64, error) {
+	if t, ok := Unwrap(d).(Trimmer); ok {
+		return t.Trim(volumeID)
+	}
+	return 0, ErrNotSupported
+}
+
+// Promoter is implemented by drivers whose snapshots share data with the
+// volume they were taken of.
+type Promoter interface {
+	// PromoteSnapshot turns snapID into an independent volume with the same
+	// ID. The snapshot no longer exists afterwards.
+	// Errors ErrSnapNotFound may be returned.
+	PromoteSnapshot(snapID api.SnapID) (api.VolumeID, error)
+}
+
+// PromoteSnapshot calls PromoteSnapshot on d if it is a Promoter, otherwise
+// returns ErrNotSupported.
+func PromoteSnapshot(d VolumeDriver, snapID api.SnapID) (api.VolumeID, error) {
+	if p, ok := Unwrap(d).(Promoter); ok {
+		return p.PromoteSnapshot(snapID)
+	}
+	return api.BadVolumeID, ErrNotSupported
+}
+
+// Defragmenter is implemented by drivers that can defragment a volume while
+// it is in use.
+type Defragmenter interface {
+	// Defragment rewrites fragmented files of volumeID. It can take a long
+	// time on large volumes.
+	Defragment(volumeID api.VolumeID) error
+}
+
+// Defragment calls Defragment on d if it is a Defragmenter, otherwise
+// returns ErrNotSupported.
+func Defragment(d VolumeDriver, volumeID api.VolumeID) error {
+	if f, ok := Unwrap(d).(Defragmenter); ok {
+		return f.Defragment(volumeID)
+	}
+	return ErrNotSupported
+}
+
+// SnapMounter is implemented by drivers that can expose a snapshot's contents
+// without creating a volume from it.
+type SnapMounter interface {
+	// MountSnap mounts snapID read-only at mountpath. A snapshot can be
+	// mounted at several paths at once.
+	// Errors ErrSnapNotFound may be returned.
+	MountSnap(snapID api.SnapID, mountpath string) error
+
+	// UnmountSnap unmounts snapID from mountpath.
+	// Errors ErrSnapNotFound may be returned.
+	UnmountSnap(snapID api.SnapID, mountpath string) error
+}
+
+// Reconfigurer is implemented by drivers that can apply configuration
+// changes without a restart.
+type Reconfigurer interface {
+	// Reconfigure applies params to future operations. It fails without
+	// applying anything if a param cannot be changed at runtime.
+	Reconfigure(params DriverParams) error
+}
+
+// Reconfigure calls Reconfigure on d if it is a Reconfigurer, otherwise
+// returns ErrNotSupported.
+func Reconfigure(d VolumeDriver, params DriverParams) error {
+	if r, ok := Unwrap(d).(Reconfigurer); ok {
+		return r.Reconfigure(params)
+	}
+	return ErrNotSupported
+}
+
+// Importer is implemented by drivers that can take ownership of existing
+// data without copying it.
+type Importer interface {
+	// Import registers the data at path as a new volume.
+	Import(path string, locator api.VolumeLocator, spec *api.VolumeSpec) (api.VolumeID, error)
+}
+
+// SnapDiffer is implemented by drivers that can report the changes between
+// two snapshots of the same volume.
+type SnapDiffer interface {
+	// SnapDiff returns the regions that changed from base to target.
+	SnapDiff(base, target api.SnapID) ([]api.BlockChange, error)
+}
+
+// SnapDiff calls SnapDiff on d if it is a SnapDiffer, otherwise returns
+// ErrNotSupported. Callers should fall back to a full copy in that case.
+func SnapDiff(d VolumeDriver, base, target api.SnapID) ([]api.BlockChange, error) {
+	if s, ok := Unwrap(d).(SnapDiffer); ok {
+		return s.SnapDiff(base, target)
+	}
+	return nil, ErrNotSupported
+}
+
+// BackingMigrator is implemented by drivers that can move a volume's data
+// to a new location while it stays mounted.
+type BackingMigrator interface {
+	// MigrateBacking copies volumeID to newPath and switches the volume,
+	// and any mount of it, over to the copy.
+	MigrateBacking(volumeID api.VolumeID, newPath string) error
+}
+
+// Trasher is implemented by drivers that keep deleted volumes for a
+// retention period before purging them.
+type Trasher interface {
+	// Undelete recovers a deleted volume that has not been purged yet.
+	Undelete(volumeID api.VolumeID) error
+
+	// Purge permanently removes a deleted volume.
+	Purge(volumeID api.VolumeID) error
+
+	// EnumerateTrash returns the deleted volumes that have not been purged.
+	// Enumerate does not return them.
+	EnumerateTrash() ([]api.Volume, error)
+}
+
+// Throttler is implemented by drivers that can limit the IO rate of a
+// volume, see IopsLimitLabel and BpsLimitLabel.
+type Throttler interface {
+	// SetIOLimits changes the limits of volumeID. They apply at once if
+	// the volume is mounted.
+	SetIOLimits(volumeID api.VolumeID, limits IOLimits) error
+}
+
+// SetIOLimits calls SetIOLimits on d if it is a Throttler, otherwise returns
+// ErrNotSupported.
+func SetIOLimits(d VolumeDriver, volumeID api.VolumeID, limits IOLimits) error {
+	if t, ok := Unwrap(d).(Throttler); ok {
+		return t.SetIOLimits(volumeID, limits)
+	}
+	return ErrNotSupported
+}
+
+// Renamer is implemented by drivers that can change the name of a volume.
+type Renamer interface {
+	// Rename sets the locator name of volumeID to newName. It fails if
+	// another volume has that name.
+	// Errors ErrEnoEnt may be returned.
+	Rename(volumeID api.VolumeID, newName string) error
+}
+
+// Rename calls Rename on d if it is a Renamer, otherwise returns
+// ErrNotSupported.
+func Rename(d VolumeDriver, volumeID api.VolumeID, newName string) error {
+	if r, ok := Unwrap(d).(Renamer); ok {
+		return r.Rename(volumeID, newName)
+	}
+	return ErrNotSupported
+}
+
+// Tagger is implemented by drivers that can change the tags of a volume.
+type Tagger interface {
+	// UpdateTags replaces the tags of volumeID. Tags are checked with
+	// ValidateTags.
+	// Errors ErrEnoEnt may be returned.
+	UpdateTags(volumeID api.VolumeID, tags api.Labels) error
+}
+
+// UpdateTags calls UpdateTags on d if it is a Tagger, otherwise returns
+// ErrNotSupported.
+func UpdateTags(d VolumeDriver, volumeID api.VolumeID, tags api.Labels) error {
+	if t, ok := Unwrap(d).(Tagger); ok {
+		return t.UpdateTags(volumeID, tags)
+	}
+	return ErrNotSupported
+}
+
+// Manifester is implemented by drivers that can export and import their
+// volume records, see Manifest. DefaultEnumerator implements it.
+type Manifester interface {
+	// ExportManifest serializes all volume and snapshot records.
+	ExportManifest() ([]byte, error)
+	// ImportManifest restores the records of data.
+	ImportManifest(data []byte, opts ImportManifestOptions) error
+}
+
+// ExportManifest calls ExportManifest on d if it is a Manifester, otherwise
+// returns ErrNotSupported.
+func ExportManifest(d VolumeDriver) ([]byte, error) {
+	if m, ok := Unwrap(d).(Manifester); ok {
+		return m.ExportManifest()
+	}
+	return nil, ErrNotSupported
+}
+
+// ImportManifest calls ImportManifest on d if it is a Manifester, otherwise
+// returns ErrNotSupported.
+func ImportManifest(d VolumeDriver, data []byte, opts ImportManifestOptions) error {
+	if m, ok := Unwrap(d).(Manifester); ok {
+		return m.ImportManifest(data, opts)
+	}
+	return ErrNotSupported
+}
+
+// Versioner is implemented by drivers that version their data formats, so
+// that data moved between nodes can be checked for compatibility.
+type Versioner interface {
+	// Version of the driver's formats.
+	Version() api.DriverVersion
+}
+
+// FsChecker is implemented by drivers that can check the filesystem of a
+// volume.
+type FsChecker interface {
+	// CheckVolume checks the filesystem of volumeID and fixes the errors
+	// found if repair is set. Repair can lose data. The volume must not be
+	// mounted.
+	// Errors ErrEnoEnt, ErrVolumeBusy may be returned.
+	CheckVolume(volumeID api.VolumeID, repair bool) (api.FsckResult, error)
+}
+
+// CheckVolume calls CheckVolume on d if it is a FsChecker, otherwise
+// returns ErrNotSupported.
+func CheckVolume(d VolumeDriver, volumeID api.VolumeID, repair bool) (api.FsckResult, error) {
+	if c, ok := Unwrap(d).(FsChecker); ok {
+		return c.CheckVolume(volumeID, repair)
+	}
+	return api.FsckResult{}, ErrNotSupported
+}
+
+// ForceReleaser is implemented by drivers that can release a volume whose
+// mounts or devices are stuck.
+type ForceReleaser interface {
+	// ForceRelease lazily unmounts every mount of volumeID, tears down its
+	// devices and clears its attach state, even if Unmount and Detach fail.
+	// It is a last resort, processes using the volume lose access to it.
+	ForceRelease(volumeID api.VolumeID) error
+}
+
+// ForceRelease calls ForceRelease on d if it is a ForceReleaser, otherwise
+// returns ErrNotSupported.
+func ForceRelease(d VolumeDriver, volumeID api.VolumeID) error {
+	if f, ok := Unwrap(d).(ForceReleaser); ok {
+		return f.ForceRelease(volumeID)
+	}
+	return ErrNotSupported
+}
+
+// RecursiveDeleter is implemented by drivers whose volumes can have child
+// volumes that Delete refuses to delete.
+type RecursiveDeleter interface {
+	// DeleteRecursive deletes the children of volumeID and then the volume.
+	DeleteRecursive(volumeID api.VolumeID) error
+}
+
+// DeleteRecursive calls DeleteRecursive on d, or on the driver it wraps, if
+// it is a RecursiveDeleter, otherwise returns ErrNotSupported. Wrappers may
+// implement it to see the call.
+func DeleteRecursive(d VolumeDriver, volumeID api.VolumeID) error {
+	if r, ok := d.(RecursiveDeleter); ok {
+		return r.DeleteRecursive(volumeID)
+	}
+	if r, ok := Unwrap(d).(RecursiveDeleter); ok {
+		return r.DeleteRecursive(volumeID)
+	}
+	return ErrNotSupported
+}
+
+// Backuper is implemented by drivers that can serialize a volume's contents
+// into a stream and recreate a volume from such a stream.
+type Backuper interface {
+	// Backup writes the full contents of volumeID to dest. Drivers may
+	// accept a snapshot ID, so that it can be restored as the base of
+	// incremental backups.
+	Backup(volumeID api.VolumeID, dest io.Writer) error
+
+	// BackupIncremental writes the changes made to volumeID since the
+	// snapshot sinceSnapID to dest. The receiving side must already have
+	// restored the contents of sinceSnapID.
+	BackupIncremental(volumeID api.VolumeID, sinceSnapID api.SnapID, dest io.Writer) error
+
+	// Restore creates a new volume from a stream written by Backup or
+	// BackupIncremental.
+	Restore(src io.Reader) (api.VolumeID, error)
+}
+
 func Shutdown() {
 	mutex.Lock()
 	defer mutex.Unlock()
@@ -147,8 +567,18 @@ func New(name string, params DriverParams) (VolumeDriver, error) {
 	if _, ok := instances[name]; ok {
 		return nil, ErrExist
 	}
-	if initFunc, exists := drivers[name]; exists {
-		driver, err := initFunc(params)
+	initFunc, exists := drivers[name]
+	if !exists {
+		// Instances are named <driver>-<suffix>.
+		initFunc, exists = drivers[strings.SplitN(name, "-", 2)[0]]
+	}
+	if exists {
+		instParams := make(DriverParams, len(params)+1)
+		for k, v := range params {
+			instParams[k] = v
+		}
+		instParams[InstanceParam] = name
+		driver, err := initFunc(instParams)
 		if err != nil {
 			return nil, err
 		}
@@ -165,10 +595,70 @@ func Register(name string, driverType DriverType, initFunc InitFunc) error {
 		return ErrExist
 	}
 	drivers[name] = initFunc
+	driverTypes[name] = driverType
 	return nil
 }
 
+// Instances returns the names of the loaded driver instances, sorted.
+func Instances() []string {
+	mutex.Lock()
+	defer mutex.Unlock()
+	names := make([]string, 0, len(instances))
+	for name := range instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Info describes the loaded driver instance name. Status is only collected
+// if withStatus is set.
+func Info(name string, withStatus bool) (api.DriverInfo, error) {
+	mutex.Lock()
+	d, ok := instances[name]
+	t, tok := driverTypes[name]
+	if !tok {
+		t = driverTypes[strings.SplitN(name, "-", 2)[0]]
+	}
+	mutex.Unlock()
+	if !ok {
+		return api.DriverInfo{}, ErrDriverNotFound
+	}
+	info := api.DriverInfo{
+		Name:         name,
+		Type:         string(t),
+		Capabilities: GetCapabilities(d).Names(),
+	}
+	if v, err := GetDriverVersion(d); err == nil {
+		info.Version = &v
+	}
+	if withStatus {
+		info.Status = d.Status()
+	}
+	return info, nil
+}
+
 func init() {
 	drivers = make(map[string]InitFunc)
+	driverTypes = make(map[string]DriverType)
 	instances = make(map[string]VolumeDriver)
 }
+
+// Quiesce holds IO on volumeID if d is a Quiescer, otherwise returns
+// ErrNotSupported. Drivers thaw the volume after a timeout if Unquiesce is
+// not called.
+func Quiesce(d VolumeDriver, volumeID api.VolumeID) error {
+	if q, ok := Unwrap(d).(Quiescer); ok {
+		return q.Quiesce([]api.VolumeID{volumeID})
+	}
+	return ErrNotSupported
+}
+
+// Unquiesce resumes IO on volumeID if d is a Quiescer, otherwise returns
+// ErrNotSupported.
+func Unquiesce(d VolumeDriver, volumeID api.VolumeID) error {
+	if q, ok := Unwrap(d).(Quiescer); ok {
+		return q.Unquiesce([]api.VolumeID{volumeID})
+	}
+	return ErrNotSupported
+}
@@ -0,0 +1,61 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+)
+
+// waitPollInterval between Inspect calls in WaitForState.
+var waitPollInterval = 500 * time.Millisecond
+
+// StateTimeoutError is returned by WaitForState when the volume did not
+// reach the target state in time.
+type StateTimeoutError struct {
+	VolumeID api.VolumeID
+	Target   api.VolumeState
+	// Last state observed, 0 if the volume could not be inspected.
+	Last api.VolumeState
+}
+
+func (e *StateTimeoutError) Error() string {
+	return fmt.Sprintf("Timed out waiting for volume %v to reach state %v, last state %v",
+		e.VolumeID, e.Target, e.Last)
+}
+
+// WaitForState polls e until volumeID is in one of the states in the target
+// mask, timeout expires or ctx is done. It returns immediately if the volume
+// already is in a target state. A StateTimeoutError is returned on timeout
+// and ctx.Err() if ctx is done first.
+func WaitForState(
+	ctx context.Context,
+	e Enumerator,
+	volumeID api.VolumeID,
+	target api.VolumeState,
+	timeout time.Duration) error {
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+
+	var last api.VolumeState
+	for {
+		vols, err := e.Inspect([]api.VolumeID{volumeID})
+		if err == nil && len(vols) == 1 {
+			last = vols[0].State
+			if last&target != 0 {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return &StateTimeoutError{VolumeID: volumeID, Target: target, Last: last}
+		case <-ticker.C:
+		}
+	}
+}